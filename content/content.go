@@ -0,0 +1,200 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package content defines the storage of blobs addressed by their digest,
+// with an in-memory and a filesystem implementation.
+package content
+
+import (
+	"bytes"
+	"context"
+	_ "crypto/sha256" // side-effect to install impls, sha256
+	_ "crypto/sha512" // side-effect to install impls, sha384/sh512
+	"io"
+	"io/ioutil"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is returned for a blob which is not in a Store.
+	ErrNotFound = errors.New("blob not found")
+
+	// ErrDigestMismatch is returned for content which does not match its expected digest.
+	ErrDigestMismatch = errors.New("digest mismatch")
+
+	// ErrSizeMismatch is returned for content which does not have its expected size.
+	ErrSizeMismatch = errors.New("size mismatch")
+)
+
+// Info describes a blob of a Store.
+type Info struct {
+	Digest digest.Digest
+	Size   int64
+
+	// UpdatedAt is the time the blob was last written.
+	UpdatedAt time.Time
+}
+
+// A Provider reads blobs.
+type Provider interface {
+	// Fetch opens the blob desc points to. It fails with ErrNotFound if there is none.
+	// Reading the blob fails with ErrSizeMismatch or ErrDigestMismatch if its content does not match desc.
+	Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error)
+}
+
+// An Ingester writes blobs.
+type Ingester interface {
+	// Writer returns a Writer of a new blob, whose digest is computed with algorithm,
+	// digest.Canonical if empty. The caller must Close it.
+	Writer(ctx context.Context, algorithm digest.Algorithm) (Writer, error)
+}
+
+// A Writer writes a blob, which is only available once committed.
+type Writer interface {
+	io.Writer
+
+	// Digest returns the digest of the content written so far.
+	Digest() digest.Digest
+
+	// Size returns the size of the content written so far.
+	Size() int64
+
+	// Commit makes the blob available.
+	// It fails with ErrSizeMismatch if size is not negative and is not the size of the content written,
+	// and with ErrDigestMismatch if expected is not empty and is not the digest of the content written.
+	Commit(ctx context.Context, size int64, expected digest.Digest) error
+
+	// Close discards the blob unless it was committed.
+	Close() error
+}
+
+// A Manager lists and removes blobs.
+type Manager interface {
+	// Info describes the blob dgst. It fails with ErrNotFound if there is none.
+	Info(ctx context.Context, dgst digest.Digest) (Info, error)
+
+	// Delete removes the blob dgst. It fails with ErrNotFound if there is none.
+	Delete(ctx context.Context, dgst digest.Digest) error
+
+	// Walk calls fn with every blob, sorted by digest, until fn returns an error.
+	Walk(ctx context.Context, fn func(Info) error) error
+}
+
+// A Store reads, writes, lists and removes blobs.
+type Store interface {
+	Provider
+	Ingester
+	Manager
+}
+
+// ReadBlob returns the content of the blob desc points to, verified against desc.
+func ReadBlob(ctx context.Context, p Provider, desc v1.Descriptor) ([]byte, error) {
+	rc, err := p.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// WriteBlob writes the blob desc points to with the content of r, verified against desc.
+func WriteBlob(ctx context.Context, ing Ingester, r io.Reader, desc v1.Descriptor) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid digest %q", desc.Digest)
+	}
+	w, err := ing.Writer(ctx, desc.Digest.Algorithm())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, io.LimitReader(r, desc.Size+1)); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	return w.Commit(ctx, desc.Size, desc.Digest)
+}
+
+// WriteBlobBytes writes a blob holding buf and returns its descriptor, with the media type mediaType.
+func WriteBlobBytes(ctx context.Context, ing Ingester, mediaType string, buf []byte) (v1.Descriptor, error) {
+	desc := v1.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(buf),
+		Size:      int64(len(buf)),
+	}
+	return desc, WriteBlob(ctx, ing, bytes.NewReader(buf), desc)
+}
+
+// verifyingReader verifies the content of a blob as it is read.
+type verifyingReader struct {
+	r        io.Reader
+	c        io.Closer
+	desc     v1.Descriptor
+	verifier digest.Verifier
+	n        int64
+}
+
+// newVerifyingReader returns a reader of rc failing at its end if its content does not match desc.
+func newVerifyingReader(rc io.ReadCloser, desc v1.Descriptor) io.ReadCloser {
+	return &verifyingReader{
+		r:        io.LimitReader(rc, desc.Size+1),
+		c:        rc,
+		desc:     desc,
+		verifier: desc.Digest.Verifier(),
+	}
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.verifier.Write(p[:n])
+	if err == io.EOF {
+		if r.n != r.desc.Size {
+			return n, errors.Wrapf(ErrSizeMismatch, "blob %s", r.desc.Digest)
+		}
+		if !r.verifier.Verified() {
+			return n, errors.Wrapf(ErrDigestMismatch, "blob %s", r.desc.Digest)
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.c.Close()
+}
+
+// checkCommit checks the content written, of size n and digest dgst, against the arguments of Writer.Commit.
+func checkCommit(n int64, dgst digest.Digest, size int64, expected digest.Digest) error {
+	if size >= 0 && size != n {
+		return errors.Wrapf(ErrSizeMismatch, "blob %s has size %d, expected %d", dgst, n, size)
+	}
+	if expected != "" && expected != dgst {
+		return errors.Wrapf(ErrDigestMismatch, "blob has digest %s, expected %s", dgst, expected)
+	}
+	return nil
+}
+
+// writerAlgorithm returns the algorithm of a new Writer, see Ingester.
+func writerAlgorithm(algorithm digest.Algorithm) (digest.Algorithm, error) {
+	if algorithm == "" {
+		algorithm = digest.Canonical
+	}
+	if !algorithm.Available() {
+		return "", errors.Wrapf(digest.ErrDigestUnsupported, "%s", algorithm)
+	}
+	return algorithm, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package content
+
+import (
+	"context"
+	_ "crypto/sha512"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func TestStores(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{
+			name:  "memory",
+			store: func(t *testing.T) Store { return NewMemoryStore() },
+		},
+		{
+			name:  "file",
+			store: func(t *testing.T) Store { return NewFileStore(t.TempDir()) },
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			testStore(t, tt.store(t))
+		})
+	}
+}
+
+// testStore checks the contract of Store against s, which must be empty.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	hello, err := WriteBlobBytes(ctx, s, v1.MediaTypeImageConfig, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ReadBlob(ctx, s, hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("expected %q, got %q", "hello", buf)
+	}
+	info, err := s.Info(ctx, hello.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Digest != hello.Digest || info.Size != 5 || info.UpdatedAt.IsZero() {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	// rewriting a blob is harmless
+	if err := WriteBlob(ctx, s, strings.NewReader("hello"), hello); err != nil {
+		t.Fatal(err)
+	}
+
+	missing := v1.Descriptor{Digest: digest.FromString("missing"), Size: 7}
+	if _, err := s.Fetch(ctx, missing); errors.Cause(err) != ErrNotFound {
+		t.Errorf("Fetch: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Info(ctx, missing.Digest); errors.Cause(err) != ErrNotFound {
+		t.Errorf("Info: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Delete(ctx, missing.Digest); errors.Cause(err) != ErrNotFound {
+		t.Errorf("Delete: expected ErrNotFound, got %v", err)
+	}
+
+	wrongSize := hello
+	wrongSize.Size = 4
+	if _, err := ReadBlob(ctx, s, wrongSize); errors.Cause(err) != ErrSizeMismatch {
+		t.Errorf("expected ErrSizeMismatch, got %v", err)
+	}
+
+	for i, tt := range []struct {
+		content string
+		desc    v1.Descriptor
+		cause   error
+	}{
+		{
+			content: "hello, wordl",
+			desc:    v1.Descriptor{Digest: digest.FromString("hello, world"), Size: 12},
+			cause:   ErrDigestMismatch,
+		},
+		{
+			content: "bye",
+			desc:    v1.Descriptor{Digest: digest.FromString("bye"), Size: 4},
+			cause:   ErrSizeMismatch,
+		},
+		{
+			content: "hello, world!",
+			desc:    v1.Descriptor{Digest: digest.FromString("hello, world"), Size: 12},
+			cause:   ErrSizeMismatch,
+		},
+	} {
+		if err := WriteBlob(ctx, s, strings.NewReader(tt.content), tt.desc); errors.Cause(err) != tt.cause {
+			t.Errorf("test %d: expected %v, got %v", i, tt.cause, err)
+		}
+		if _, err := s.Info(ctx, tt.desc.Digest); errors.Cause(err) != ErrNotFound {
+			t.Errorf("test %d: the blob was written", i)
+		}
+	}
+
+	w, err := s.Writer(ctx, digest.SHA512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(ctx, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	world := v1.Descriptor{Digest: digest.SHA512.FromString("world"), Size: 5}
+	if w.Digest() != world.Digest || w.Size() != world.Size {
+		t.Errorf("expected %s of size %d, got %s of size %d", world.Digest, world.Size, w.Digest(), w.Size())
+	}
+	if _, err := ReadBlob(ctx, s, world); err != nil {
+		t.Error(err)
+	}
+
+	// an uncommitted blob is discarded
+	w, err = s.Writer(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("discarded"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Info(ctx, digest.FromString("discarded")); errors.Cause(err) != ErrNotFound {
+		t.Error("an uncommitted blob was written")
+	}
+
+	if _, err := s.Writer(ctx, "sha1"); errors.Cause(err) != digest.ErrDigestUnsupported {
+		t.Errorf("expected ErrDigestUnsupported, got %v", err)
+	}
+
+	expected := []digest.Digest{hello.Digest, world.Digest}
+	var listed []digest.Digest
+	if err := s.Walk(ctx, func(info Info) error {
+		listed = append(listed, info.Digest)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(listed, expected) {
+		t.Errorf("expected %v, got %v", expected, listed)
+	}
+
+	stop := errors.New("stop")
+	var n int
+	if err := s.Walk(ctx, func(info Info) error {
+		n++
+		return stop
+	}); err != stop || n != 1 {
+		t.Errorf("expected Walk to stop, got %v after %d blobs", err, n)
+	}
+
+	if err := s.Delete(ctx, hello.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Fetch(ctx, hello); errors.Cause(err) != ErrNotFound {
+		t.Errorf("expected ErrNotFound after Delete, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s := NewFileStore(root)
+
+	desc, err := WriteBlobBytes(ctx, s, v1.MediaTypeImageConfig, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(root, "blobs", "sha256", desc.Digest.Encoded())
+	if buf, err := ioutil.ReadFile(p); err != nil || string(buf) != "hello" {
+		t.Errorf("expected the blob in %s, got %q, %v", p, buf, err)
+	}
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != BlobsDir {
+		t.Errorf("temporary files were left in %s", root)
+	}
+
+	// files which are not blobs are not listed
+	if err := ioutil.WriteFile(filepath.Join(root, "blobs", "sha256", "stray"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "blobs", "sha256", digest.FromString("dir").Encoded()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.Walk(ctx, func(Info) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 blob, got %d", n)
+	}
+
+	// the content of a blob is verified as it is read
+	if err := ioutil.WriteFile(p, []byte("jello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBlob(ctx, s, desc); errors.Cause(err) != ErrDigestMismatch {
+		t.Errorf("expected ErrDigestMismatch, got %v", err)
+	}
+
+	if _, err := s.Fetch(ctx, v1.Descriptor{Digest: "sha256:../../etc/passwd"}); err == nil {
+		t.Error("expected an invalid digest to fail")
+	}
+
+	// a store without blobs directory is empty
+	if err := NewFileStore(filepath.Join(root, "missing")).Walk(ctx, func(Info) error {
+		t.Error("unexpected blob")
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestStandalone runs a program importing content but no hash function,
+// since test binaries install sha256 whatever the packages they test import.
+func TestStandalone(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	if out, err := exec.Command(goTool, "run", "./testdata/standalone").CombinedOutput(); err != nil {
+		t.Errorf("%v: %s", err, out)
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package content
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/internal/fsutil"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// BlobsDir is the directory of a FileStore holding the blobs, as in an image layout.
+	BlobsDir = "blobs"
+
+	// tempPattern is the pattern of the names of the temporary files, at the root of a FileStore.
+	tempPattern = ".tmp-*"
+)
+
+// A FileStore is a Store keeping the blobs in the files blobs/<alg>/<encoded> of a directory,
+// as in an image layout.
+// Blobs are written to temporary files at the root of the directory, then renamed once verified,
+// so that the files of the blobs directory are always complete.
+type FileStore struct {
+	root string
+}
+
+// NewFileStore returns a FileStore in the directory root.
+func NewFileStore(root string) *FileStore {
+	return &FileStore{root: root}
+}
+
+// BlobPath returns the path of the blob dgst, relative to the root of a FileStore.
+func BlobPath(dgst digest.Digest) (string, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", errors.Wrapf(err, "invalid digest %q", dgst)
+	}
+	return filepath.Join(BlobsDir, dgst.Algorithm().String(), dgst.Encoded()), nil
+}
+
+// path returns the path of the blob dgst.
+func (s *FileStore) path(dgst digest.Digest) (string, error) {
+	p, err := BlobPath(dgst)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, p), nil
+}
+
+// Fetch implements Provider.
+func (s *FileStore) Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	p, err := s.path(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotFound, "%s", desc.Digest)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read blob")
+	}
+	if fi, err := f.Stat(); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "read blob")
+	} else if fi.Size() != desc.Size {
+		f.Close()
+		return nil, errors.Wrapf(ErrSizeMismatch, "blob %s has size %d, expected %d", desc.Digest, fi.Size(), desc.Size)
+	}
+	return newVerifyingReader(f, desc), nil
+}
+
+// Writer implements Ingester.
+func (s *FileStore) Writer(ctx context.Context, algorithm digest.Algorithm) (Writer, error) {
+	algorithm, err := writerAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(s.root, tempPattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "create blob")
+	}
+	return &fileWriter{
+		s:        s,
+		f:        f,
+		digester: algorithm.Digester(),
+	}, nil
+}
+
+// Info implements Manager.
+func (s *FileStore) Info(ctx context.Context, dgst digest.Digest) (Info, error) {
+	p, err := s.path(dgst)
+	if err != nil {
+		return Info{}, err
+	}
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return Info{}, errors.Wrapf(ErrNotFound, "%s", dgst)
+	}
+	if err != nil {
+		return Info{}, errors.Wrap(err, "stat blob")
+	}
+	return Info{Digest: dgst, Size: fi.Size(), UpdatedAt: fi.ModTime()}, nil
+}
+
+// Delete implements Manager.
+func (s *FileStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	p, err := s.path(dgst)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return errors.Wrapf(ErrNotFound, "%s", dgst)
+	}
+	return errors.Wrap(err, "remove blob")
+}
+
+// Walk implements Manager.
+// Files of the blobs directory which are not named after a valid digest are skipped.
+func (s *FileStore) Walk(ctx context.Context, fn func(Info) error) error {
+	var infos []Info
+
+	algs, err := ioutil.ReadDir(filepath.Join(s.root, BlobsDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "list blobs")
+	}
+	for _, alg := range algs {
+		if !alg.IsDir() {
+			continue
+		}
+		entries, err := ioutil.ReadDir(filepath.Join(s.root, BlobsDir, alg.Name()))
+		if err != nil {
+			return errors.Wrap(err, "list blobs")
+		}
+		for _, fi := range entries {
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), fi.Name())
+			if !fi.Mode().IsRegular() || dgst.Validate() != nil {
+				continue
+			}
+			infos = append(infos, Info{Digest: dgst, Size: fi.Size(), UpdatedAt: fi.ModTime()})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Digest < infos[j].Digest })
+	for _, info := range infos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type fileWriter struct {
+	s        *FileStore
+	f        *os.File
+	digester digest.Digester
+	size     int64
+	done     bool
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.New("blob writer is closed")
+	}
+	n, err := w.f.Write(p)
+	w.digester.Hash().Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *fileWriter) Digest() digest.Digest {
+	return w.digester.Digest()
+}
+
+func (w *fileWriter) Size() int64 {
+	return w.size
+}
+
+func (w *fileWriter) Commit(ctx context.Context, size int64, expected digest.Digest) error {
+	if w.done {
+		return errors.New("blob writer is closed")
+	}
+	dgst := w.Digest()
+	if err := checkCommit(w.size, dgst, size, expected); err != nil {
+		return err
+	}
+
+	if err := w.f.Sync(); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	if err := w.f.Chmod(0644); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	if err := w.f.Close(); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	w.done = true
+
+	p, err := w.s.path(dgst)
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		os.Remove(w.f.Name())
+		return errors.Wrap(err, "write blob")
+	}
+	if err := os.Rename(w.f.Name(), p); err != nil {
+		os.Remove(w.f.Name())
+		return errors.Wrap(err, "write blob")
+	}
+	return errors.Wrap(fsutil.SyncDir(dir), "write blob")
+}
+
+func (w *fileWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.f.Close()
+	return os.Remove(w.f.Name())
+}
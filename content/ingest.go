@@ -0,0 +1,435 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package content
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/internal/fsutil"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// IngestDir is the directory of a FileStore holding the ingestions in progress.
+	IngestDir = ".ingest"
+
+	// ingestDataFile and ingestStateFile are the files of an ingestion, in its directory.
+	ingestDataFile  = "data"
+	ingestStateFile = "state.json"
+
+	// checkpointInterval is the number of bytes written between checkpoints of an ingestion.
+	checkpointInterval = 4 << 20
+)
+
+var (
+	// ErrNoIngestion is returned for a reference under which no blob is being ingested.
+	ErrNoIngestion = errors.New("ingestion not found")
+
+	// ErrIngestionConflict is returned when resuming the ingestion of a blob under a reference
+	// ingesting another blob.
+	ErrIngestionConflict = errors.New("reference is ingesting another blob")
+)
+
+// Status describes an ingestion of a FileStore.
+type Status struct {
+	// Ref is the reference of the ingestion, chosen by its writer.
+	Ref string
+
+	// Expected points to the blob being ingested.
+	Expected v1.Descriptor
+
+	// Offset is the number of bytes written so far, out of Expected.Size.
+	Offset int64
+
+	StartedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ingestState is the state.json file of an ingestion, from which it is resumed.
+type ingestState struct {
+	Ref      string        `json:"ref"`
+	Expected v1.Descriptor `json:"expected"`
+
+	// Offset is the size of the data file at the time of the checkpoint, and Hash the state of
+	// its digester, if the hash function supports encoding.BinaryMarshaler.
+	Offset int64  `json:"offset"`
+	Hash   []byte `json:"hash,omitempty"`
+
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// ingestPath returns the directory of the ingestion ref.
+// References are hashed so that any string can name an ingestion.
+func (s *FileStore) ingestPath(ref string) string {
+	return filepath.Join(s.root, IngestDir, digest.FromString(ref).Encoded())
+}
+
+// An Ingestion writes a blob under a reference, so that the write can be resumed
+// after an interruption, by another process if need be.
+// The content written is checkpointed to the ingestion directory of the FileStore
+// every few megabytes and when the Ingestion is closed; resuming it restarts at the last checkpoint.
+// An Ingestion is not safe for concurrent use, and a reference must not be ingested by two writers at once.
+type Ingestion struct {
+	s        *FileStore
+	dir      string
+	f        *os.File
+	state    ingestState
+	digester digest.Digester
+	size     int64
+
+	// checkpointed is the size at the last checkpoint
+	checkpointed int64
+
+	updatedAt time.Time
+	done      bool
+}
+
+var _ Writer = (*Ingestion)(nil)
+
+// Ingest starts writing the blob expected points to under the reference ref,
+// or resumes the ingestion ref if there is one, in which case the caller continues writing
+// the content of the blob from the offset Size returns.
+// Resuming fails with ErrIngestionConflict if ref is ingesting another blob.
+// The caller must Commit, Close or Abort the Ingestion.
+func (s *FileStore) Ingest(ctx context.Context, ref string, expected v1.Descriptor) (*Ingestion, error) {
+	if ref == "" {
+		return nil, errors.New("empty ingestion reference")
+	}
+	if err := expected.Digest.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid digest %q", expected.Digest)
+	}
+	if expected.Size < 0 {
+		return nil, errors.Errorf("invalid size %d", expected.Size)
+	}
+	if _, err := writerAlgorithm(expected.Digest.Algorithm()); err != nil {
+		return nil, err
+	}
+
+	w := &Ingestion{
+		s:        s,
+		dir:      s.ingestPath(ref),
+		digester: expected.Digest.Algorithm().Digester(),
+	}
+	flag := os.O_RDWR | os.O_CREATE
+	state, err := readIngestState(w.dir)
+	switch {
+	case os.IsNotExist(errors.Cause(err)):
+		// a data file without state is left by an ingestion interrupted as it started
+		flag |= os.O_TRUNC
+		if err := os.MkdirAll(w.dir, 0755); err != nil {
+			return nil, errors.Wrap(err, "start ingestion")
+		}
+		w.state = ingestState{Ref: ref, Expected: expected, StartedAt: time.Now().UTC()}
+		if err := w.writeState(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case state.Ref != ref || state.Expected.Digest != expected.Digest || state.Expected.Size != expected.Size:
+		return nil, errors.Wrapf(ErrIngestionConflict, "%q ingests %s", ref, state.Expected.Digest)
+	default:
+		w.state = state
+	}
+
+	w.f, err = os.OpenFile(filepath.Join(w.dir, ingestDataFile), flag, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "open ingestion")
+	}
+	if err := w.resume(); err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	w.checkpointed = w.size
+	w.updatedAt = time.Now().UTC()
+	return w, nil
+}
+
+// resume restores the digester and the offset of w from its state, or from its data file
+// if the state of the digester was not saved.
+func (w *Ingestion) resume() error {
+	fi, err := w.f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "resume ingestion")
+	}
+	offset := w.state.Offset
+	if u, ok := w.digester.Hash().(encoding.BinaryUnmarshaler); ok && w.state.Hash != nil &&
+		offset <= fi.Size() && u.UnmarshalBinary(w.state.Hash) == nil {
+		// the data written after the checkpoint is discarded, its hash is lost
+		if err := w.f.Truncate(offset); err != nil {
+			return errors.Wrap(err, "resume ingestion")
+		}
+		if _, err := w.f.Seek(offset, io.SeekStart); err != nil {
+			return errors.Wrap(err, "resume ingestion")
+		}
+		w.size = offset
+		return nil
+	}
+
+	w.digester = w.state.Expected.Digest.Algorithm().Digester()
+	if fi.Size() > w.state.Expected.Size {
+		// the data cannot be the blob, start over
+		if err := w.f.Truncate(0); err != nil {
+			return errors.Wrap(err, "resume ingestion")
+		}
+	}
+	n, err := io.Copy(w.digester.Hash(), w.f)
+	if err != nil {
+		return errors.Wrap(err, "resume ingestion")
+	}
+	w.size = n
+	return nil
+}
+
+// Write writes p to the blob. It fails with ErrSizeMismatch if the blob would exceed the expected size.
+func (w *Ingestion) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.New("ingestion is closed")
+	}
+	if w.size+int64(len(p)) > w.state.Expected.Size {
+		return 0, errors.Wrapf(ErrSizeMismatch, "blob %s exceeds its size %d", w.state.Expected.Digest, w.state.Expected.Size)
+	}
+	n, err := w.f.Write(p)
+	w.digester.Hash().Write(p[:n])
+	w.size += int64(n)
+	w.updatedAt = time.Now().UTC()
+	if err != nil {
+		return n, errors.Wrap(err, "write blob")
+	}
+	if w.size-w.checkpointed >= checkpointInterval {
+		if err := w.checkpoint(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Digest returns the digest of the content written so far.
+func (w *Ingestion) Digest() digest.Digest {
+	return w.digester.Digest()
+}
+
+// Size returns the size of the content written so far, which is the offset at which to resume writing.
+func (w *Ingestion) Size() int64 {
+	return w.size
+}
+
+// Status returns the progress of the ingestion.
+func (w *Ingestion) Status() Status {
+	return Status{
+		Ref:       w.state.Ref,
+		Expected:  w.state.Expected,
+		Offset:    w.size,
+		StartedAt: w.state.StartedAt,
+		UpdatedAt: w.updatedAt,
+	}
+}
+
+// Commit moves the blob to the blobs directory and removes the ingestion.
+// It fails with ErrSizeMismatch or ErrDigestMismatch if the content written does not match
+// the expected descriptor, or the arguments as in Writer.Commit, in which case the ingestion
+// is removed too, since resuming it could not succeed.
+func (w *Ingestion) Commit(ctx context.Context, size int64, expected digest.Digest) error {
+	if w.done {
+		return errors.New("ingestion is closed")
+	}
+	dgst := w.Digest()
+	err := checkCommit(w.size, dgst, w.state.Expected.Size, w.state.Expected.Digest)
+	if err == nil {
+		err = checkCommit(w.size, dgst, size, expected)
+	}
+	if err != nil {
+		w.Abort()
+		return err
+	}
+
+	if err := w.f.Sync(); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	if err := w.f.Close(); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	w.done = true
+
+	p, err := w.s.path(dgst)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	if err := os.Rename(filepath.Join(w.dir, ingestDataFile), p); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	if err := fsutil.SyncDir(dir); err != nil {
+		return errors.Wrap(err, "write blob")
+	}
+	return errors.Wrap(os.RemoveAll(w.dir), "remove ingestion")
+}
+
+// Close checkpoints the ingestion, unless it was committed, so that it can be resumed.
+func (w *Ingestion) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	err := w.checkpoint()
+	if cerr := w.f.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "close ingestion")
+	}
+	return err
+}
+
+// Abort discards the ingestion, unless it was committed.
+func (w *Ingestion) Abort() error {
+	if !w.done {
+		w.done = true
+		w.f.Close()
+	}
+	return errors.Wrap(os.RemoveAll(w.dir), "remove ingestion")
+}
+
+// checkpoint flushes the data file and saves the state of w.
+func (w *Ingestion) checkpoint() error {
+	if err := w.f.Sync(); err != nil {
+		return errors.Wrap(err, "checkpoint ingestion")
+	}
+	w.state.Offset = w.size
+	w.state.Hash = nil
+	if m, ok := w.digester.Hash().(encoding.BinaryMarshaler); ok {
+		if hash, err := m.MarshalBinary(); err == nil {
+			w.state.Hash = hash
+		}
+	}
+	if err := w.writeState(); err != nil {
+		return err
+	}
+	w.checkpointed = w.size
+	return nil
+}
+
+// writeState replaces the state file of w.
+func (w *Ingestion) writeState() error {
+	buf, err := json.Marshal(w.state)
+	if err != nil {
+		return errors.Wrap(err, "write ingestion state")
+	}
+	f, err := ioutil.TempFile(w.dir, tempPattern)
+	if err != nil {
+		return errors.Wrap(err, "write ingestion state")
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write ingestion state")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "write ingestion state")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "write ingestion state")
+	}
+	return errors.Wrap(os.Rename(f.Name(), filepath.Join(w.dir, ingestStateFile)), "write ingestion state")
+}
+
+// readIngestState reads the state file of the ingestion in dir.
+func readIngestState(dir string) (ingestState, error) {
+	var state ingestState
+	buf, err := ioutil.ReadFile(filepath.Join(dir, ingestStateFile))
+	if err != nil {
+		return state, errors.Wrap(err, "read ingestion state")
+	}
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return state, errors.Wrap(err, "read ingestion state")
+	}
+	return state, nil
+}
+
+// Status describes the ingestion ref, whose offset is the size of its data file, which may be past
+// its last checkpoint. It fails with ErrNoIngestion if there is none.
+func (s *FileStore) Status(ctx context.Context, ref string) (Status, error) {
+	st, err := ingestStatus(s.ingestPath(ref))
+	if os.IsNotExist(errors.Cause(err)) {
+		return Status{}, errors.Wrapf(ErrNoIngestion, "%q", ref)
+	}
+	return st, err
+}
+
+// Ingestions describes the ingestions in progress, sorted by reference, see Status.
+func (s *FileStore) Ingestions(ctx context.Context) ([]Status, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.root, IngestDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "list ingestions")
+	}
+	var statuses []Status
+	for _, fi := range entries {
+		if !fi.IsDir() {
+			continue
+		}
+		st, err := ingestStatus(filepath.Join(s.root, IngestDir, fi.Name()))
+		if os.IsNotExist(errors.Cause(err)) {
+			// committed or aborted meanwhile, or not started yet
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Ref < statuses[j].Ref })
+	return statuses, nil
+}
+
+// Abort discards the ingestion ref. It fails with ErrNoIngestion if there is none.
+func (s *FileStore) Abort(ctx context.Context, ref string) error {
+	dir := s.ingestPath(ref)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return errors.Wrapf(ErrNoIngestion, "%q", ref)
+	}
+	return errors.Wrap(os.RemoveAll(dir), "remove ingestion")
+}
+
+// ingestStatus describes the ingestion in dir.
+func ingestStatus(dir string) (Status, error) {
+	state, err := readIngestState(dir)
+	if err != nil {
+		return Status{}, err
+	}
+	st := Status{Ref: state.Ref, Expected: state.Expected, StartedAt: state.StartedAt, UpdatedAt: state.StartedAt}
+	fi, err := os.Stat(filepath.Join(dir, ingestDataFile))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return Status{}, errors.Wrap(err, "stat ingestion")
+	}
+	st.Offset = fi.Size()
+	st.UpdatedAt = fi.ModTime().UTC()
+	return st, nil
+}
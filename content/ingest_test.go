@@ -0,0 +1,282 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package content
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// testBlob returns content of size n and its descriptor.
+func testBlob(n int) ([]byte, v1.Descriptor) {
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = byte(i * 7)
+	}
+	return buf, v1.Descriptor{MediaType: v1.MediaTypeImageLayer, Digest: digest.FromBytes(buf), Size: int64(n)}
+}
+
+// commitIngestion writes the rest of buf to w from its offset and commits it.
+func commitIngestion(t *testing.T, s *FileStore, w *Ingestion, buf []byte, desc v1.Descriptor) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := w.Write(buf[w.Size():]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(ctx, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadBlob(ctx, s, desc); err != nil || !bytes.Equal(got, buf) {
+		t.Errorf("expected the blob to be committed, got %v", err)
+	}
+	if _, err := s.Status(ctx, w.Status().Ref); errors.Cause(err) != ErrNoIngestion {
+		t.Errorf("expected the ingestion to be removed, got %v", err)
+	}
+}
+
+func TestIngest(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s := NewFileStore(root)
+	buf, desc := testBlob(1000)
+
+	// interrupted, then resumed
+	w, err := s.Ingest(ctx, "layer", desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(buf[:400]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := s.Ingestions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Ref != "layer" || statuses[0].Offset != 400 || statuses[0].Expected.Digest != desc.Digest {
+		t.Errorf("unexpected ingestions %+v", statuses)
+	}
+	if _, err := s.Ingest(ctx, "layer", v1.Descriptor{Digest: digest.FromString("other"), Size: 5}); errors.Cause(err) != ErrIngestionConflict {
+		t.Errorf("expected ErrIngestionConflict, got %v", err)
+	}
+	if w, err = s.Ingest(ctx, "layer", desc); err != nil {
+		t.Fatal(err)
+	}
+	if w.Size() != 400 {
+		t.Errorf("expected to resume at 400, got %d", w.Size())
+	}
+	commitIngestion(t, s, w, buf, desc)
+
+	for i, tt := range []struct {
+		// interrupt changes the ingestion directory of an interrupted ingestion of buf[:400]
+		interrupt func(dir string) error
+		offset    int64
+	}{
+		{
+			// data written after the last checkpoint is discarded
+			interrupt: func(dir string) error {
+				f, err := os.OpenFile(filepath.Join(dir, ingestDataFile), os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				_, err = f.Write(buf[400:500])
+				return err
+			},
+			offset: 400,
+		},
+		{
+			// without the state of the digester, the data is hashed again
+			interrupt: func(dir string) error {
+				state, err := readIngestState(dir)
+				if err != nil {
+					return err
+				}
+				state.Hash = nil
+				b, err := json.Marshal(state)
+				if err != nil {
+					return err
+				}
+				return ioutil.WriteFile(filepath.Join(dir, ingestStateFile), b, 0644)
+			},
+			offset: 400,
+		},
+		{
+			// data exceeding the blob is discarded
+			interrupt: func(dir string) error {
+				state, err := readIngestState(dir)
+				if err != nil {
+					return err
+				}
+				state.Hash = nil
+				b, err := json.Marshal(state)
+				if err != nil {
+					return err
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, ingestStateFile), b, 0644); err != nil {
+					return err
+				}
+				return ioutil.WriteFile(filepath.Join(dir, ingestDataFile), make([]byte, 2000), 0644)
+			},
+			offset: 0,
+		},
+	} {
+		if err := s.Delete(ctx, desc.Digest); err != nil {
+			t.Fatal(err)
+		}
+		w, err := s.Ingest(ctx, "layer", desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(buf[:400]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.interrupt(s.ingestPath("layer")); err != nil {
+			t.Fatal(err)
+		}
+		if w, err = s.Ingest(ctx, "layer", desc); err != nil {
+			t.Fatal(err)
+		}
+		if w.Size() != tt.offset {
+			t.Errorf("test %d: expected to resume at %d, got %d", i, tt.offset, w.Size())
+		}
+		commitIngestion(t, s, w, buf, desc)
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(root, IngestDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("ingestions were left in %s", root)
+	}
+}
+
+func TestIngestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(t.TempDir())
+	buf, desc := testBlob(checkpointInterval + 1000)
+
+	// a process killed without closing its ingestion resumes at the last checkpoint
+	w, err := s.Ingest(ctx, "layer", desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(buf[:checkpointInterval]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(buf[checkpointInterval : checkpointInterval+500]); err != nil {
+		t.Fatal(err)
+	}
+	if st := w.Status(); st.Offset != checkpointInterval+500 || st.Expected.Digest != desc.Digest {
+		t.Errorf("unexpected status %+v", st)
+	}
+	st, err := s.Status(ctx, "layer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Offset != checkpointInterval+500 {
+		t.Errorf("expected the size of the data as offset, got %d", st.Offset)
+	}
+
+	resumed, err := s.Ingest(ctx, "layer", desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.f.Close()
+	if resumed.Size() != checkpointInterval {
+		t.Errorf("expected to resume at %d, got %d", checkpointInterval, resumed.Size())
+	}
+	commitIngestion(t, s, resumed, buf, desc)
+}
+
+func TestIngestFailures(t *testing.T) {
+	ctx := context.Background()
+	s := NewFileStore(t.TempDir())
+	buf, desc := testBlob(100)
+
+	w, err := s.Ingest(ctx, "layer", desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(append(buf, 0)); errors.Cause(err) != ErrSizeMismatch {
+		t.Errorf("expected ErrSizeMismatch, got %v", err)
+	}
+	if err := w.Commit(ctx, -1, ""); errors.Cause(err) != ErrSizeMismatch {
+		t.Errorf("expected ErrSizeMismatch, got %v", err)
+	}
+
+	corrupt := append([]byte(nil), buf...)
+	corrupt[0] ^= 0xff
+	for i, tt := range []struct {
+		content  []byte
+		size     int64
+		expected digest.Digest
+		cause    error
+	}{
+		{content: corrupt, size: -1, cause: ErrDigestMismatch},
+		{content: buf, size: 99, cause: ErrSizeMismatch},
+		{content: buf, size: -1, expected: digest.FromString("other"), cause: ErrDigestMismatch},
+	} {
+		w, err := s.Ingest(ctx, "layer", desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(tt.content); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Commit(ctx, tt.size, tt.expected); errors.Cause(err) != tt.cause {
+			t.Errorf("test %d: expected %v, got %v", i, tt.cause, err)
+		}
+		if _, err := s.Info(ctx, desc.Digest); errors.Cause(err) != ErrNotFound {
+			t.Errorf("test %d: the blob was committed", i)
+		}
+		// a failed ingestion is removed, since it cannot succeed
+		if _, err := s.Status(ctx, "layer"); errors.Cause(err) != ErrNoIngestion {
+			t.Errorf("test %d: expected ErrNoIngestion, got %v", i, err)
+		}
+	}
+
+	w, err = s.Ingest(ctx, "layer", desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Abort(ctx, "layer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Abort(ctx, "layer"); errors.Cause(err) != ErrNoIngestion {
+		t.Errorf("expected ErrNoIngestion, got %v", err)
+	}
+	if _, err := s.Ingest(ctx, "", desc); err == nil {
+		t.Error("expected an empty reference to fail")
+	}
+}
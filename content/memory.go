@@ -0,0 +1,158 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package content
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// A MemoryStore is a Store keeping the blobs in memory, e.g. for tests.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[digest.Digest]memoryBlob
+}
+
+type memoryBlob struct {
+	content   []byte
+	updatedAt time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: map[digest.Digest]memoryBlob{}}
+}
+
+// Fetch implements Provider.
+func (s *MemoryStore) Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	s.mu.RLock()
+	blob, ok := s.blobs[desc.Digest]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "%s", desc.Digest)
+	}
+	if int64(len(blob.content)) != desc.Size {
+		return nil, errors.Wrapf(ErrSizeMismatch, "blob %s has size %d, expected %d", desc.Digest, len(blob.content), desc.Size)
+	}
+	return newVerifyingReader(ioutil.NopCloser(bytes.NewReader(blob.content)), desc), nil
+}
+
+// Writer implements Ingester.
+func (s *MemoryStore) Writer(ctx context.Context, algorithm digest.Algorithm) (Writer, error) {
+	algorithm, err := writerAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryWriter{s: s, digester: algorithm.Digester()}, nil
+}
+
+// Info implements Manager.
+func (s *MemoryStore) Info(ctx context.Context, dgst digest.Digest) (Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blob, ok := s.blobs[dgst]
+	if !ok {
+		return Info{}, errors.Wrapf(ErrNotFound, "%s", dgst)
+	}
+	return Info{Digest: dgst, Size: int64(len(blob.content)), UpdatedAt: blob.updatedAt}, nil
+}
+
+// Delete implements Manager.
+func (s *MemoryStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.blobs[dgst]; !ok {
+		return errors.Wrapf(ErrNotFound, "%s", dgst)
+	}
+	delete(s.blobs, dgst)
+	return nil
+}
+
+// Walk implements Manager.
+func (s *MemoryStore) Walk(ctx context.Context, fn func(Info) error) error {
+	s.mu.RLock()
+	infos := make([]Info, 0, len(s.blobs))
+	for dgst, blob := range s.blobs {
+		infos = append(infos, Info{Digest: dgst, Size: int64(len(blob.content)), UpdatedAt: blob.updatedAt})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Digest < infos[j].Digest })
+	for _, info := range infos {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryWriter struct {
+	s        *MemoryStore
+	buf      bytes.Buffer
+	digester digest.Digester
+	done     bool
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.New("blob writer is closed")
+	}
+	w.digester.Hash().Write(p)
+	return w.buf.Write(p)
+}
+
+func (w *memoryWriter) Digest() digest.Digest {
+	return w.digester.Digest()
+}
+
+func (w *memoryWriter) Size() int64 {
+	return int64(w.buf.Len())
+}
+
+func (w *memoryWriter) Commit(ctx context.Context, size int64, expected digest.Digest) error {
+	if w.done {
+		return errors.New("blob writer is closed")
+	}
+	dgst := w.Digest()
+	if err := checkCommit(w.Size(), dgst, size, expected); err != nil {
+		return err
+	}
+
+	w.s.mu.Lock()
+	w.s.blobs[dgst] = memoryBlob{content: w.buf.Bytes(), updatedAt: time.Now()}
+	w.s.mu.Unlock()
+	w.done = true
+	return nil
+}
+
+func (w *memoryWriter) Close() error {
+	w.done = true
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command standalone uses the content package without importing any hash function itself,
+// so that it fails if the package does not install the implementations go-digest needs.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "standalone")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(root)
+
+	s := content.NewFileStore(root)
+	for _, alg := range []digest.Algorithm{digest.SHA256, digest.SHA512} {
+		w, err := s.Writer(ctx, alg)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(alg.String())); err != nil {
+			return err
+		}
+		if err := w.Commit(ctx, -1, ""); err != nil {
+			return err
+		}
+		w.Close()
+	}
+	if _, err := content.WriteBlobBytes(ctx, s, v1.MediaTypeImageConfig, []byte("{}")); err != nil {
+		return err
+	}
+
+	var n int
+	if err := s.Walk(ctx, func(content.Info) error {
+		n++
+		return nil
+	}); err != nil {
+		return err
+	}
+	if n != 3 {
+		return fmt.Errorf("expected 3 blobs, walked %d", n)
+	}
+
+	blob := []byte("ingested")
+	desc := v1.Descriptor{MediaType: v1.MediaTypeImageLayer, Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+	w, err := s.Ingest(ctx, "ingested", desc)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(blob[:4]); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if w, err = s.Ingest(ctx, "ingested", desc); err != nil {
+		return err
+	}
+	if _, err := w.Write(blob[w.Size():]); err != nil {
+		return err
+	}
+	return w.Commit(ctx, -1, "")
+}
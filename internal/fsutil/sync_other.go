@@ -0,0 +1,27 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !unix
+
+// Package fsutil holds the filesystem helpers shared by the content and layout packages.
+package fsutil
+
+import "os"
+
+// SyncDir checks that the directory dir exists. Directories cannot be synced on these platforms,
+// e.g. windows, where renames are durable anyway.
+func SyncDir(dir string) error {
+	_, err := os.Stat(dir)
+	return err
+}
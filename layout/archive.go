@@ -0,0 +1,349 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/platform"
+	"github.com/opencontainers/image-spec/resolve"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// maxArchiveDocumentSize bounds the size of the oci-layout and index.json files of an imported archive.
+const maxArchiveDocumentSize = 16 << 20
+
+// archiveBlobRegexp matches the names of the blobs in an archive, with the <alg> and <encoded> parts of their digest.
+var archiveBlobRegexp = regexp.MustCompile(`^` + BlobsDir + `/([a-z0-9]+(?:[+._-][a-z0-9]+)*)/([a-zA-Z0-9=_-]+)$`)
+
+// ExportOptions selects the content of an exported image layout.
+type ExportOptions struct {
+	// RefNames, if not empty, restricts the exported descriptors of index.json to those whose
+	// org.opencontainers.image.ref.name annotation is one of RefNames.
+	RefNames []string
+
+	// Platform, if not nil, replaces each exported descriptor by the image manifest it resolves to
+	// for Platform, see resolve.Resolver, and drops the descriptors resolving to none.
+	Platform platform.Matcher
+}
+
+// Export writes the image layout, or the part selected by opts, to w as a tar archive.
+//
+// The archive holds the oci-layout file, index.json and the blobs reachable from it, in that order,
+// the blobs sorted by path, with fixed ownership, permissions and times,
+// so that exporting the same content always yields the same archive.
+// Unless opts selects a part of the layout, index.json is exported unchanged.
+func (l *Layout) Export(ctx context.Context, w io.Writer, opts ExportOptions) error {
+	indexBuf, err := l.exportIndex(ctx, opts)
+	if err != nil {
+		return err
+	}
+	var index v1.Index
+	if err := json.Unmarshal(indexBuf, &index); err != nil {
+		return errors.Wrapf(err, "invalid %s", IndexFile)
+	}
+
+	m := newMarker(l)
+	if err := m.mark(ctx, index.Manifests...); err != nil {
+		return err
+	}
+	if missing := m.missingDigests(); len(missing) > 0 {
+		return errors.Wrapf(ErrBlobNotFound, "%s", missing[0])
+	}
+
+	header, err := json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeArchiveFile(tw, v1.ImageLayoutFile, bytes.NewReader(header), int64(len(header))); err != nil {
+		return err
+	}
+	if err := writeArchiveFile(tw, IndexFile, bytes.NewReader(indexBuf), int64(len(indexBuf))); err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(m.marked))
+	byPath := make(map[string]digest.Digest, len(m.marked))
+	for dgst := range m.marked {
+		p := path.Join(BlobsDir, dgst.Algorithm().String(), dgst.Encoded())
+		paths = append(paths, p)
+		byPath[p] = dgst
+	}
+	sort.Strings(paths)
+
+	dirs := map[string]bool{}
+	if err := writeArchiveDir(tw, BlobsDir); err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if dir := path.Dir(p); !dirs[dir] {
+			if err := writeArchiveDir(tw, dir); err != nil {
+				return err
+			}
+			dirs[dir] = true
+		}
+		if err := l.exportBlob(tw, p, byPath[p]); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(tw.Close(), "write archive")
+}
+
+// exportIndex returns the index.json of the exported image layout.
+func (l *Layout) exportIndex(ctx context.Context, opts ExportOptions) ([]byte, error) {
+	if len(opts.RefNames) == 0 && opts.Platform == nil {
+		buf, err := ioutil.ReadFile(filepath.Join(l.root, IndexFile))
+		return buf, errors.Wrap(err, "read image index")
+	}
+
+	index, err := l.Index()
+	if err != nil {
+		return nil, err
+	}
+	var manifests []v1.Descriptor
+	for _, desc := range index.Manifests {
+		if len(opts.RefNames) > 0 && !containsString(opts.RefNames, desc.Annotations[v1.AnnotationRefName]) {
+			continue
+		}
+		if opts.Platform != nil {
+			r := &resolve.Resolver{Matcher: opts.Platform, Fetcher: l}
+			result, err := r.Resolve(ctx, v1.Index{Manifests: []v1.Descriptor{desc}})
+			if errors.Cause(err) == resolve.ErrNoMatch {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			resolved := result.Descriptor
+			if len(desc.Annotations) > 0 {
+				annotations := make(map[string]string, len(resolved.Annotations)+len(desc.Annotations))
+				for k, v := range resolved.Annotations {
+					annotations[k] = v
+				}
+				for k, v := range desc.Annotations {
+					annotations[k] = v
+				}
+				resolved.Annotations = annotations
+			}
+			desc = resolved
+		}
+		manifests = append(manifests, desc)
+	}
+	if manifests == nil {
+		manifests = []v1.Descriptor{}
+	}
+
+	buf, err := json.Marshal(v1.Index{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   v1.MediaTypeImageIndex,
+		Manifests:   manifests,
+		Annotations: index.Annotations,
+	})
+	return buf, errors.Wrap(err, "encode image index")
+}
+
+// exportBlob writes the blob dgst to tw as the file p.
+func (l *Layout) exportBlob(tw *tar.Writer, p string, dgst digest.Digest) error {
+	blobPath, err := l.blobPath(dgst)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(blobPath)
+	if err != nil {
+		return errors.Wrap(err, "read blob")
+	}
+	// the size is the one of the file, ReadBlob verifies the digest
+	rc, err := l.ReadBlob(v1.Descriptor{Digest: dgst, Size: fi.Size()})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return writeArchiveFile(tw, p, rc, fi.Size())
+}
+
+func writeArchiveDir(tw *tar.Writer, name string) error {
+	return errors.Wrap(tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  time.Unix(0, 0),
+	}), "write archive")
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, r io.Reader, size int64) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Unix(0, 0),
+	})
+	if err != nil {
+		return errors.Wrap(err, "write archive")
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return errors.Wrapf(err, "write %s", name)
+	}
+	return nil
+}
+
+// Import reads an image layout from the tar archive r, as written by Export, into l.
+//
+// Every blob is verified against the digest of its name before it is added to l,
+// the oci-layout file and index.json are validated, and the blobs reachable from
+// index.json must be in the archive or already in l.
+// The blobs are imported in a transaction of l, so that they are only added to l, under its lock,
+// along with the descriptors of index.json, and none is added if Import fails.
+// The descriptors of the imported index.json are then added to the one of l, each replacing
+// the descriptor of its org.opencontainers.image.ref.name annotation for its platform, see Tag,
+// and Import fails with ErrInvalidRefName if a ref name does not match the grammar of annotations.md.
+// It returns the imported image index.
+func (l *Layout) Import(ctx context.Context, r io.Reader) (v1.Index, error) {
+	var index v1.Index
+	var header, indexBuf []byte
+
+	tx, err := l.Begin()
+	if err != nil {
+		return index, err
+	}
+	defer tx.Rollback()
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return index, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return index, errors.Wrap(err, "read archive")
+		}
+
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		switch {
+		case hdr.Typeflag == tar.TypeDir:
+			continue
+		case !hdr.FileInfo().Mode().IsRegular():
+			return index, errors.Errorf("archive entry %s is not a regular file", hdr.Name)
+		case name == v1.ImageLayoutFile:
+			header, err = readArchiveDocument(tr, hdr)
+		case name == IndexFile:
+			indexBuf, err = readArchiveDocument(tr, hdr)
+		default:
+			m := archiveBlobRegexp.FindStringSubmatch(name)
+			if m == nil {
+				// not part of the image layout
+				continue
+			}
+			desc := v1.Descriptor{
+				Digest: digest.NewDigestFromEncoded(digest.Algorithm(m[1]), m[2]),
+				Size:   hdr.Size,
+			}
+			err = content.WriteBlob(ctx, tx, tr, desc)
+		}
+		if err != nil {
+			return index, errors.Wrapf(err, "archive entry %s", hdr.Name)
+		}
+	}
+
+	if header == nil {
+		return index, errors.Wrapf(ErrNotLayout, "archive has no %s", v1.ImageLayoutFile)
+	}
+	if err := schema.ValidatorMediaTypeLayoutHeader.Validate(bytes.NewReader(header)); err != nil {
+		return index, errors.Wrapf(err, "archive entry %s", v1.ImageLayoutFile)
+	}
+	var layoutHeader v1.ImageLayout
+	if err := json.Unmarshal(header, &layoutHeader); err != nil {
+		return index, errors.Wrapf(err, "archive entry %s", v1.ImageLayoutFile)
+	}
+	if layoutHeader.Version != v1.ImageLayoutVersion {
+		return index, errors.Wrapf(ErrUnsupportedVersion, "%q", layoutHeader.Version)
+	}
+
+	if indexBuf == nil {
+		return index, errors.Errorf("archive has no %s", IndexFile)
+	}
+	if err := schema.ValidatorMediaTypeImageIndex.Validate(bytes.NewReader(indexBuf)); err != nil {
+		return index, errors.Wrapf(err, "archive entry %s", IndexFile)
+	}
+	if err := json.Unmarshal(indexBuf, &index); err != nil {
+		return index, errors.Wrapf(err, "archive entry %s", IndexFile)
+	}
+	if err := validateRefNames(index.Manifests); err != nil {
+		return index, errors.Wrapf(err, "archive entry %s", IndexFile)
+	}
+
+	tx.UpdateIndex(func(current *v1.Index) error {
+		// under the lock, so that a concurrent GC cannot remove the blobs of the layout found
+		m := tx.newMarker()
+		if err := m.mark(ctx, index.Manifests...); err != nil {
+			return err
+		}
+		if missing := m.missingDigests(); len(missing) > 0 {
+			return errors.Wrapf(ErrBlobNotFound, "%s is neither in the archive nor in the image layout", missing[0])
+		}
+		current.Manifests = mergeDescriptors(current.Manifests, index.Manifests)
+		return nil
+	})
+	return index, tx.Commit(ctx)
+}
+
+// readArchiveDocument reads the JSON document of the archive entry hdr.
+func readArchiveDocument(tr *tar.Reader, hdr *tar.Header) ([]byte, error) {
+	if hdr.Size > maxArchiveDocumentSize {
+		return nil, errors.Errorf("size %d exceeds %d", hdr.Size, maxArchiveDocumentSize)
+	}
+	return ioutil.ReadAll(tr)
+}
+
+// sameDescriptor reports whether a and b are the same descriptor.
+func sameDescriptor(a, b v1.Descriptor) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,338 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/platform"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// writeMultiPlatformImage writes an image index of an amd64 and an arm64 image to l, tagged with refName.
+func writeMultiPlatformImage(t *testing.T, l *Layout, refName string) (index, amd64, arm64 v1.Descriptor) {
+	t.Helper()
+
+	amd64 = writeImage(t, l, refName+" amd64")
+	amd64.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 = writeImage(t, l, refName+" arm64")
+	arm64.Platform = &v1.Platform{OS: "linux", Architecture: "arm64"}
+	buf, err := json.Marshal(v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{amd64, arm64},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err = l.WriteBlobBytes(v1.MediaTypeImageIndex, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Annotations = map[string]string{v1.AnnotationRefName: refName}
+	if err := l.UpdateIndex(func(i *v1.Index) error {
+		i.Manifests = append(i.Manifests, index)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return index, amd64, arm64
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1Index, _, _ := writeMultiPlatformImage(t, src, "v1")
+	_, v2amd64, v2arm64 := writeMultiPlatformImage(t, src, "v2")
+
+	var archive, again bytes.Buffer
+	if err := src.Export(ctx, &archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Export(ctx, &again, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(archive.Bytes(), again.Bytes()) {
+		t.Errorf("expected exports of the same content to be identical")
+	}
+
+	dst, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := dst.Import(ctx, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Manifests) != 2 || imported.Manifests[0].Digest != v1Index.Digest {
+		t.Errorf("unexpected imported index %v", imported)
+	}
+	if _, err := schema.ValidateLayoutDir(dst.Root(), schema.Options{}); err != nil {
+		t.Errorf("expected a valid image layout, got %v", err)
+	}
+
+	// export v2 for arm64 only, and import it over v2 of another layout:
+	// the image index of v2 has no platform, so it is kept
+	archive.Reset()
+	opts := ExportOptions{
+		RefNames: []string{"v2"},
+		Platform: platform.NewMatcher(v1.Platform{OS: "linux", Architecture: "arm64"}),
+	}
+	if err := src.Export(ctx, &archive, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.Import(ctx, &archive); err != nil {
+		t.Fatal(err)
+	}
+	index, err := dst.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 3 || index.Manifests[2].Digest != v2arm64.Digest ||
+		index.Manifests[2].Annotations[v1.AnnotationRefName] != "v2" {
+		t.Errorf("expected v2 to name its arm64 manifest too, got %v", index.Manifests)
+	}
+
+	// importing it again replaces the arm64 tag only
+	archive.Reset()
+	if err := src.Export(ctx, &archive, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.Import(ctx, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := dst.Index(); err != nil || len(again.Manifests) != 3 {
+		t.Errorf("expected the arm64 tag of v2 to be replaced, got %v, %v", again.Manifests, err)
+	}
+
+	// the subset holds the blobs of the arm64 image only
+	subset, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.Reset()
+	if err := src.Export(ctx, &archive, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := subset.Import(ctx, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := subset.HasBlob(v2amd64.Digest); ok {
+		t.Errorf("expected the amd64 manifest not to be exported")
+	}
+	if ok, _ := subset.HasBlob(v2arm64.Digest); !ok {
+		t.Errorf("expected the arm64 manifest to be exported")
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := writeImage(t, src, "layer")
+	if err := src.UpdateIndex(func(i *v1.Index) error {
+		i.Manifests = append(i.Manifests, desc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := src.Export(ctx, &archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewrite rewrites the entries of the archive with edit, dropping those for which it returns nil.
+	rewrite := func(edit func(hdr *tar.Header, content []byte) []byte) io.Reader {
+		var out bytes.Buffer
+		tr := tar.NewReader(bytes.NewReader(archive.Bytes()))
+		tw := tar.NewWriter(&out)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content = edit(hdr, content)
+			if content == nil {
+				continue
+			}
+			hdr.Size = int64(len(content))
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return &out
+	}
+
+	manifest, err := BlobPath(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range []struct {
+		edit  func(hdr *tar.Header, content []byte) []byte
+		cause error
+	}{
+		{
+			// a corrupted manifest
+			edit: func(hdr *tar.Header, content []byte) []byte {
+				if hdr.Name == manifest {
+					return append(content, ' ')
+				}
+				return content
+			},
+			cause: ErrDigestMismatch,
+		},
+		{
+			edit: func(hdr *tar.Header, content []byte) []byte {
+				if hdr.Name == v1.ImageLayoutFile {
+					return nil
+				}
+				return content
+			},
+			cause: ErrNotLayout,
+		},
+		{
+			edit: func(hdr *tar.Header, content []byte) []byte {
+				if hdr.Name == manifest {
+					return nil
+				}
+				return content
+			},
+			cause: ErrBlobNotFound,
+		},
+		{
+			edit: func(hdr *tar.Header, content []byte) []byte {
+				if hdr.Name == IndexFile {
+					return []byte(`{"schemaVersion": 2}`)
+				}
+				return content
+			},
+		},
+		{
+			edit: func(hdr *tar.Header, content []byte) []byte {
+				if hdr.Name == IndexFile {
+					var index v1.Index
+					if err := json.Unmarshal(content, &index); err != nil {
+						t.Fatal(err)
+					}
+					index.Manifests[0].Annotations = map[string]string{v1.AnnotationRefName: "-v1"}
+					if content, err = json.Marshal(index); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return content
+			},
+			cause: ErrInvalidRefName,
+		},
+	} {
+		dst, err := Init(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = dst.Import(ctx, rewrite(tt.edit))
+		if err == nil || (tt.cause != nil && errors.Cause(err) != tt.cause) {
+			t.Errorf("test %d: expected %v, got %v", i, tt.cause, err)
+		}
+		if index, err := dst.Index(); err != nil || len(index.Manifests) != 0 {
+			t.Errorf("test %d: expected index.json to be unchanged, got %v, %v", i, index, err)
+		}
+		// the blobs of the archive are only added along with index.json
+		if err := dst.blobs.Walk(ctx, func(info content.Info) error {
+			return errors.Errorf("unexpected blob %s", info.Digest)
+		}); err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+	}
+}
+
+func TestImportReportsFirstMissingBlob(t *testing.T) {
+	ctx := context.Background()
+	var missing []v1.Descriptor
+	for _, s := range []string{"a", "b", "c", "d"} {
+		content := []byte(s)
+		missing = append(missing, v1.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    digest.FromBytes(content),
+			Size:      int64(len(content)),
+		})
+	}
+	first := missing[0].Digest
+	for _, desc := range missing {
+		if desc.Digest < first {
+			first = desc.Digest
+		}
+	}
+	index, err := json.Marshal(v1.Index{Versioned: specs.Versioned{SchemaVersion: 2}, Manifests: missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{{v1.ImageLayoutFile, header}, {IndexFile, index}} {
+		if err := writeArchiveFile(tw, f.name, bytes.NewReader(f.content), int64(len(f.content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the error names the same blob whatever the order of the missing blobs in the marker
+	for i := 0; i < 10; i++ {
+		dst, err := Init(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = dst.Import(ctx, bytes.NewReader(archive.Bytes()))
+		if errors.Cause(err) != ErrBlobNotFound || !strings.Contains(err.Error(), first.String()) {
+			t.Fatalf("expected %s to be reported missing, got %v", first, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBlobNotFound is returned for a blob which is not in the image layout.
+	ErrBlobNotFound = content.ErrNotFound
+
+	// ErrDigestMismatch is returned for content which does not match its expected digest.
+	ErrDigestMismatch = content.ErrDigestMismatch
+
+	// ErrSizeMismatch is returned for content which does not have its expected size.
+	ErrSizeMismatch = content.ErrSizeMismatch
+)
+
+// BlobPath returns the path of the blob dgst, relative to the root of the image layout.
+func BlobPath(dgst digest.Digest) (string, error) {
+	return content.BlobPath(dgst)
+}
+
+// blobPath returns the path of the blob dgst.
+func (l *Layout) blobPath(dgst digest.Digest) (string, error) {
+	p, err := BlobPath(dgst)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, p), nil
+}
+
+// Store returns the blobs of the image layout as a content.Store.
+func (l *Layout) Store() content.Store {
+	return l.blobs
+}
+
+// HasBlob reports whether the blob dgst is in the image layout.
+func (l *Layout) HasBlob(dgst digest.Digest) (bool, error) {
+	_, err := l.blobs.Info(context.Background(), dgst)
+	if errors.Cause(err) == content.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReadBlob opens the blob desc points to.
+// Reading it fails with ErrSizeMismatch or ErrDigestMismatch at the end of the blob
+// if it does not match desc.
+func (l *Layout) ReadBlob(desc v1.Descriptor) (io.ReadCloser, error) {
+	return l.blobs.Fetch(context.Background(), desc)
+}
+
+// Fetch opens the blob desc points to, see ReadBlob.
+// It lets a Layout serve as the resolve.Fetcher of nested indexes.
+func (l *Layout) Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	return l.blobs.Fetch(ctx, desc)
+}
+
+// ReadBlobBytes returns the content of the blob desc points to, verified against desc.
+func (l *Layout) ReadBlobBytes(desc v1.Descriptor) ([]byte, error) {
+	return content.ReadBlob(context.Background(), l.blobs, desc)
+}
+
+// WriteBlob writes the blob desc points to with the content of r, see BlobWriter.
+func (l *Layout) WriteBlob(r io.Reader, desc v1.Descriptor) error {
+	return content.WriteBlob(context.Background(), l.blobs, r, desc)
+}
+
+// WriteBlobBytes writes a blob holding buf and returns its descriptor, with the media type mediaType.
+func (l *Layout) WriteBlobBytes(mediaType string, buf []byte) (v1.Descriptor, error) {
+	return content.WriteBlobBytes(context.Background(), l.blobs, mediaType, buf)
+}
+
+// A BlobWriter writes a blob to a temporary file of the image layout,
+// which Commit moves to its place once its digest is verified,
+// so that the blobs of the layout are always complete.
+type BlobWriter struct {
+	w content.Writer
+}
+
+// NewBlobWriter returns a BlobWriter computing the digest of the blob with algorithm,
+// digest.Canonical if empty. The caller must Close it.
+func (l *Layout) NewBlobWriter(algorithm digest.Algorithm) (*BlobWriter, error) {
+	w, err := l.blobs.Writer(context.Background(), algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobWriter{w: w}, nil
+}
+
+func (w *BlobWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+// Size returns the number of bytes written.
+func (w *BlobWriter) Size() int64 {
+	return w.w.Size()
+}
+
+// Digest returns the digest of the bytes written.
+func (w *BlobWriter) Digest() digest.Digest {
+	return w.w.Digest()
+}
+
+// Commit moves the blob to its place in the image layout and returns its digest.
+// It fails with ErrSizeMismatch if size is not negative and is not the size of the blob,
+// and with ErrDigestMismatch if expected is not empty and is not the digest of the blob.
+func (w *BlobWriter) Commit(size int64, expected digest.Digest) (digest.Digest, error) {
+	if err := w.w.Commit(context.Background(), size, expected); err != nil {
+		return "", err
+	}
+	return w.w.Digest(), nil
+}
+
+// Close discards the blob unless it was committed.
+func (w *BlobWriter) Close() error {
+	return w.w.Close()
+}
+
+// Ingest starts or resumes writing the blob expected points to under the reference ref,
+// in the ingestion directory of the image layout, see content.FileStore.Ingest.
+// Committing the Ingestion verifies the blob against expected and moves it to the blobs directory.
+func (l *Layout) Ingest(ctx context.Context, ref string, expected v1.Descriptor) (*content.Ingestion, error) {
+	return l.blobs.Ingest(ctx, ref, expected)
+}
+
+// Ingestions describes the ingestions in progress in the image layout, sorted by reference.
+func (l *Layout) Ingestions(ctx context.Context) ([]content.Status, error) {
+	return l.blobs.Ingestions(ctx)
+}
+
+// AbortIngestion discards the ingestion ref. It fails with content.ErrNoIngestion if there is none.
+func (l *Layout) AbortIngestion(ctx context.Context, ref string) error {
+	return l.blobs.Abort(ctx, ref)
+}
@@ -0,0 +1,433 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/platform"
+	"github.com/opencontainers/image-spec/resolve"
+	"github.com/opencontainers/image-spec/schema"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/image-spec/walk"
+	"github.com/pkg/errors"
+)
+
+// LinkMode selects how Copy writes the blobs to the destination.
+type LinkMode int
+
+const (
+	// CopyContent copies the content of the blobs.
+	CopyContent LinkMode = iota
+
+	// HardLink hard links the blobs of the destination to those of the source,
+	// which then share their files, or copies them where the filesystems do not allow it.
+	HardLink
+
+	// Reflink clones the blobs of the source, sharing their storage until either is modified,
+	// or copies them where the filesystems do not allow it.
+	Reflink
+)
+
+// CopyOptions controls Copy.
+type CopyOptions struct {
+	// RefName is the ref name of the copy in the destination, the ref name of the source if empty.
+	RefName string
+
+	// Platforms, if not empty, restricts the image indexes copied to their manifests matching one of Platforms.
+	// Nested indexes are filtered as well, and the filtered indexes are written to the destination.
+	// Manifests without platform are kept.
+	Platforms []platform.Matcher
+
+	// Link selects how the blobs are written to the destination.
+	Link LinkMode
+
+	// Concurrency is the maximum number of blobs copied at once, walk.DefaultConcurrency if not positive.
+	Concurrency int
+}
+
+// CopyResult is the outcome of a Copy.
+type CopyResult struct {
+	// Descriptor is the first of Descriptors.
+	Descriptor v1.Descriptor
+
+	// Descriptors are the descriptors of the copy in the index.json of the destination,
+	// one per image of the ref name in the source, in the order of its index.json.
+	Descriptors []v1.Descriptor
+
+	// Copied lists the blobs whose content was copied to the destination, sorted by digest.
+	Copied []BlobInfo
+
+	// Linked lists the blobs linked to the source, see LinkMode, sorted by digest.
+	Linked []BlobInfo
+
+	// Existing lists the blobs which were already in the destination, sorted by digest.
+	Existing []BlobInfo
+}
+
+// Copy copies the images named ref in the index.json of src, one per platform, and the blobs
+// reachable from them, to dst, then adds them to the index.json of dst, each replacing the image
+// of the same ref name for its platform if any, as MoveTag does.
+// With opts.Platforms, the images whose descriptor has a platform matching none of them are not copied.
+// The blobs already in dst are not copied again, and the content of the blobs copied is verified
+// against their digests.
+// The blobs are copied in a transaction of dst, so that they are only added to dst, under its lock,
+// along with the image, and a concurrent GC of dst cannot remove them before the image references them.
+// Copy fails with ErrInvalidRefName if the ref name of the copy does not match the grammar of annotations.md,
+// with ErrRefNotFound if src has no image named ref,
+// and with resolve.ErrNoMatch if no image or an image index has no manifest matching opts.Platforms.
+func Copy(ctx context.Context, dst, src *Layout, ref string, opts CopyOptions) (CopyResult, error) {
+	var result CopyResult
+
+	refName := opts.RefName
+	if refName == "" {
+		refName = ref
+	}
+	if !schema.ValidRefName(refName) {
+		return result, errors.Wrapf(ErrInvalidRefName, "%q", refName)
+	}
+
+	index, err := src.Index()
+	if err != nil {
+		return result, err
+	}
+	// a ref name may name one image per platform, see MoveTag
+	var roots []v1.Descriptor
+	for _, desc := range index.Manifests {
+		if name, ok := desc.Annotations[v1.AnnotationRefName]; ok && name == ref {
+			roots = append(roots, desc)
+		}
+	}
+	if len(roots) == 0 {
+		return result, errors.Wrapf(ErrRefNotFound, "%s", ref)
+	}
+
+	tx, err := dst.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	c := &copier{
+		dst:       dst,
+		src:       src,
+		tx:        tx,
+		link:      opts.Link,
+		platforms: opts.Platforms,
+		filtered:  content.NewMemoryStore(),
+	}
+	descs := make([]v1.Descriptor, 0, len(roots))
+	for _, root := range roots {
+		desc := root
+		if len(opts.Platforms) > 0 {
+			if desc.Platform != nil && !c.matchPlatform(*desc.Platform) {
+				continue
+			}
+			if desc, err = c.filter(ctx, desc); err != nil {
+				return result, err
+			}
+		}
+		desc.Annotations = make(map[string]string, len(root.Annotations))
+		for k, v := range root.Annotations {
+			desc.Annotations[k] = v
+		}
+		desc.Annotations[v1.AnnotationRefName] = refName
+		descs = append(descs, desc)
+	}
+	if len(descs) == 0 {
+		return result, errors.Wrapf(resolve.ErrNoMatch, "%s", ref)
+	}
+
+	w := walk.Walker{
+		Handler: walk.Handlers(
+			walk.HandlerFunc(c.copyBlob),
+			walk.Children(providers{c.filtered, src.blobs}),
+		),
+		Concurrency: opts.Concurrency,
+	}
+	if err := w.Walk(ctx, descs...); err != nil {
+		return result, err
+	}
+
+	tx.UpdateIndex(func(index *v1.Index) error {
+		// the blobs of dst the copy relies on may have been collected since they were found
+		for _, blob := range c.existing {
+			info, err := dst.blobs.Info(ctx, blob.Digest)
+			if err != nil {
+				return err
+			}
+			if info.Size != blob.Size {
+				return errors.Wrapf(ErrSizeMismatch, "blob %s has size %d, expected %d", blob.Digest, info.Size, blob.Size)
+			}
+		}
+		index.Manifests = mergeDescriptors(index.Manifests, descs)
+		return nil
+	})
+	if err := tx.Commit(ctx); err != nil {
+		return result, err
+	}
+
+	result.Descriptor = descs[0]
+	result.Descriptors = descs
+	result.Copied = sortBlobs(c.copied)
+	result.Linked = sortBlobs(c.linked)
+	result.Existing = sortBlobs(c.existing)
+	return result, nil
+}
+
+// copier copies blobs from src to the transaction tx of dst.
+type copier struct {
+	dst       *Layout
+	src       *Layout
+	tx        *Transaction
+	link      LinkMode
+	platforms []platform.Matcher
+
+	// filtered holds the image indexes filtered for platforms.
+	filtered *content.MemoryStore
+
+	// mu guards the following fields, updated by concurrent handlers.
+	mu       sync.Mutex
+	copied   []BlobInfo
+	linked   []BlobInfo
+	existing []BlobInfo
+}
+
+// filter returns the descriptor of the image index desc points to, without its manifests
+// matching none of c.platforms, or desc itself if it is not an image index or keeps all its manifests.
+// The filtered indexes are written to c.filtered.
+func (c *copier) filter(ctx context.Context, desc v1.Descriptor) (v1.Descriptor, error) {
+	if desc.MediaType != v1.MediaTypeImageIndex {
+		return desc, nil
+	}
+	buf, err := c.src.ReadBlobBytes(desc)
+	if err != nil {
+		return desc, errors.Wrap(err, "read image index")
+	}
+	var index v1.Index
+	if err := json.Unmarshal(buf, &index); err != nil {
+		return desc, errors.Wrapf(err, "image index %s", desc.Digest)
+	}
+
+	manifests := make([]v1.Descriptor, 0, len(index.Manifests))
+	changed := false
+	for _, m := range index.Manifests {
+		if m.MediaType == v1.MediaTypeImageIndex {
+			filtered, err := c.filter(ctx, m)
+			if errors.Cause(err) == resolve.ErrNoMatch {
+				changed = true
+				continue
+			}
+			if err != nil {
+				return desc, err
+			}
+			changed = changed || filtered.Digest != m.Digest
+			m = filtered
+		} else if m.Platform != nil && !c.matchPlatform(*m.Platform) {
+			changed = true
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+	if len(manifests) == 0 {
+		return desc, errors.Wrapf(resolve.ErrNoMatch, "image index %s", desc.Digest)
+	}
+	if !changed {
+		return desc, nil
+	}
+
+	index.Manifests = manifests
+	if buf, err = json.Marshal(index); err != nil {
+		return desc, errors.Wrap(err, "encode image index")
+	}
+	filtered, err := content.WriteBlobBytes(ctx, c.filtered, desc.MediaType, buf)
+	if err != nil {
+		return desc, err
+	}
+	filtered.Annotations = desc.Annotations
+	filtered.Platform = desc.Platform
+	return filtered, nil
+}
+
+// matchPlatform reports whether p matches one of c.platforms.
+func (c *copier) matchPlatform(p v1.Platform) bool {
+	for _, m := range c.platforms {
+		if m.Match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyBlob stages the blob desc points to in c.tx, unless it is in c.dst already.
+func (c *copier) copyBlob(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+	blob := BlobInfo{Digest: desc.Digest, Size: desc.Size}
+
+	// a blob of the destination with another size is corrupt, and is replaced
+	if info, err := c.dst.blobs.Info(ctx, desc.Digest); err == nil && info.Size == desc.Size {
+		c.record(&c.existing, blob)
+		return nil, nil
+	} else if err != nil && errors.Cause(err) != ErrBlobNotFound {
+		return nil, err
+	}
+
+	// the filtered indexes are only in memory
+	if _, err := c.filtered.Info(ctx, desc.Digest); err != nil && c.link != CopyContent {
+		linked, err := c.linkBlob(desc)
+		if err != nil {
+			return nil, err
+		}
+		if linked {
+			c.record(&c.linked, blob)
+			return nil, nil
+		}
+	}
+
+	rc, err := providers{c.filtered, c.src.blobs}.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if err := content.WriteBlob(ctx, c.tx, rc, desc); err != nil {
+		return nil, err
+	}
+	c.record(&c.copied, blob)
+	return nil, nil
+}
+
+// linkBlob links the blob desc points to from c.src to the staging directory of c.tx,
+// according to c.link, and verifies it. It returns false if the filesystems do not allow it.
+func (c *copier) linkBlob(desc v1.Descriptor) (bool, error) {
+	srcPath, err := c.src.blobPath(desc.Digest)
+	if err != nil {
+		return false, err
+	}
+	dstPath, err := c.tx.blobPath(desc.Digest)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return false, errors.Wrap(err, "write blob")
+	}
+
+	switch c.link {
+	case HardLink:
+		if err := os.Link(srcPath, dstPath); err != nil {
+			return false, nil
+		}
+		if err := verifyFile(dstPath, desc); err != nil {
+			os.Remove(dstPath)
+			return false, err
+		}
+		// the link shares the modification time of the source, which is left untouched: the blob is only
+		// added to the destination by the commit of the transaction, under its lock, so GC cannot remove it
+		// for its age before index.json references it
+	case Reflink:
+		return c.reflinkBlob(srcPath, dstPath, desc)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// reflinkBlob clones srcPath to a temporary file of c.tx, verifies it and moves it to dstPath.
+func (c *copier) reflinkBlob(srcPath, dstPath string, desc v1.Descriptor) (bool, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return false, errors.Wrap(err, "read blob")
+	}
+	defer src.Close()
+
+	tmp, err := ioutil.TempFile(c.tx.dir, tempPattern)
+	if err != nil {
+		return false, errors.Wrap(err, "create blob")
+	}
+	defer os.Remove(tmp.Name())
+	if err := reflink(tmp, src); err != nil {
+		tmp.Close()
+		return false, nil
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return false, errors.Wrap(err, "write blob")
+	}
+	if err := tmp.Close(); err != nil {
+		return false, errors.Wrap(err, "write blob")
+	}
+	if err := verifyFile(tmp.Name(), desc); err != nil {
+		return false, err
+	}
+	return true, errors.Wrap(os.Rename(tmp.Name(), dstPath), "write blob")
+}
+
+// verifyFile verifies the content of the file p against desc.
+func verifyFile(p string, desc v1.Descriptor) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return errors.Wrap(err, "read blob")
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "read blob")
+	}
+	if fi.Size() != desc.Size {
+		return errors.Wrapf(ErrSizeMismatch, "blob %s has size %d, expected %d", desc.Digest, fi.Size(), desc.Size)
+	}
+	verifier := desc.Digest.Verifier()
+	if _, err := io.Copy(verifier, f); err != nil {
+		return errors.Wrap(err, "read blob")
+	}
+	if !verifier.Verified() {
+		return errors.Wrapf(ErrDigestMismatch, "blob %s", desc.Digest)
+	}
+	return nil
+}
+
+// record appends blob to list, one of the lists of c.
+func (c *copier) record(list *[]BlobInfo, blob BlobInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*list = append(*list, blob)
+}
+
+// sortBlobs sorts blobs by digest and returns them.
+func sortBlobs(blobs []BlobInfo) []BlobInfo {
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].Digest < blobs[j].Digest })
+	return blobs
+}
+
+// providers fetches the blobs from the first of its providers holding them.
+type providers []content.Provider
+
+func (p providers) Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	for _, provider := range p {
+		rc, err := provider.Fetch(ctx, desc)
+		if errors.Cause(err) == content.ErrNotFound {
+			continue
+		}
+		return rc, err
+	}
+	return nil, errors.Wrapf(content.ErrNotFound, "%s", desc.Digest)
+}
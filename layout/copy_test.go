@@ -0,0 +1,424 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/platform"
+	"github.com/opencontainers/image-spec/resolve"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// checkLayout fails t if fsck finds problems in l.
+func checkLayout(t *testing.T, l *Layout) {
+	t.Helper()
+	report, err := Fsck(context.Background(), l.Root(), FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range report.Problems {
+		t.Errorf("%s: %s %s: %v", l.Root(), p.Kind, p.Path, p.Err)
+	}
+}
+
+// refDescriptor returns the descriptor named refName in the index.json of l.
+func refDescriptor(t *testing.T, l *Layout, refName string) (v1.Descriptor, bool) {
+	t.Helper()
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, desc := range index.Manifests {
+		if desc.Annotations[v1.AnnotationRefName] == refName {
+			return desc, true
+		}
+	}
+	return v1.Descriptor{}, false
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _, _ := writeMultiPlatformImage(t, src, "v1")
+	dst, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Copy(ctx, dst, src, "v1", CopyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Descriptor.Digest != index.Digest {
+		t.Errorf("expected %s, got %s", index.Digest, result.Descriptor.Digest)
+	}
+	if len(result.Copied) == 0 || len(result.Linked) != 0 || len(result.Existing) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if desc, ok := refDescriptor(t, dst, "v1"); !ok || desc.Digest != index.Digest {
+		t.Errorf("expected v1 in the destination, got %+v", desc)
+	}
+	checkLayout(t, dst)
+
+	// the blobs are not copied again
+	again, err := Copy(ctx, dst, src, "v1", CopyOptions{RefName: "release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Copied) != 0 || len(again.Existing) != len(result.Copied) {
+		t.Errorf("expected %d existing blobs, got %+v", len(result.Copied), again)
+	}
+	if _, ok := refDescriptor(t, dst, "release"); !ok {
+		t.Error("expected release in the destination")
+	}
+	if _, ok := refDescriptor(t, dst, "v1"); !ok {
+		t.Error("expected v1 to remain in the destination")
+	}
+
+	if _, err := Copy(ctx, dst, src, "v2", CopyOptions{}); errors.Cause(err) != ErrRefNotFound {
+		t.Errorf("expected ErrRefNotFound, got %v", err)
+	}
+}
+
+func TestCopyPlatforms(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, amd64, arm64 := writeMultiPlatformImage(t, src, "v1")
+	dst, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Copy(ctx, dst, src, "v1", CopyOptions{
+		Platforms: []platform.Matcher{platform.NewMatcher(*amd64.Platform)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Descriptor.Digest == index.Digest {
+		t.Error("expected a filtered image index")
+	}
+	filtered, err := dst.ReadBlobBytes(result.Descriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.ReadBlobBytes(result.Descriptor); errors.Cause(err) != ErrBlobNotFound {
+		t.Errorf("expected the filtered index to be written to the destination only, got %v", err)
+	}
+	if ok, _ := dst.HasBlob(amd64.Digest); !ok {
+		t.Error("expected the amd64 manifest in the destination")
+	}
+	if ok, _ := dst.HasBlob(arm64.Digest); ok {
+		t.Errorf("unexpected arm64 manifest in the destination, with index %s", filtered)
+	}
+	checkLayout(t, dst)
+
+	// all platforms
+	if result, err = Copy(ctx, dst, src, "v1", CopyOptions{
+		Platforms: []platform.Matcher{platform.NewMatcher(*amd64.Platform), platform.NewMatcher(*arm64.Platform)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if result.Descriptor.Digest != index.Digest {
+		t.Errorf("expected the original image index, got %s", result.Descriptor.Digest)
+	}
+
+	if _, err := Copy(ctx, dst, src, "v1", CopyOptions{
+		Platforms: []platform.Matcher{platform.NewMatcher(v1.Platform{OS: "windows", Architecture: "amd64"})},
+	}); errors.Cause(err) != resolve.ErrNoMatch {
+		t.Errorf("expected ErrNoMatch, got %v", err)
+	}
+}
+
+func TestCopyTag(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := writeImage(t, dst, "a")
+	a.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+	b := writeImage(t, dst, "b")
+	b.Platform = &v1.Platform{OS: "linux", Architecture: "arm64"}
+	c := writeImage(t, src, "c")
+	c.Platform = b.Platform
+	d := writeImage(t, src, "d")
+	names := map[digest.Digest]string{a.Digest: "a", b.Digest: "b", c.Digest: "c", d.Digest: "d"}
+	for _, tag := range []struct {
+		l    *Layout
+		name string
+		desc v1.Descriptor
+	}{
+		{dst, "multi", a},
+		{dst, "multi", b},
+		{src, "arm64", c},
+		{src, "plain", d},
+	} {
+		if err := tag.l.AddTag(tag.name, tag.desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, tt := range []struct {
+		ref      string
+		refName  string
+		cause    error
+		expected string
+	}{
+		{
+			// only the tag of the platform of the copy is replaced
+			ref:      "arm64",
+			refName:  "multi",
+			expected: "multi@linux/amd64=a multi@linux/arm64=c",
+		},
+		{
+			ref:      "plain",
+			refName:  "multi",
+			expected: "multi@=d multi@linux/amd64=a multi@linux/arm64=c",
+		},
+		{
+			ref:      "plain",
+			refName:  "-multi",
+			cause:    ErrInvalidRefName,
+			expected: "multi@=d multi@linux/amd64=a multi@linux/arm64=c",
+		},
+	} {
+		if _, err := Copy(ctx, dst, src, tt.ref, CopyOptions{RefName: tt.refName}); errors.Cause(err) != tt.cause {
+			t.Errorf("test %d: expected %v, got %v", i, tt.cause, err)
+		}
+		if s := tagNames(t, dst, names); s != tt.expected {
+			t.Errorf("test %d: expected %q, got %q", i, tt.expected, s)
+		}
+	}
+	checkLayout(t, dst)
+}
+
+func TestCopyMultiPlatformTag(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := writeImage(t, src, "a")
+	a.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+	b := writeImage(t, src, "b")
+	b.Platform = &v1.Platform{OS: "linux", Architecture: "arm64"}
+	c := writeImage(t, src, "c")
+	names := map[digest.Digest]string{a.Digest: "a", b.Digest: "b", c.Digest: "c"}
+	for _, desc := range []v1.Descriptor{a, b} {
+		if err := src.AddTag("multi", desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.AddTag("other", c); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		platforms []platform.Matcher
+		cause     error
+		expected  string
+	}{
+		{
+			// every platform of the tag is copied
+			expected: "multi@linux/amd64=a multi@linux/arm64=b",
+		},
+		{
+			platforms: []platform.Matcher{platform.NewMatcher(*b.Platform)},
+			expected:  "multi@linux/arm64=b",
+		},
+		{
+			platforms: []platform.Matcher{platform.NewMatcher(v1.Platform{OS: "windows", Architecture: "amd64"})},
+			cause:     resolve.ErrNoMatch,
+		},
+	} {
+		dst, err := Init(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Copy(ctx, dst, src, "multi", CopyOptions{Platforms: tt.platforms})
+		if errors.Cause(err) != tt.cause {
+			t.Errorf("test %d: expected %v, got %v", i, tt.cause, err)
+		}
+		if s := tagNames(t, dst, names); s != tt.expected {
+			t.Errorf("test %d: expected %q, got %q", i, tt.expected, s)
+		}
+		if err == nil && len(result.Descriptors) != len(strings.Fields(tt.expected)) {
+			t.Errorf("test %d: expected a descriptor per copied image, got %+v", i, result.Descriptors)
+		}
+		if ok, _ := dst.HasBlob(c.Digest); ok {
+			t.Errorf("test %d: unexpected image of another tag in the destination", i)
+		}
+		checkLayout(t, dst)
+	}
+}
+
+func TestCopyLink(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, amd64, _ := writeMultiPlatformImage(t, src, "v1")
+	ageBlobs(t, src, time.Hour)
+	start := time.Now()
+
+	for _, mode := range []LinkMode{HardLink, Reflink} {
+		dst, err := Init(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Copy(ctx, dst, src, "v1", CopyOptions{Link: mode})
+		if err != nil {
+			t.Fatalf("mode %d: %v", mode, err)
+		}
+		if len(result.Copied)+len(result.Linked) == 0 {
+			t.Errorf("mode %d: nothing was copied", mode)
+		}
+		checkLayout(t, dst)
+
+		if mode != HardLink || len(result.Linked) == 0 {
+			continue
+		}
+		srcPath, _ := src.blobPath(result.Linked[0].Digest)
+		dstPath, _ := dst.blobPath(result.Linked[0].Digest)
+		srcInfo, err := os.Stat(srcPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstInfo, err := os.Stat(dstPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(srcInfo, dstInfo) {
+			t.Errorf("expected %s to be linked", dstPath)
+		}
+		if !srcInfo.ModTime().Before(start) {
+			t.Errorf("expected the modification time of %s to be kept, got %v", srcPath, srcInfo.ModTime())
+		}
+	}
+
+	// corrupt blobs are not copied, whatever the mode
+	p, err := src.blobPath(amd64.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[0] ^= 0xff
+	if err := ioutil.WriteFile(p, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []LinkMode{CopyContent, HardLink, Reflink} {
+		dst, err := Init(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Copy(ctx, dst, src, "v1", CopyOptions{Link: mode}); errors.Cause(err) != ErrDigestMismatch {
+			t.Errorf("mode %d: expected ErrDigestMismatch, got %v", mode, err)
+		}
+		if ok, _ := dst.HasBlob(amd64.Digest); ok {
+			t.Errorf("mode %d: the corrupt blob was copied", mode)
+		}
+		if _, ok := refDescriptor(t, dst, "v1"); ok {
+			t.Errorf("mode %d: the image was added to the destination", mode)
+		}
+		if staging, _ := filepath.Glob(filepath.Join(dst.Root(), transactionPattern)); len(staging) > 0 {
+			t.Errorf("mode %d: staging directories were left: %v", mode, staging)
+		}
+	}
+}
+
+// ageBlobs sets the modification time of the blobs of l to age ago.
+func ageBlobs(t *testing.T, l *Layout, age time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-age)
+	if err := l.blobs.Walk(context.Background(), func(info content.Info) error {
+		p, err := l.blobPath(info.Digest)
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(p, old, old)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyConcurrentGC(t *testing.T) {
+	ctx := context.Background()
+	src, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeMultiPlatformImage(t, src, "v1")
+	ageBlobs(t, src, time.Hour)
+
+	for _, mode := range []LinkMode{CopyContent, HardLink} {
+		dst, err := Init(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		collected := make(chan error)
+		go func() {
+			// without grace period, only the lock protects the blobs being copied
+			var none time.Duration
+			for {
+				select {
+				case <-done:
+					close(collected)
+					return
+				default:
+				}
+				if _, err := dst.GC(ctx, GCOptions{GracePeriod: &none}); err != nil {
+					collected <- err
+				}
+			}
+		}()
+		for i := 0; i < 10; i++ {
+			if _, err := Copy(ctx, dst, src, "v1", CopyOptions{RefName: fmt.Sprintf("copy%d", i), Link: mode}); err != nil && errors.Cause(err) != ErrBlobNotFound {
+				t.Errorf("mode %d: %v", mode, err)
+			}
+		}
+		close(done)
+		for err := range collected {
+			t.Errorf("mode %d: %v", mode, err)
+		}
+		checkLayout(t, dst)
+	}
+}
@@ -0,0 +1,555 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// QuarantineDir is the directory of an image layout where Fsck moves the corrupt blobs and stray files.
+const QuarantineDir = "quarantine"
+
+// ProblemKind categorizes the problems found by Fsck.
+type ProblemKind string
+
+// Kinds of problems found by Fsck.
+const (
+	// ProblemLayoutFile is reported for a missing or invalid oci-layout file, or a missing blobs directory.
+	ProblemLayoutFile ProblemKind = "layout-file"
+
+	// ProblemInvalidIndex is reported for a missing or invalid index.json.
+	ProblemInvalidIndex ProblemKind = "invalid-index"
+
+	// ProblemDanglingEntry is reported for a descriptor of index.json whose blob is missing or corrupt.
+	ProblemDanglingEntry ProblemKind = "dangling-entry"
+
+	// ProblemMissingBlob is reported for a blob referenced by an image index or manifest but missing from the layout.
+	ProblemMissingBlob ProblemKind = "missing-blob"
+
+	// ProblemCorruptBlob is reported for a blob whose content does not match its digest, e.g. a truncated blob.
+	ProblemCorruptBlob ProblemKind = "corrupt-blob"
+
+	// ProblemSizeMismatch is reported for a blob whose size is not the one of a descriptor referencing it.
+	ProblemSizeMismatch ProblemKind = "size-mismatch"
+
+	// ProblemInvalidDocument is reported for an image index, image manifest or image config which fails validation.
+	ProblemInvalidDocument ProblemKind = "invalid-document"
+
+	// ProblemStrayFile is reported for a file of the blobs directory which is not a blob.
+	ProblemStrayFile ProblemKind = "stray-file"
+)
+
+// A Problem is an inconsistency of an image layout found by Fsck.
+type Problem struct {
+	Kind ProblemKind
+
+	// Path is the path of the file the problem is about, relative to the root of the layout.
+	Path string
+
+	// Digest is the digest of the blob the problem is about, if any.
+	Digest digest.Digest
+
+	// Ref describes where the blob is referenced from, e.g. "index.json/manifests/0", if it is.
+	Ref string
+
+	// Err describes the problem.
+	Err error
+
+	// Suggestion describes how to repair the problem.
+	Suggestion string
+}
+
+func (p Problem) String() string {
+	s := fmt.Sprintf("%s: %s: %v", p.Kind, p.Path, p.Err)
+	if p.Ref != "" {
+		s += " (referenced by " + p.Ref + ")"
+	}
+	return s
+}
+
+// A Change is a modification of an image layout made by Fsck to repair it.
+type Change struct {
+	// Path is the path of the modified file, relative to the root of the layout.
+	Path string
+
+	// Message describes the modification.
+	Message string
+}
+
+func (c Change) String() string {
+	return c.Path + ": " + c.Message
+}
+
+// FsckOptions controls Fsck.
+type FsckOptions struct {
+	// Repair makes Fsck repair the problems it can:
+	// it rewrites a missing or invalid oci-layout file, creates a missing blobs directory
+	// or index.json, removes the dangling entries of index.json, and moves the corrupt blobs
+	// and stray files of the blobs directory to QuarantineDir.
+	// A repair holds the lock of the layout, see Layout.Lock, from start to end.
+	Repair bool
+}
+
+// FsckReport is the outcome of Fsck.
+type FsckReport struct {
+	// Problems lists the problems found, including the repaired ones.
+	Problems []Problem
+
+	// Changes lists the modifications made to repair the layout.
+	Changes []Change
+}
+
+// Fsck checks the image layout in the directory root, and repairs it if opts.Repair is set.
+// It checks the oci-layout file and index.json, the content of every blob against its digest,
+// and the blobs reachable from index.json against their descriptors and the schema of their media type.
+// The returned error is about Fsck itself failing, the problems of the layout are in the report.
+func Fsck(ctx context.Context, root string, opts FsckOptions) (*FsckReport, error) {
+	f := &fsck{
+		l:       newLayout(root),
+		opts:    opts,
+		report:  &FsckReport{},
+		blobs:   map[digest.Digest]int64{},
+		corrupt: map[digest.Digest]bool{},
+		visited: map[digest.Digest]bool{},
+	}
+	if err := f.run(ctx); err != nil {
+		return f.report, err
+	}
+	return f.report, nil
+}
+
+// fsck holds the state of a single Fsck.
+type fsck struct {
+	l      *Layout
+	opts   FsckOptions
+	report *FsckReport
+
+	// blobs maps the digests of the sound blobs to their sizes.
+	blobs map[digest.Digest]int64
+
+	// corrupt holds the blobs which do not match their digest.
+	corrupt map[digest.Digest]bool
+
+	visited map[digest.Digest]bool
+}
+
+func (f *fsck) problem(p Problem) {
+	f.report.Problems = append(f.report.Problems, p)
+}
+
+func (f *fsck) change(p, message string) {
+	f.report.Changes = append(f.report.Changes, Change{Path: p, Message: message})
+}
+
+func (f *fsck) run(ctx context.Context) error {
+	if f.opts.Repair {
+		// so that no transaction or GC moves the blobs and updates index.json while they are repaired
+		unlock, err := f.l.Lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	if err := f.checkLayoutFile(); err != nil {
+		return err
+	}
+	if err := f.checkBlobs(ctx); err != nil {
+		return err
+	}
+	return f.checkIndex(ctx)
+}
+
+// checkLayoutFile checks the oci-layout file.
+func (f *fsck) checkLayoutFile() error {
+	buf, err := ioutil.ReadFile(filepath.Join(f.l.root, v1.ImageLayoutFile))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "read image layout")
+	}
+
+	if os.IsNotExist(err) {
+		err = errors.New("missing")
+	} else if err = schema.ValidatorMediaTypeLayoutHeader.Validate(bytes.NewReader(buf)); err == nil {
+		var header v1.ImageLayout
+		if err := json.Unmarshal(buf, &header); err == nil && header.Version == v1.ImageLayoutVersion {
+			return nil
+		}
+		f.problem(Problem{
+			Kind:       ProblemLayoutFile,
+			Path:       v1.ImageLayoutFile,
+			Err:        errors.Wrapf(ErrUnsupportedVersion, "%q", header.Version),
+			Suggestion: "use an implementation supporting this version",
+		})
+		return nil
+	}
+
+	f.problem(Problem{
+		Kind:       ProblemLayoutFile,
+		Path:       v1.ImageLayoutFile,
+		Err:        err,
+		Suggestion: fmt.Sprintf("rewrite it with version %s", v1.ImageLayoutVersion),
+	})
+	if !f.opts.Repair {
+		return nil
+	}
+	buf, err = json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(f.l.root, v1.ImageLayoutFile, buf); err != nil {
+		return errors.Wrap(err, "repair image layout")
+	}
+	f.change(v1.ImageLayoutFile, fmt.Sprintf("rewritten with version %s", v1.ImageLayoutVersion))
+	return nil
+}
+
+// checkBlobs checks the content of every file of the blobs directory.
+func (f *fsck) checkBlobs(ctx context.Context) error {
+	algs, err := ioutil.ReadDir(filepath.Join(f.l.root, BlobsDir))
+	if os.IsNotExist(err) {
+		f.problem(Problem{
+			Kind:       ProblemLayoutFile,
+			Path:       BlobsDir,
+			Err:        errors.New("missing"),
+			Suggestion: "create an empty blobs directory",
+		})
+		if f.opts.Repair {
+			if err := os.Mkdir(filepath.Join(f.l.root, BlobsDir), 0755); err != nil {
+				return errors.Wrap(err, "repair image layout")
+			}
+			f.change(BlobsDir, "created an empty blobs directory")
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "list blobs")
+	}
+
+	for _, alg := range algs {
+		dir := path.Join(BlobsDir, alg.Name())
+		if !alg.IsDir() {
+			f.stray(dir, errors.New("not a digest algorithm directory"))
+			continue
+		}
+		entries, err := ioutil.ReadDir(filepath.Join(f.l.root, dir))
+		if err != nil {
+			return errors.Wrap(err, "list blobs")
+		}
+		for _, fi := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p := path.Join(dir, fi.Name())
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), fi.Name())
+			if !fi.Mode().IsRegular() {
+				f.stray(p, errors.New("not a regular file"))
+				continue
+			}
+			if err := dgst.Validate(); err != nil {
+				f.stray(p, errors.Wrap(err, "not a blob"))
+				continue
+			}
+			if err := f.verifyBlob(p, dgst); err != nil {
+				f.corrupt[dgst] = true
+				f.problem(Problem{
+					Kind:       ProblemCorruptBlob,
+					Path:       p,
+					Digest:     dgst,
+					Err:        err,
+					Suggestion: "fetch the blob again",
+				})
+				f.quarantine(p)
+				continue
+			}
+			f.blobs[dgst] = fi.Size()
+		}
+	}
+	return nil
+}
+
+// verifyBlob checks the content of the blob p against dgst.
+func (f *fsck) verifyBlob(p string, dgst digest.Digest) error {
+	file, err := os.Open(filepath.Join(f.l.root, p))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(verifier, file); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// stray reports the stray file p of the blobs directory.
+func (f *fsck) stray(p string, err error) {
+	f.problem(Problem{
+		Kind:       ProblemStrayFile,
+		Path:       p,
+		Err:        err,
+		Suggestion: "remove it",
+	})
+	f.quarantine(p)
+}
+
+// quarantine moves p to the quarantine directory in repair mode.
+func (f *fsck) quarantine(p string) {
+	if !f.opts.Repair {
+		return
+	}
+	target := path.Join(QuarantineDir, p)
+	err := os.MkdirAll(filepath.Join(f.l.root, filepath.FromSlash(path.Dir(target))), 0755)
+	if err == nil {
+		err = os.Rename(filepath.Join(f.l.root, filepath.FromSlash(p)), filepath.Join(f.l.root, filepath.FromSlash(target)))
+	}
+	if err != nil {
+		f.problem(Problem{
+			Kind:       ProblemStrayFile,
+			Path:       p,
+			Err:        errors.Wrap(err, "quarantine"),
+			Suggestion: "remove it",
+		})
+		return
+	}
+	f.change(p, "moved to "+target)
+}
+
+// checkIndex checks index.json and the blobs reachable from it.
+func (f *fsck) checkIndex(ctx context.Context) error {
+	buf, err := ioutil.ReadFile(filepath.Join(f.l.root, IndexFile))
+	if os.IsNotExist(err) {
+		f.problem(Problem{
+			Kind:       ProblemInvalidIndex,
+			Path:       IndexFile,
+			Err:        errors.New("missing"),
+			Suggestion: "create an empty image index",
+		})
+		if f.opts.Repair {
+			if err := f.l.writeIndex(emptyIndex()); err != nil {
+				return err
+			}
+			f.change(IndexFile, "created an empty image index")
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "read image index")
+	}
+
+	var index v1.Index
+	if err := json.Unmarshal(buf, &index); err != nil {
+		f.problem(Problem{
+			Kind:       ProblemInvalidIndex,
+			Path:       IndexFile,
+			Err:        err,
+			Suggestion: "restore it from a backup",
+		})
+		return nil
+	}
+	if err := schema.ValidatorMediaTypeImageIndex.Validate(bytes.NewReader(buf)); err != nil {
+		f.problem(Problem{
+			Kind:       ProblemInvalidIndex,
+			Path:       IndexFile,
+			Err:        err,
+			Suggestion: "fix the reported fields",
+		})
+	}
+
+	var dangling []int
+	for i, desc := range index.Manifests {
+		ref := fmt.Sprintf("%s/manifests/%d", IndexFile, i)
+		if _, ok := f.blobs[desc.Digest]; !ok {
+			reason := "missing"
+			if f.corrupt[desc.Digest] {
+				reason = "corrupt"
+			}
+			f.problem(Problem{
+				Kind:       ProblemDanglingEntry,
+				Path:       IndexFile,
+				Digest:     desc.Digest,
+				Ref:        ref,
+				Err:        errors.Errorf("blob %s is %s", desc.Digest, reason),
+				Suggestion: "remove the entry from index.json, or fetch the blob again",
+			})
+			dangling = append(dangling, i)
+			continue
+		}
+		if err := f.walk(ctx, ref, desc); err != nil {
+			return err
+		}
+	}
+
+	if len(dangling) == 0 || !f.opts.Repair {
+		return nil
+	}
+	// index.json was read under the lock, but a writer which does not take it
+	// may have added a missing blob since
+	removed := map[int]bool{}
+	for _, i := range dangling {
+		dgst := index.Manifests[i].Digest
+		if dgst.Validate() != nil {
+			removed[i] = true
+			continue
+		}
+		ok, err := f.l.HasBlob(dgst)
+		if err != nil {
+			return err
+		}
+		removed[i] = !ok || f.corrupt[dgst]
+	}
+	manifests := make([]v1.Descriptor, 0, len(index.Manifests))
+	for i, desc := range index.Manifests {
+		if removed[i] {
+			f.change(IndexFile, fmt.Sprintf("removed the dangling entry %d, %s", i, desc.Digest))
+			continue
+		}
+		manifests = append(manifests, desc)
+	}
+	index.Manifests = manifests
+	return f.l.writeIndex(index)
+}
+
+// walk checks the blob desc points to, referenced from ref, and the blobs reachable from it.
+func (f *fsck) walk(ctx context.Context, ref string, desc v1.Descriptor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p, err := BlobPath(desc.Digest)
+	if err != nil {
+		f.problem(Problem{
+			Kind:       ProblemMissingBlob,
+			Digest:     desc.Digest,
+			Ref:        ref,
+			Err:        err,
+			Suggestion: "fix the descriptor",
+		})
+		return nil
+	}
+	p = filepath.ToSlash(p)
+
+	size, ok := f.blobs[desc.Digest]
+	if !ok {
+		if f.corrupt[desc.Digest] {
+			// already reported
+			return nil
+		}
+		f.problem(Problem{
+			Kind:       ProblemMissingBlob,
+			Path:       p,
+			Digest:     desc.Digest,
+			Ref:        ref,
+			Err:        ErrBlobNotFound,
+			Suggestion: "fetch the blob again",
+		})
+		return nil
+	}
+	if size != desc.Size {
+		f.problem(Problem{
+			Kind:       ProblemSizeMismatch,
+			Path:       p,
+			Digest:     desc.Digest,
+			Ref:        ref,
+			Err:        errors.Wrapf(ErrSizeMismatch, "blob has size %d, the descriptor %d", size, desc.Size),
+			Suggestion: fmt.Sprintf("fix the size of the descriptor to %d", size),
+		})
+	}
+
+	if f.visited[desc.Digest] {
+		return nil
+	}
+	f.visited[desc.Digest] = true
+
+	switch desc.MediaType {
+	case v1.MediaTypeImageIndex, v1.MediaTypeImageManifest, v1.MediaTypeImageConfig:
+	default:
+		return nil
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(f.l.root, filepath.FromSlash(p)))
+	if err != nil {
+		return errors.Wrap(err, "read blob")
+	}
+	if err := schema.Validator(desc.MediaType).Validate(bytes.NewReader(buf)); err != nil {
+		f.problem(Problem{
+			Kind:       ProblemInvalidDocument,
+			Path:       p,
+			Digest:     desc.Digest,
+			Ref:        ref,
+			Err:        err,
+			Suggestion: "rebuild the image",
+		})
+		return nil
+	}
+
+	children, err := referencedDescriptors(desc.MediaType, buf)
+	if err != nil {
+		return nil // reported as an invalid document
+	}
+	for i, child := range children {
+		if err := f.walk(ctx, p+childRef(desc.MediaType, i), child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referencedDescriptors returns the descriptors referenced by the document buf of mediaType.
+func referencedDescriptors(mediaType string, buf []byte) ([]v1.Descriptor, error) {
+	var descs []v1.Descriptor
+	switch mediaType {
+	case v1.MediaTypeImageIndex:
+		var index v1.Index
+		if err := json.Unmarshal(buf, &index); err != nil {
+			return nil, errors.Wrap(err, "decode image index")
+		}
+		descs = append(descs, index.Manifests...)
+	case v1.MediaTypeImageManifest:
+		var manifest v1.Manifest
+		if err := json.Unmarshal(buf, &manifest); err != nil {
+			return nil, errors.Wrap(err, "decode image manifest")
+		}
+		descs = append(descs, manifest.Config)
+		descs = append(descs, manifest.Layers...)
+	}
+	return descs, nil
+}
+
+// childRef returns the JSON Pointer of the i-th descriptor returned by referencedDescriptors for mediaType.
+func childRef(mediaType string, i int) string {
+	switch {
+	case mediaType == v1.MediaTypeImageIndex:
+		return fmt.Sprintf("/manifests/%d", i)
+	case i == 0:
+		return "/config"
+	default:
+		return fmt.Sprintf("/layers/%d", i-1)
+	}
+}
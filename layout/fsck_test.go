@@ -0,0 +1,192 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func problemKinds(report *FsckReport) []string {
+	var kinds []string
+	for _, p := range report.Problems {
+		kinds = append(kinds, string(p.Kind))
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func TestFsck(t *testing.T) {
+	ctx := context.Background()
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good := writeImage(t, l, "good")
+	truncated := writeImage(t, l, "truncated")
+	noConfig := writeImage(t, l, "no config")
+	wrongSize := good
+	wrongSize.Size++
+	dangling := v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("dangling"), Size: 8}
+	if err := l.UpdateIndex(func(i *v1.Index) error {
+		i.Manifests = append(i.Manifests, good, truncated, noConfig, wrongSize, dangling)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// truncate a manifest
+	p, err := l.blobPath(truncated.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(p, truncated.Size/2); err != nil {
+		t.Fatal(err)
+	}
+	// remove the config of another one
+	buf, err := l.ReadBlobBytes(noConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest v1.Manifest
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = l.blobPath(manifest.Config.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	// add a stray file and break oci-layout
+	if err := ioutil.WriteFile(filepath.Join(l.Root(), BlobsDir, "sha256", "README"), []byte("stray"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(l.Root(), v1.ImageLayoutFile), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Fsck(ctx, l.Root(), FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		string(ProblemCorruptBlob),
+		string(ProblemDanglingEntry), // the truncated manifest
+		string(ProblemDanglingEntry),
+		string(ProblemLayoutFile),
+		string(ProblemMissingBlob),
+		string(ProblemSizeMismatch),
+		string(ProblemStrayFile),
+	}
+	if kinds := problemKinds(report); !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected problems %v, got %v", expected, report.Problems)
+	}
+	if len(report.Changes) != 0 {
+		t.Errorf("expected no change without repair, got %v", report.Changes)
+	}
+
+	report, err = Fsck(ctx, l.Root(), FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// oci-layout, 2 quarantined files and 2 dangling entries
+	if len(report.Changes) != 5 {
+		t.Errorf("expected 5 changes, got %v", report.Changes)
+	}
+	if _, err := os.Stat(filepath.Join(l.Root(), QuarantineDir, BlobsDir, "sha256", truncated.Digest.Encoded())); err != nil {
+		t.Errorf("expected the truncated manifest to be quarantined: %v", err)
+	}
+	if _, err := Open(l.Root()); err != nil {
+		t.Errorf("expected oci-layout to be repaired: %v", err)
+	}
+
+	// what is left cannot be repaired automatically
+	report, err = Fsck(ctx, l.Root(), FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{string(ProblemMissingBlob), string(ProblemSizeMismatch)}
+	if kinds := problemKinds(report); !reflect.DeepEqual(kinds, expected) || len(report.Changes) != 0 {
+		t.Errorf("expected problems %v and no change, got %v and %v", expected, report.Problems, report.Changes)
+	}
+	for _, p := range report.Problems {
+		if p.Suggestion == "" {
+			t.Errorf("expected a suggestion for %v", p)
+		}
+	}
+}
+
+func TestFsckRepairHoldsLock(t *testing.T) {
+	ctx := context.Background()
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.UpdateIndex(func(i *v1.Index) error {
+		i.Manifests = append(i.Manifests, v1.Descriptor{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    digest.FromString("missing"),
+			Size:      7,
+		})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := l.Lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// checking without repairing does not take the lock
+	report, err := Fsck(ctx, l.Root(), FsckOptions{})
+	if err != nil || len(report.Problems) != 1 {
+		t.Errorf("expected the dangling entry to be reported, got %v, %v", report.Problems, err)
+	}
+	locked, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	report, err = Fsck(locked, l.Root(), FsckOptions{Repair: true})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the repair to wait for the lock, got %v", err)
+	}
+	if len(report.Changes) != 0 {
+		t.Errorf("expected no change without the lock, got %v", report.Changes)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Fsck(ctx, l.Root(), FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 1 {
+		t.Errorf("expected the dangling entry to be removed, got %v", report.Changes)
+	}
+	if index, err := l.Index(); err != nil || len(index.Manifests) != 0 {
+		t.Errorf("expected an empty index, got %v, %v", index, err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/opencontainers/image-spec/walk"
+	"github.com/pkg/errors"
+)
+
+// DefaultGracePeriod is the grace period of a garbage collection whose GCOptions.GracePeriod is nil.
+const DefaultGracePeriod = time.Hour
+
+// GCOptions controls a garbage collection.
+type GCOptions struct {
+	// DryRun reports the unreferenced blobs without removing them.
+	DryRun bool
+
+	// GracePeriod keeps the unreferenced blobs modified less than GracePeriod before the collection started,
+	// which another process may be about to reference from index.json.
+	// Nil means DefaultGracePeriod, and a zero GracePeriod keeps no blob for this reason,
+	// which is only safe if no other process writes blobs without a transaction.
+	// Blobs modified after the collection started are always kept.
+	GracePeriod *time.Duration
+}
+
+// BlobInfo describes a blob of an image layout.
+type BlobInfo struct {
+	Digest digest.Digest
+	Size   int64
+}
+
+// GCResult is the outcome of a garbage collection.
+type GCResult struct {
+	// Removed lists the unreferenced blobs, which were removed unless in a dry run, sorted by digest.
+	Removed []BlobInfo
+
+	// Size is the total size of the Removed blobs.
+	Size int64
+
+	// Missing lists the referenced blobs missing from the image layout, sorted.
+	Missing []digest.Digest
+}
+
+// GC removes the blobs which are not reachable from index.json, through nested image indexes
+// and image manifests to their configs and layers.
+//
+// Blobs modified during the collection, or within opts.GracePeriod before it, are kept,
+// and index.json is read again under the lock of the layout before removing anything,
+// so that content added concurrently by a process which writes blobs before referencing them,
+// or by a transaction, is not removed.
+// GC fails without removing anything if a reachable index or manifest cannot be read.
+func (l *Layout) GC(ctx context.Context, opts GCOptions) (GCResult, error) {
+	var result GCResult
+	grace := DefaultGracePeriod
+	if opts.GracePeriod != nil {
+		grace = *opts.GracePeriod
+	}
+	cutoff := time.Now().Add(-grace)
+
+	m := newMarker(l)
+	if err := m.markIndex(ctx); err != nil {
+		return result, err
+	}
+
+	candidates, err := l.unmarkedBlobs(ctx, m.marked, cutoff)
+	if err != nil {
+		return result, err
+	}
+
+	unlock, err := l.Lock(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+
+	// index.json may have been updated while marking, mark again what it references now
+	if err := m.markIndex(ctx); err != nil {
+		return result, err
+	}
+
+	for _, blob := range candidates {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if m.marked[blob.Digest] {
+			continue
+		}
+		if !opts.DryRun {
+			if err := l.blobs.Delete(ctx, blob.Digest); err != nil && errors.Cause(err) != ErrBlobNotFound {
+				return result, err
+			}
+		}
+		result.Removed = append(result.Removed, blob)
+		result.Size += blob.Size
+	}
+
+	result.Missing = m.missingDigests()
+	return result, nil
+}
+
+// unmarkedBlobs returns the blobs of l which are not marked and were last modified before cutoff, sorted by digest.
+// Files of the blobs directory which are not blobs are left to fsck.
+func (l *Layout) unmarkedBlobs(ctx context.Context, marked map[digest.Digest]bool, cutoff time.Time) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	err := l.blobs.Walk(ctx, func(info content.Info) error {
+		if !marked[info.Digest] && info.UpdatedAt.Before(cutoff) {
+			blobs = append(blobs, BlobInfo{Digest: info.Digest, Size: info.Size})
+		}
+		return nil
+	})
+	return blobs, err
+}
+
+// marker marks the blobs reachable from index.json.
+type marker struct {
+	l *Layout
+
+	// stores holds the blobs, searched in order.
+	stores []*content.FileStore
+
+	// mu guards marked and missing, updated by concurrent handlers.
+	mu      sync.Mutex
+	marked  map[digest.Digest]bool
+	missing map[digest.Digest]bool
+}
+
+// newMarker returns a marker of l without marked blobs.
+func newMarker(l *Layout) *marker {
+	return &marker{l: l, stores: []*content.FileStore{l.blobs}, marked: map[digest.Digest]bool{}, missing: map[digest.Digest]bool{}}
+}
+
+// markIndex marks the blobs reachable from the current index.json.
+func (m *marker) markIndex(ctx context.Context) error {
+	index, err := m.l.Index()
+	if err != nil {
+		return err
+	}
+	return m.mark(ctx, index.Manifests...)
+}
+
+// missingDigests returns the digests recorded as missing which were not marked since, sorted.
+func (m *marker) missingDigests() []digest.Digest {
+	var missing []digest.Digest
+	for dgst := range m.missing {
+		if !m.marked[dgst] {
+			missing = append(missing, dgst)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return missing
+}
+
+// mark marks descs and the blobs reachable from them.
+func (m *marker) mark(ctx context.Context, descs ...v1.Descriptor) error {
+	p := make(providers, len(m.stores))
+	for i, s := range m.stores {
+		p[i] = s
+	}
+	return walk.Walk(ctx, walk.Handlers(walk.HandlerFunc(m.markBlob), walk.Children(p)), descs...)
+}
+
+// markBlob marks the blob desc points to, or records it as missing.
+// It skips the children of blobs marked already, by a previous walk, and of missing blobs.
+func (m *marker) markBlob(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+	m.mu.Lock()
+	seen := m.marked[desc.Digest] || m.missing[desc.Digest]
+	m.mu.Unlock()
+	if seen {
+		return nil, walk.ErrSkip
+	}
+
+	var err error
+	for _, s := range m.stores {
+		if _, err = s.Info(ctx, desc.Digest); errors.Cause(err) != ErrBlobNotFound {
+			break
+		}
+	}
+	if err != nil && errors.Cause(err) != ErrBlobNotFound {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.missing[desc.Digest] = true
+		return nil, walk.ErrSkip
+	}
+	m.marked[desc.Digest] = true
+	return nil, nil
+}
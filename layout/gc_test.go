@@ -0,0 +1,159 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// age sets the modification time of every blob of l to an hour ago.
+func age(t *testing.T, l *Layout) {
+	t.Helper()
+	old := time.Now().Add(-time.Hour)
+	err := filepath.Walk(filepath.Join(l.Root(), BlobsDir), func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		return os.Chtimes(p, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := writeImage(t, l, "kept")
+	dropped := writeImage(t, l, "dropped")
+	missing := v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("missing"), Size: 7}
+	nested, err := json.Marshal(v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{kept},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := l.WriteBlobBytes(v1.MediaTypeImageIndex, nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.UpdateIndex(func(i *v1.Index) error {
+		i.Manifests = append(i.Manifests, index, missing)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	age(t, l)
+
+	// a recent unreferenced blob is kept during the grace period
+	recent, err := l.WriteBlobBytes("text/plain", []byte("recent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minute := time.Minute
+	result, err := l.GC(ctx, GCOptions{DryRun: true, GracePeriod: &minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the manifest, config and layer of the dropped image
+	if len(result.Removed) != 3 {
+		t.Fatalf("expected 3 unreferenced blobs, got %v", result.Removed)
+	}
+	var size int64
+	for _, blob := range result.Removed {
+		if blob.Digest == recent.Digest {
+			t.Errorf("expected the recent blob to be kept")
+		}
+		size += blob.Size
+	}
+	if size != result.Size {
+		t.Errorf("expected a total size of %d, got %d", size, result.Size)
+	}
+	if len(result.Missing) != 1 || result.Missing[0] != missing.Digest {
+		t.Errorf("expected %s to be missing, got %v", missing.Digest, result.Missing)
+	}
+	if ok, _ := l.HasBlob(dropped.Digest); !ok {
+		t.Errorf("expected a dry run to keep %s", dropped.Digest)
+	}
+
+	// the default grace period keeps the recent blob as well
+	defaulted, err := l.GC(ctx, GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defaulted.Removed) != 3 {
+		t.Errorf("expected 3 unreferenced blobs, got %v", defaulted.Removed)
+	}
+	// without grace period, only blobs modified after the collection started are kept
+	var none time.Duration
+	ungraced, err := l.GC(ctx, GCOptions{DryRun: true, GracePeriod: &none})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ungraced.Removed) != 4 {
+		t.Errorf("expected 4 unreferenced blobs, got %v", ungraced.Removed)
+	}
+
+	if _, err := l.GC(ctx, GCOptions{GracePeriod: &minute}); err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range result.Removed {
+		if ok, _ := l.HasBlob(blob.Digest); ok {
+			t.Errorf("expected %s to be removed", blob.Digest)
+		}
+	}
+	for _, dgst := range []digest.Digest{kept.Digest, index.Digest, recent.Digest} {
+		if ok, _ := l.HasBlob(dgst); !ok {
+			t.Errorf("expected %s to be kept", dgst)
+		}
+	}
+
+	// only the missing manifest is left to complain about
+	if err := l.UpdateIndex(func(i *v1.Index) error {
+		i.Manifests = i.Manifests[:1]
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.GC(ctx, GCOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// nested indexes are reported as warnings, but missing blobs would be too
+	validation, err := schema.ValidateLayoutDir(l.Root(), schema.Options{})
+	if err != nil {
+		t.Errorf("expected a valid image layout, got %v", err)
+	}
+	for _, w := range validation.Warnings {
+		if w.Code == schema.WarningMissingBlob {
+			t.Errorf("unexpected warning %v", w)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package layout reads and writes OCI image layouts in a directory.
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/internal/fsutil"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// BlobsDir is the directory of an image layout holding the blobs.
+	BlobsDir = content.BlobsDir
+
+	// IndexFile is the file of an image layout holding its image index.
+	IndexFile = "index.json"
+
+	// tempPattern is the pattern of the names of the temporary files, at the root of the layout.
+	tempPattern = ".tmp-*"
+)
+
+var (
+	// ErrNotLayout is returned by Open for a directory without oci-layout file.
+	ErrNotLayout = errors.New("not an image layout")
+
+	// ErrUnsupportedVersion is returned by Open for an image layout version other than v1.ImageLayoutVersion.
+	ErrUnsupportedVersion = errors.New("unsupported image layout version")
+)
+
+// A Layout is an image layout in a directory.
+// It is safe for concurrent use, and its updates of index.json are serialized with those of
+// the other processes using this package, see Lock.
+type Layout struct {
+	root  string
+	blobs *content.FileStore
+
+	// sem serializes the updates of index.json within the process, see Lock.
+	// It is a semaphore of one, so that waiting for it can be cancelled.
+	sem chan struct{}
+}
+
+// Init creates an empty image layout in the directory root, creating root if needed.
+// It fails if root already holds an image layout.
+func Init(root string) (*Layout, error) {
+	if err := os.MkdirAll(filepath.Join(root, BlobsDir), 0755); err != nil {
+		return nil, errors.Wrap(err, "create image layout")
+	}
+	if _, err := os.Lstat(filepath.Join(root, v1.ImageLayoutFile)); err == nil {
+		return nil, errors.Wrapf(os.ErrExist, "%s: image layout", root)
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "create image layout")
+	}
+
+	l := newLayout(root)
+	if _, err := os.Lstat(filepath.Join(root, IndexFile)); os.IsNotExist(err) {
+		if err := l.writeIndex(emptyIndex()); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, errors.Wrap(err, "create image layout")
+	}
+
+	// oci-layout is written last, so that a layout is complete once it exists.
+	buf, err := json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(root, v1.ImageLayoutFile, buf); err != nil {
+		return nil, errors.Wrap(err, "create image layout")
+	}
+	return l, nil
+}
+
+// Open opens the image layout in the directory root.
+func Open(root string) (*Layout, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(root, v1.ImageLayoutFile))
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotLayout, "%s", root)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "open image layout")
+	}
+
+	var header v1.ImageLayout
+	if err := json.Unmarshal(buf, &header); err != nil {
+		return nil, errors.Wrapf(err, "%s: invalid %s", root, v1.ImageLayoutFile)
+	}
+	if header.Version != v1.ImageLayoutVersion {
+		return nil, errors.Wrapf(ErrUnsupportedVersion, "%s: %q", root, header.Version)
+	}
+	return newLayout(root), nil
+}
+
+// newLayout returns the Layout of the directory root, without checking it.
+func newLayout(root string) *Layout {
+	return &Layout{root: root, blobs: content.NewFileStore(root), sem: make(chan struct{}, 1)}
+}
+
+// Root returns the directory of the image layout.
+func (l *Layout) Root() string {
+	return l.root
+}
+
+// Index returns the image index of index.json.
+func (l *Layout) Index() (v1.Index, error) {
+	index, _, err := l.ReadIndex()
+	return index, err
+}
+
+// UpdateIndex calls update with the image index of index.json and replaces index.json
+// with the result if update returns no error.
+// index.json is replaced atomically, under the lock of the layout,
+// so that concurrent updates are not lost.
+func (l *Layout) UpdateIndex(update func(index *v1.Index) error) error {
+	unlock, err := l.Lock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := l.Index()
+	if err != nil {
+		return err
+	}
+	if err := update(&index); err != nil {
+		return err
+	}
+	return l.writeIndex(index)
+}
+
+// emptyIndex returns the image index of an empty image layout.
+func emptyIndex() v1.Index {
+	return v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: []v1.Descriptor{},
+	}
+}
+
+// writeIndex replaces index.json with index.
+func (l *Layout) writeIndex(index v1.Index) error {
+	if index.Manifests == nil {
+		index.Manifests = []v1.Descriptor{}
+	}
+	buf, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "encode image index")
+	}
+	return errors.Wrap(writeFileAtomic(l.root, IndexFile, buf), "write image index")
+}
+
+// writeFileAtomic replaces the file name of dir with a file holding buf,
+// so that readers see either the previous file or the complete new one.
+func writeFileAtomic(dir, name string, buf []byte) error {
+	f, err := ioutil.TempFile(dir, tempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	return fsutil.SyncDir(dir)
+}
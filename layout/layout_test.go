@@ -0,0 +1,282 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/resolve"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+var _ resolve.Fetcher = (*Layout)(nil)
+
+// blobWriter writes blobs, as Layout and Transaction do.
+type blobWriter interface {
+	WriteBlobBytes(mediaType string, buf []byte) (v1.Descriptor, error)
+}
+
+// writeImage writes a minimal image to l and returns the descriptor of its manifest.
+func writeImage(t *testing.T, l blobWriter, layerContent string) v1.Descriptor {
+	t.Helper()
+
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	if err := tw.WriteHeader(&tar.Header{Name: "content", Mode: 0644, Size: int64(len(layerContent))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(layerContent)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := l.WriteBlobBytes(v1.MediaTypeImageLayer, tarball.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := json.Marshal(v1.Image{
+		OS:           "linux",
+		Architecture: "amd64",
+		RootFS:       v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{layer.Digest}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configDesc, err := l.WriteBlobBytes(v1.MediaTypeImageConfig, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := json.Marshal(v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageManifest,
+		Config:    configDesc,
+		Layers:    []v1.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := l.WriteBlobBytes(v1.MediaTypeImageManifest, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+func TestLayout(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "layout")
+	l, err := Init(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Init(root); !errors.Is(err, os.ErrExist) {
+		t.Errorf("expected a second Init to fail, got %v", err)
+	}
+	if _, err := Open(t.TempDir()); errors.Cause(err) != ErrNotLayout {
+		t.Errorf("expected ErrNotLayout, got %v", err)
+	}
+
+	l, err = Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := writeImage(t, l, "layer")
+	desc.Annotations = map[string]string{v1.AnnotationRefName: "latest"}
+	if err := l.UpdateIndex(func(index *v1.Index) error {
+		index.Manifests = append(index.Manifests, desc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Digest != desc.Digest {
+		t.Errorf("unexpected index %v", index)
+	}
+
+	if _, err := schema.ValidateLayoutDir(root, schema.Options{WarningsAsErrors: true}); err != nil {
+		t.Errorf("expected a valid image layout, got %v", err)
+	}
+
+	// no temporary file is left behind
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".tmp-") {
+			t.Errorf("unexpected temporary file %s", e.Name())
+		}
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("hello, world")
+	desc := v1.Descriptor{MediaType: "text/plain", Digest: digest.FromBytes(content), Size: int64(len(content))}
+
+	// content which does not match its descriptor is not committed
+	if err := l.WriteBlob(strings.NewReader("hello, wordl"), desc); errors.Cause(err) != ErrDigestMismatch {
+		t.Errorf("expected ErrDigestMismatch, got %v", err)
+	}
+	if err := l.WriteBlob(strings.NewReader("hello"), desc); errors.Cause(err) != ErrSizeMismatch {
+		t.Errorf("expected ErrSizeMismatch, got %v", err)
+	}
+	if ok, err := l.HasBlob(desc.Digest); err != nil || ok {
+		t.Errorf("expected the blob not to be written, got %t, %v", ok, err)
+	}
+	if _, err := l.ReadBlob(desc); errors.Cause(err) != ErrBlobNotFound {
+		t.Errorf("expected ErrBlobNotFound, got %v", err)
+	}
+
+	w, err := l.NewBlobWriter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := w.Commit(-1, "")
+	if err != nil || dgst != desc.Digest {
+		t.Fatalf("expected %s, got %s, %v", desc.Digest, dgst, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := l.ReadBlobBytes(desc)
+	if err != nil || !bytes.Equal(buf, content) {
+		t.Errorf("expected %q, got %q, %v", content, buf, err)
+	}
+
+	// corrupted blobs fail to read
+	p, err := BlobPath(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(l.Root(), p), []byte("hello, wordl"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.ReadBlobBytes(desc); errors.Cause(err) != ErrDigestMismatch {
+		t.Errorf("expected ErrDigestMismatch, got %v", err)
+	}
+
+	if _, err := BlobPath("sha256:../../etc/passwd"); err == nil {
+		t.Errorf("expected an invalid digest to fail")
+	}
+}
+
+func TestIngest(t *testing.T) {
+	ctx := context.Background()
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := []byte("hello, world")
+	desc := v1.Descriptor{MediaType: "text/plain", Digest: digest.FromBytes(hello), Size: int64(len(hello))}
+
+	w, err := l.Ingest(ctx, "hello", desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(hello[:5]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// an ingestion in progress is not part of the image layout
+	checkLayout(t, l)
+	if ok, _ := l.HasBlob(desc.Digest); ok {
+		t.Error("an ingested blob is visible before the commit")
+	}
+
+	if w, err = l.Ingest(ctx, "hello", desc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(hello[w.Size():]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(ctx, -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := l.ReadBlobBytes(desc); err != nil || !bytes.Equal(buf, hello) {
+		t.Errorf("expected %q, got %q, %v", hello, buf, err)
+	}
+	if statuses, err := l.Ingestions(ctx); err != nil || len(statuses) != 0 {
+		t.Errorf("expected no ingestions, got %v, %v", statuses, err)
+	}
+	if err := l.AbortIngestion(ctx, "hello"); errors.Cause(err) != content.ErrNoIngestion {
+		t.Errorf("expected ErrNoIngestion, got %v", err)
+	}
+	checkLayout(t, l)
+}
+
+func TestUpdateIndexConcurrently(t *testing.T) {
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 16
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := l.UpdateIndex(func(index *v1.Index) error {
+				index.Manifests = append(index.Manifests, v1.Descriptor{
+					MediaType: v1.MediaTypeImageManifest,
+					Digest:    digest.FromString(string(rune('a' + i))),
+					Size:      1,
+				})
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != n {
+		t.Errorf("expected %d manifests, got %d", n, len(index.Manifests))
+	}
+}
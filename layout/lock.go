@@ -0,0 +1,116 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// LockFile is the file of an image layout locked by its writers, see Lock.
+const LockFile = ".lock"
+
+const (
+	// minLockRetry and maxLockRetry bound the delay between two attempts to take the lock of a layout.
+	minLockRetry = time.Millisecond
+	maxLockRetry = 50 * time.Millisecond
+)
+
+// ErrIndexChanged is returned by ReplaceIndex when index.json is not the one expected.
+var ErrIndexChanged = errors.New("index.json changed")
+
+// Lock takes the exclusive lock of the image layout, waiting for it until ctx is done,
+// whether it is held by another process or by another goroutine using l,
+// and returns the function releasing it.
+//
+// The lock is an advisory lock of LockFile, shared by the processes using this package,
+// which UpdateIndex, ReplaceIndex, transactions and GC take to update index.json.
+// Where advisory locks are not available, LockFile is created exclusively and removed
+// on release, so that a process killed while holding it leaves the layout locked
+// until LockFile is removed.
+func (l *Layout) Lock(ctx context.Context) (func() error, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-l.sem }
+
+	delay := minLockRetry
+	for {
+		unlock, ok, err := tryLock(filepath.Join(l.root, LockFile))
+		if err != nil {
+			release()
+			return nil, errors.Wrap(err, "lock image layout")
+		}
+		if ok {
+			return func() error {
+				defer release()
+				return errors.Wrap(unlock(), "unlock image layout")
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxLockRetry {
+			delay = maxLockRetry
+		}
+	}
+}
+
+// ReadIndex returns the image index of index.json and the digest of index.json, see ReplaceIndex.
+func (l *Layout) ReadIndex() (v1.Index, digest.Digest, error) {
+	var index v1.Index
+	buf, err := ioutil.ReadFile(filepath.Join(l.root, IndexFile))
+	if err != nil {
+		return index, "", errors.Wrap(err, "read image index")
+	}
+	if err := json.Unmarshal(buf, &index); err != nil {
+		return index, "", errors.Wrapf(err, "invalid %s", IndexFile)
+	}
+	return index, digest.FromBytes(buf), nil
+}
+
+// ReplaceIndex replaces index.json with index if the digest of index.json is still expected,
+// as returned by ReadIndex, and fails with ErrIndexChanged otherwise.
+// It lets a writer prepare an update without holding the lock of the layout,
+// and retry it if another writer updated index.json meanwhile.
+func (l *Layout) ReplaceIndex(ctx context.Context, index v1.Index, expected digest.Digest) error {
+	unlock, err := l.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, current, err := l.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if current != expected {
+		return errors.Wrapf(ErrIndexChanged, "expected %s, found %s", expected, current)
+	}
+	return l.writeIndex(index)
+}
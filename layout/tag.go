@@ -0,0 +1,220 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"sort"
+
+	"github.com/opencontainers/image-spec/platform"
+	"github.com/opencontainers/image-spec/schema"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrRefNotFound is returned for a ref name which is not in index.json.
+	ErrRefNotFound = errors.New("ref name not found")
+
+	// ErrInvalidRefName is returned for a ref name which does not match the grammar of annotations.md.
+	ErrInvalidRefName = errors.New("invalid ref name")
+
+	// ErrTagConflict is returned by AddTag for a ref name which already names another descriptor for the same platform.
+	ErrTagConflict = errors.New("tag conflict")
+)
+
+// errTagUnchanged stops the update of index.json by a tag which is there already.
+var errTagUnchanged = errors.New("tag unchanged")
+
+// A Tag is a descriptor of index.json named by its org.opencontainers.image.ref.name annotation.
+//
+// A ref name names at most one descriptor per platform: several descriptors of index.json may share
+// a ref name if their platforms differ, descriptors without platform being of a platform of their own.
+type Tag struct {
+	Name       string
+	Descriptor v1.Descriptor
+}
+
+// Tags returns the tags of index.json, sorted by name, then by platform.
+func (l *Layout) Tags() ([]Tag, error) {
+	index, err := l.Index()
+	if err != nil {
+		return nil, err
+	}
+	var tags []Tag
+	for _, desc := range index.Manifests {
+		if name, ok := desc.Annotations[v1.AnnotationRefName]; ok {
+			tags = append(tags, Tag{Name: name, Descriptor: desc})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+		return platformKey(tags[i].Descriptor) < platformKey(tags[j].Descriptor)
+	})
+	return tags, nil
+}
+
+// ResolveTag returns the descriptors named name, one per platform, sorted by platform.
+// It fails with ErrRefNotFound if there is none.
+func (l *Layout) ResolveTag(name string) ([]v1.Descriptor, error) {
+	tags, err := l.Tags()
+	if err != nil {
+		return nil, err
+	}
+	var descs []v1.Descriptor
+	for _, tag := range tags {
+		if tag.Name == name {
+			descs = append(descs, tag.Descriptor)
+		}
+	}
+	if len(descs) == 0 {
+		return nil, errors.Wrapf(ErrRefNotFound, "%s", name)
+	}
+	return descs, nil
+}
+
+// AddTag adds desc to index.json, named name.
+// It fails with ErrTagConflict if name already names another descriptor for the platform of desc,
+// and does nothing if it names the same digest.
+// See MoveTag for the other errors.
+func (l *Layout) AddTag(name string, desc v1.Descriptor) error {
+	return l.tag(name, desc, false)
+}
+
+// MoveTag makes name name desc for the platform of desc, adding desc to index.json
+// and removing the descriptor name named for that platform, if any.
+// It fails with ErrInvalidRefName if name does not match the grammar of annotations.md,
+// and with ErrBlobNotFound if the blob desc points to is not in the image layout.
+func (l *Layout) MoveTag(name string, desc v1.Descriptor) error {
+	return l.tag(name, desc, true)
+}
+
+// tag adds desc to index.json named name, replacing the descriptor of name for the same platform if replace is true.
+func (l *Layout) tag(name string, desc v1.Descriptor, replace bool) error {
+	if !schema.ValidRefName(name) {
+		return errors.Wrapf(ErrInvalidRefName, "%q", name)
+	}
+	annotations := make(map[string]string, len(desc.Annotations)+1)
+	for k, v := range desc.Annotations {
+		annotations[k] = v
+	}
+	annotations[v1.AnnotationRefName] = name
+	desc.Annotations = annotations
+
+	err := l.UpdateIndex(func(index *v1.Index) error {
+		// under the lock, so that a concurrent GC cannot remove the blob before index.json references it
+		info, err := l.blobs.Info(context.Background(), desc.Digest)
+		if err != nil {
+			return err
+		}
+		if info.Size != desc.Size {
+			return errors.Wrapf(ErrSizeMismatch, "blob %s has size %d, the descriptor %d", desc.Digest, info.Size, desc.Size)
+		}
+		manifests := make([]v1.Descriptor, 0, len(index.Manifests)+1)
+		for _, current := range index.Manifests {
+			if sameTag(current, desc) {
+				if !replace && current.Digest == desc.Digest {
+					return errTagUnchanged
+				}
+				if !replace {
+					return errors.Wrapf(ErrTagConflict, "%s already names %s", name, current.Digest)
+				}
+				continue
+			}
+			manifests = append(manifests, current)
+		}
+		index.Manifests = append(manifests, desc)
+		return nil
+	})
+	if err == errTagUnchanged {
+		return nil
+	}
+	return err
+}
+
+// DeleteTag removes the descriptors named name from index.json.
+// The blobs they point to are left to GC.
+// It fails with ErrRefNotFound if there is none.
+func (l *Layout) DeleteTag(name string) error {
+	return l.UpdateIndex(func(index *v1.Index) error {
+		manifests := make([]v1.Descriptor, 0, len(index.Manifests))
+		for _, desc := range index.Manifests {
+			if desc.Annotations[v1.AnnotationRefName] != name {
+				manifests = append(manifests, desc)
+			}
+		}
+		if len(manifests) == len(index.Manifests) {
+			return errors.Wrapf(ErrRefNotFound, "%s", name)
+		}
+		index.Manifests = manifests
+		return nil
+	})
+}
+
+// platformKey returns the platform of desc as a string, empty for a descriptor without platform.
+func platformKey(desc v1.Descriptor) string {
+	if desc.Platform == nil {
+		return ""
+	}
+	return platform.Format(platform.Normalize(*desc.Platform))
+}
+
+// mergeDescriptors adds descs to current: a descriptor with a ref name replaces the descriptor
+// of that ref name for its platform, as MoveTag does, and one without is skipped if already in current.
+func mergeDescriptors(current, descs []v1.Descriptor) []v1.Descriptor {
+	for _, desc := range descs {
+		_, hasRefName := desc.Annotations[v1.AnnotationRefName]
+		merged := current[:0]
+		duplicate := false
+		for _, c := range current {
+			if hasRefName && sameTag(c, desc) {
+				continue
+			}
+			if !hasRefName && sameDescriptor(c, desc) {
+				duplicate = true
+			}
+			merged = append(merged, c)
+		}
+		current = merged
+		if !duplicate {
+			current = append(current, desc)
+		}
+	}
+	return current
+}
+
+// validateRefNames fails with ErrInvalidRefName if the ref name of one of descs does not match
+// the grammar of annotations.md.
+func validateRefNames(descs []v1.Descriptor) error {
+	for _, desc := range descs {
+		if name, ok := desc.Annotations[v1.AnnotationRefName]; ok && !schema.ValidRefName(name) {
+			return errors.Wrapf(ErrInvalidRefName, "%q", name)
+		}
+	}
+	return nil
+}
+
+// sameTag reports whether a and b are named by the same ref name for the same platform,
+// in which case index.json holds at most one of them.
+func sameTag(a, b v1.Descriptor) bool {
+	name, ok := a.Annotations[v1.AnnotationRefName]
+	if !ok {
+		return false
+	}
+	other, ok := b.Annotations[v1.AnnotationRefName]
+	return ok && name == other && platformKey(a) == platformKey(b)
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// tagNames returns the tags of l as name@platform=image strings, images being named by names.
+func tagNames(t *testing.T, l *Layout, names map[digest.Digest]string) string {
+	t.Helper()
+	tags, err := l.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s []string
+	for _, tag := range tags {
+		s = append(s, fmt.Sprintf("%s@%s=%s", tag.Name, platformKey(tag.Descriptor), names[tag.Descriptor.Digest]))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestTags(t *testing.T) {
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := writeImage(t, l, "a")
+	b := writeImage(t, l, "b")
+	names := map[digest.Digest]string{a.Digest: "a", b.Digest: "b"}
+	amd64 := a
+	amd64.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := b
+	arm64.Platform = &v1.Platform{OS: "linux", Architecture: "arm64"}
+
+	for i, tt := range []struct {
+		op       func() error
+		cause    error
+		expected string
+	}{
+		{
+			op:       func() error { return l.AddTag("v1", a) },
+			expected: "v1@=a",
+		},
+		{
+			// the same descriptor again, without rewriting index.json
+			op: func() error {
+				before, err := os.Stat(filepath.Join(l.Root(), IndexFile))
+				if err != nil {
+					return err
+				}
+				if err := l.AddTag("v1", a); err != nil {
+					return err
+				}
+				after, err := os.Stat(filepath.Join(l.Root(), IndexFile))
+				if err != nil {
+					return err
+				}
+				if !os.SameFile(before, after) {
+					return errors.New("index.json rewritten")
+				}
+				return nil
+			},
+			expected: "v1@=a",
+		},
+		{
+			op:       func() error { return l.AddTag("v1", b) },
+			cause:    ErrTagConflict,
+			expected: "v1@=a",
+		},
+		{
+			op:       func() error { return l.AddTag("latest", b) },
+			expected: "latest@=b v1@=a",
+		},
+		{
+			op:       func() error { return l.MoveTag("v1", b) },
+			expected: "latest@=b v1@=b",
+		},
+		{
+			// one descriptor per platform
+			op:       func() error { return l.AddTag("multi", arm64) },
+			expected: "latest@=b multi@linux/arm64=b v1@=b",
+		},
+		{
+			op:       func() error { return l.AddTag("multi", amd64) },
+			expected: "latest@=b multi@linux/amd64=a multi@linux/arm64=b v1@=b",
+		},
+		{
+			op: func() error {
+				desc := b
+				desc.Platform = &v1.Platform{OS: "linux", Architecture: "x86_64"}
+				return l.AddTag("multi", desc)
+			},
+			cause:    ErrTagConflict,
+			expected: "latest@=b multi@linux/amd64=a multi@linux/arm64=b v1@=b",
+		},
+		{
+			op:       func() error { return l.DeleteTag("latest") },
+			expected: "multi@linux/amd64=a multi@linux/arm64=b v1@=b",
+		},
+		{
+			op:       func() error { return l.DeleteTag("latest") },
+			cause:    ErrRefNotFound,
+			expected: "multi@linux/amd64=a multi@linux/arm64=b v1@=b",
+		},
+		{
+			op:       func() error { return l.AddTag("v1..0", a) },
+			cause:    ErrInvalidRefName,
+			expected: "multi@linux/amd64=a multi@linux/arm64=b v1@=b",
+		},
+		{
+			op: func() error {
+				return l.AddTag("missing", v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("missing"), Size: 7})
+			},
+			cause:    ErrBlobNotFound,
+			expected: "multi@linux/amd64=a multi@linux/arm64=b v1@=b",
+		},
+		{
+			op: func() error {
+				desc := a
+				desc.Size++
+				return l.AddTag("wrong-size", desc)
+			},
+			cause:    ErrSizeMismatch,
+			expected: "multi@linux/amd64=a multi@linux/arm64=b v1@=b",
+		},
+	} {
+		if err := tt.op(); errors.Cause(err) != tt.cause {
+			t.Errorf("test %d: expected %v, got %v", i, tt.cause, err)
+		}
+		if s := tagNames(t, l, names); s != tt.expected {
+			t.Errorf("test %d: expected %q, got %q", i, tt.expected, s)
+		}
+	}
+
+	descs, err := l.ResolveTag("multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(descs) != 2 || descs[0].Digest != a.Digest || descs[1].Digest != b.Digest {
+		t.Errorf("unexpected descriptors %v", descs)
+	}
+	if _, err := l.ResolveTag("latest"); errors.Cause(err) != ErrRefNotFound {
+		t.Errorf("expected ErrRefNotFound, got %v", err)
+	}
+	checkLayout(t, l)
+}
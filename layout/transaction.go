@@ -0,0 +1,178 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/internal/fsutil"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// transactionPattern is the pattern of the names of the staging directories of transactions, at the root of the layout.
+const transactionPattern = ".tx-*"
+
+// ErrTransactionDone is returned for a transaction which was committed or rolled back already.
+var ErrTransactionDone = errors.New("transaction is done")
+
+// A Transaction stages blobs and updates of index.json, which Commit applies to the image layout
+// all at once, or not at all.
+// The staged blobs are written to a directory of the layout, invisible to its readers until committed.
+// A Transaction is not safe for concurrent use.
+type Transaction struct {
+	l       *Layout
+	dir     string
+	staged  *content.FileStore
+	updates []func(index *v1.Index) error
+	done    bool
+}
+
+// Begin starts a transaction. The caller must Commit or Rollback it.
+func (l *Layout) Begin() (*Transaction, error) {
+	dir, err := ioutil.TempDir(l.root, transactionPattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+	return &Transaction{l: l, dir: dir, staged: content.NewFileStore(dir)}, nil
+}
+
+// Writer stages a new blob, see content.Ingester.
+func (tx *Transaction) Writer(ctx context.Context, algorithm digest.Algorithm) (content.Writer, error) {
+	if tx.done {
+		return nil, ErrTransactionDone
+	}
+	return tx.staged.Writer(ctx, algorithm)
+}
+
+// WriteBlob stages the blob desc points to with the content of r, verified against desc.
+func (tx *Transaction) WriteBlob(r io.Reader, desc v1.Descriptor) error {
+	return content.WriteBlob(context.Background(), tx, r, desc)
+}
+
+// WriteBlobBytes stages a blob holding buf and returns its descriptor, with the media type mediaType.
+func (tx *Transaction) WriteBlobBytes(mediaType string, buf []byte) (v1.Descriptor, error) {
+	return content.WriteBlobBytes(context.Background(), tx, mediaType, buf)
+}
+
+// UpdateIndex stages update, which Commit calls with the image index of index.json,
+// after the updates staged before, see Layout.UpdateIndex.
+func (tx *Transaction) UpdateIndex(update func(index *v1.Index) error) {
+	tx.updates = append(tx.updates, update)
+}
+
+// Commit applies the transaction under the lock of the layout: it calls the staged updates,
+// moves the staged blobs to the blobs directory, then replaces index.json.
+// It fails without changing the layout if an update fails or if a descriptor added to index.json
+// points to a blob which is neither staged nor in the layout, or has another size.
+// The transaction is done afterwards, whether Commit succeeded or not.
+func (tx *Transaction) Commit(ctx context.Context) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	defer tx.Rollback()
+
+	unlock, err := tx.l.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index, err := tx.l.Index()
+	if err != nil {
+		return err
+	}
+	before := make(map[digest.Digest]bool, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		before[desc.Digest] = true
+	}
+	for _, update := range tx.updates {
+		if err := update(&index); err != nil {
+			return err
+		}
+	}
+
+	// the blobs are checked before any is moved, so that a failed commit leaves the layout unchanged
+	for _, desc := range index.Manifests {
+		if before[desc.Digest] {
+			continue
+		}
+		info, err := tx.staged.Info(ctx, desc.Digest)
+		if errors.Cause(err) == content.ErrNotFound {
+			info, err = tx.l.blobs.Info(ctx, desc.Digest)
+		}
+		if err != nil {
+			return err
+		}
+		if info.Size != desc.Size {
+			return errors.Wrapf(ErrSizeMismatch, "blob %s has size %d, the descriptor %d", desc.Digest, info.Size, desc.Size)
+		}
+	}
+
+	if err := tx.staged.Walk(ctx, func(info content.Info) error {
+		return tx.moveBlob(info.Digest)
+	}); err != nil {
+		return err
+	}
+	return tx.l.writeIndex(index)
+}
+
+// newMarker returns a marker of the staged blobs and those of the layout, without marked blobs.
+func (tx *Transaction) newMarker() *marker {
+	m := newMarker(tx.l)
+	m.stores = []*content.FileStore{tx.staged, tx.l.blobs}
+	return m
+}
+
+// blobPath returns the path of the staged blob dgst.
+func (tx *Transaction) blobPath(dgst digest.Digest) (string, error) {
+	p, err := BlobPath(dgst)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(tx.dir, p), nil
+}
+
+// moveBlob moves the staged blob dgst to the blobs directory of the layout.
+func (tx *Transaction) moveBlob(dgst digest.Digest) error {
+	p, err := BlobPath(dgst)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(tx.l.root, p)
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "commit blob")
+	}
+	if err := os.Rename(filepath.Join(tx.dir, p), target); err != nil {
+		return errors.Wrap(err, "commit blob")
+	}
+	return fsutil.SyncDir(dir)
+}
+
+// Rollback discards the staged blobs and updates, unless the transaction is done already.
+func (tx *Transaction) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	return errors.Wrap(os.RemoveAll(tx.dir), "roll back transaction")
+}
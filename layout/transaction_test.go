@@ -0,0 +1,353 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// tagImage returns an index update adding desc named refName.
+func tagImage(desc v1.Descriptor, refName string) func(index *v1.Index) error {
+	desc.Annotations = map[string]string{v1.AnnotationRefName: refName}
+	return func(index *v1.Index) error {
+		index.Manifests = append(index.Manifests, desc)
+		return nil
+	}
+}
+
+// commitImages commits n transactions to the image layout in root, each adding an image named prefix-i.
+func commitImages(root, prefix string, n int) error {
+	l, err := Open(root)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		tx, err := l.Begin()
+		if err != nil {
+			return err
+		}
+		refName := fmt.Sprintf("%s-%d", prefix, i)
+		desc, err := tx.WriteBlobBytes(v1.MediaTypeImageManifest, []byte(`{"schemaVersion":2,"name":"`+refName+`"}`))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		tx.UpdateIndex(tagImage(desc, refName))
+		if err := tx.Commit(context.Background()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRefNames fails t unless the index.json of l names every prefix-i image, once.
+func checkRefNames(t *testing.T, l *Layout, prefixes []string, n int) {
+	t.Helper()
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := map[string]int{}
+	for _, desc := range index.Manifests {
+		count[desc.Annotations[v1.AnnotationRefName]]++
+	}
+	for _, prefix := range prefixes {
+		for i := 0; i < n; i++ {
+			refName := fmt.Sprintf("%s-%d", prefix, i)
+			if count[refName] != 1 {
+				t.Errorf("expected %s once, got %d", refName, count[refName])
+			}
+		}
+	}
+	if len(index.Manifests) != len(prefixes)*n {
+		t.Errorf("expected %d manifests, got %d", len(prefixes)*n, len(index.Manifests))
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := context.Background()
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := l.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := writeImage(t, tx, "staged")
+	tx.UpdateIndex(tagImage(desc, "v1"))
+	if ok, _ := l.HasBlob(desc.Digest); ok {
+		t.Error("a staged blob is visible before the commit")
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := refDescriptor(t, l, "v1"); !ok {
+		t.Error("expected v1 after the commit")
+	}
+	checkLayout(t, l)
+	if err := tx.Commit(ctx); err != ErrTransactionDone {
+		t.Errorf("expected ErrTransactionDone, got %v", err)
+	}
+
+	failure := errors.New("failure")
+	for i, tt := range []struct {
+		stage func(tx *Transaction)
+		abort func(tx *Transaction) error
+		cause error
+	}{
+		{
+			stage: func(tx *Transaction) { tx.UpdateIndex(tagImage(writeImage(t, tx, "rolled back"), "v2")) },
+			abort: func(tx *Transaction) error { return tx.Rollback() },
+		},
+		{
+			stage: func(tx *Transaction) {
+				tx.UpdateIndex(tagImage(writeImage(t, tx, "failed"), "v2"))
+				tx.UpdateIndex(func(*v1.Index) error { return failure })
+			},
+			abort: func(tx *Transaction) error { return tx.Commit(ctx) },
+			cause: failure,
+		},
+		{
+			stage: func(tx *Transaction) {
+				tx.UpdateIndex(tagImage(v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("missing"), Size: 7}, "v2"))
+			},
+			abort: func(tx *Transaction) error { return tx.Commit(ctx) },
+			cause: ErrBlobNotFound,
+		},
+		{
+			// the staged blobs are not moved either
+			stage: func(tx *Transaction) {
+				writeImage(t, tx, "unreferenced")
+				desc := writeImage(t, tx, "wrong size")
+				desc.Size++
+				tx.UpdateIndex(tagImage(desc, "v2"))
+			},
+			abort: func(tx *Transaction) error { return tx.Commit(ctx) },
+			cause: ErrSizeMismatch,
+		},
+	} {
+		var blobs int
+		if err := l.blobs.Walk(ctx, func(content.Info) error {
+			blobs++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		before, dgst, err := l.ReadIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := l.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.stage(tx)
+		if err := tt.abort(tx); errors.Cause(err) != tt.cause {
+			t.Errorf("test %d: expected %v, got %v", i, tt.cause, err)
+		}
+		if _, after, _ := l.ReadIndex(); after != dgst {
+			t.Errorf("test %d: index.json changed from %v", i, before)
+		}
+		if _, err := os.Stat(tx.dir); !os.IsNotExist(err) {
+			t.Errorf("test %d: the staging directory was left", i)
+		}
+		after := 0
+		if err := l.blobs.Walk(ctx, func(content.Info) error {
+			after++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if after != blobs {
+			t.Errorf("test %d: expected %d blobs in the layout, got %d", i, blobs, after)
+		}
+	}
+	checkLayout(t, l)
+}
+
+func TestReplaceIndex(t *testing.T) {
+	ctx := context.Background()
+	l, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := writeImage(t, l, "a")
+
+	index, dgst, err := l.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tagImage(desc, "v1")(&index); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ReplaceIndex(ctx, index, dgst); err != nil {
+		t.Fatal(err)
+	}
+	if err := tagImage(desc, "v2")(&index); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ReplaceIndex(ctx, index, dgst); errors.Cause(err) != ErrIndexChanged {
+		t.Errorf("expected ErrIndexChanged, got %v", err)
+	}
+	if _, ok := refDescriptor(t, l, "v2"); ok {
+		t.Error("a stale index replaced index.json")
+	}
+}
+
+func TestLock(t *testing.T) {
+	root := t.TempDir()
+	l, err := Init(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := l.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := other.Lock(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the lock to be held, got %v", err)
+	}
+	// waiting for another goroutine of the same process can be cancelled too
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Lock(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the lock to be held within the process, got %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = other.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestTransactionsConcurrently(t *testing.T) {
+	root := t.TempDir()
+	l, err := Init(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, n = 8, 10
+	var prefixes []string
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		prefix := fmt.Sprintf("goroutine%d", i)
+		prefixes = append(prefixes, prefix)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every writer has its own Layout, so that only the lock file serializes them
+			if err := commitImages(root, prefix, n); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	checkRefNames(t, l, prefixes, n)
+}
+
+// writerEnv is the environment variable running TestWriterProcess as a writer of the image layout it holds.
+const writerEnv = "LAYOUT_TEST_WRITER_ROOT"
+
+// TestWriterProcess is the writer process of TestTransactionsInProcesses.
+func TestWriterProcess(t *testing.T) {
+	root := os.Getenv(writerEnv)
+	if root == "" {
+		t.Skip("not a writer process")
+	}
+	n, err := strconv.Atoi(os.Getenv(writerEnv + "_N"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := commitImages(root, os.Getenv(writerEnv+"_PREFIX"), n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionsInProcesses(t *testing.T) {
+	if os.Getenv(writerEnv) != "" {
+		t.Skip("in a writer process")
+	}
+	root := t.TempDir()
+	l, err := Init(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, n = 4, 10
+	var prefixes []string
+	var cmds []*exec.Cmd
+	for i := 0; i < writers; i++ {
+		prefix := fmt.Sprintf("process%d", i)
+		prefixes = append(prefixes, prefix)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestWriterProcess$")
+		cmd.Env = append(os.Environ(),
+			writerEnv+"="+root,
+			writerEnv+"_PREFIX="+prefix,
+			writerEnv+"_N="+strconv.Itoa(n),
+		)
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("writer process: %v", err)
+		}
+	}
+	checkRefNames(t, l, prefixes, n)
+
+	staging, err := filepath.Glob(filepath.Join(root, transactionPattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staging) > 0 {
+		t.Errorf("staging directories were left: %v", staging)
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(root, BlobsDir, "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != writers*n {
+		t.Errorf("expected %d blobs, got %d", writers*n, len(entries))
+	}
+}
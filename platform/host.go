@@ -0,0 +1,73 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var (
+	hostOnce sync.Once
+	host     v1.Platform
+)
+
+// Host returns the normalized platform of the running program.
+// On linux/arm, the variant is read from /proc/cpuinfo; elsewhere the default variant is assumed.
+// The os.version and os.features are not detected, callers set them to match windows images.
+func Host() v1.Platform {
+	hostOnce.Do(func() {
+		variant := ""
+		if runtime.GOOS == "linux" && runtime.GOARCH == "arm" {
+			if f, err := os.Open("/proc/cpuinfo"); err == nil {
+				variant = cpuinfoVariant(f)
+				f.Close()
+			}
+		}
+		host = Normalize(v1.Platform{
+			OS:           runtime.GOOS,
+			Architecture: runtime.GOARCH,
+			Variant:      variant,
+		})
+	})
+	return host
+}
+
+// cpuinfoVariant returns the arm variant of the "CPU architecture" line of a /proc/cpuinfo file, or "" if there is none.
+func cpuinfoVariant(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(key) != "CPU architecture" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if isDigits(value) {
+			return "v" + value
+		}
+		// e.g. "AArch64" on arm64 kernels running 32-bit programs
+		if strings.EqualFold(value, "aarch64") {
+			return "v8"
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,262 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"strconv"
+	"strings"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// A Matcher decides whether a platform is acceptable, typically whether it runs on a host.
+type Matcher interface {
+	Match(p v1.Platform) bool
+}
+
+// A MatchComparer is a Matcher which also orders the platforms by preference.
+type MatchComparer interface {
+	Matcher
+
+	// Less reports whether a is preferred over b.
+	// Matched platforms are preferred over the others.
+	Less(a, b v1.Platform) bool
+}
+
+// defaultVariants holds the variant assumed when an architecture has none.
+var defaultVariants = map[string]string{
+	"amd64":   "v1",
+	"arm":     "v7",
+	"arm64":   "v8",
+	"ppc64le": "power8",
+	"riscv64": "rva20u64",
+}
+
+// compatibleArchitecture is an architecture a host also runs, up to a variant level.
+type compatibleArchitecture struct {
+	architecture string
+	maxLevel     int
+}
+
+// compatibleArchitectures maps an architecture to the other architectures it runs, most preferred first.
+var compatibleArchitectures = map[string][]compatibleArchitecture{
+	"amd64": {{"386", 0}},
+	"arm64": {{"arm", 800}},
+}
+
+// NewMatcher returns a MatchComparer matching the platforms which run on host:
+//
+//   - the os is the one of host,
+//   - the architecture is the one of host, with a variant up to the one of host, e.g. arm/v6 on an arm/v7 host,
+//     or one host runs too, i.e. 386 on amd64 and arm up to v8 on arm64,
+//   - the os.features are os.features of host,
+//   - on windows, if both os.version are set, they are the same build, e.g. 10.0.17763.
+//
+// It prefers the architecture of host, then the highest variant, then the os.version of host
+// followed by the highest revision of its build.
+func NewMatcher(host v1.Platform) MatchComparer {
+	return &hostMatcher{host: Normalize(host)}
+}
+
+// Default returns the MatchComparer of the platforms which run on the host, see Host and NewMatcher.
+func Default() MatchComparer {
+	return NewMatcher(Host())
+}
+
+// Best returns the index of the candidate m matches which m prefers, or -1 if m matches none of candidates.
+// The first one wins among equally preferred candidates.
+func Best(m MatchComparer, candidates []v1.Platform) int {
+	best := -1
+	for i, candidate := range candidates {
+		if !m.Match(candidate) {
+			continue
+		}
+		if best < 0 || m.Less(candidate, candidates[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+type hostMatcher struct {
+	host v1.Platform
+}
+
+// rank orders the platforms matched by a hostMatcher, lower is preferred.
+type rank struct {
+	architecture int // index in compatibleArchitectures, plus one, 0 for the architecture of the host
+	level        int
+	osVersion    int // 0 for the os.version of the host, 1 otherwise
+	revision     int
+}
+
+func (a rank) less(b rank) bool {
+	switch {
+	case a.architecture != b.architecture:
+		return a.architecture < b.architecture
+	case a.level != b.level:
+		return a.level > b.level
+	case a.osVersion != b.osVersion:
+		return a.osVersion < b.osVersion
+	}
+	return a.revision > b.revision
+}
+
+func (m *hostMatcher) Match(p v1.Platform) bool {
+	_, ok := m.rank(p)
+	return ok
+}
+
+func (m *hostMatcher) Less(a, b v1.Platform) bool {
+	ra, oka := m.rank(a)
+	rb, okb := m.rank(b)
+	if oka != okb {
+		return oka
+	}
+	return ra.less(rb)
+}
+
+// rank returns the rank of p, and whether p runs on the host.
+func (m *hostMatcher) rank(p v1.Platform) (rank, bool) {
+	var r rank
+
+	p = Normalize(p)
+	if p.OS != m.host.OS {
+		return r, false
+	}
+
+	if p.Architecture == m.host.Architecture {
+		level, ok := variantLevel(p.Architecture, p.Variant)
+		hostLevel, hostOK := variantLevel(m.host.Architecture, m.host.Variant)
+		switch {
+		case !ok || !hostOK:
+			// variants of unknown format only match themselves
+			if p.Variant != m.host.Variant {
+				return r, false
+			}
+		case level > hostLevel:
+			return r, false
+		}
+		r.level = level
+	} else {
+		r.architecture = -1
+		for i, compatible := range compatibleArchitectures[m.host.Architecture] {
+			if compatible.architecture != p.Architecture {
+				continue
+			}
+			level, ok := variantLevel(p.Architecture, p.Variant)
+			if ok && level <= compatible.maxLevel {
+				r.architecture, r.level = i+1, level
+			}
+			break
+		}
+		if r.architecture < 0 {
+			return r, false
+		}
+	}
+
+	if p.OS == "windows" && p.OSVersion != "" && m.host.OSVersion != "" {
+		if windowsBuild(p.OSVersion) != windowsBuild(m.host.OSVersion) {
+			return r, false
+		}
+		if p.OSVersion != m.host.OSVersion {
+			r.osVersion = 1
+		}
+		r.revision = windowsRevision(p.OSVersion)
+	}
+
+	for _, feature := range p.OSFeatures {
+		if !contains(m.host.OSFeatures, feature) {
+			return r, false
+		}
+	}
+
+	return r, true
+}
+
+// variantLevel returns the level of variant, e.g. 802 for arm64/v8.2,
+// and whether variant has a known format.
+// The empty variant is the default variant of architecture.
+func variantLevel(architecture, variant string) (int, bool) {
+	if variant == "" {
+		variant = defaultVariants[architecture]
+		if variant == "" {
+			return 0, true
+		}
+	}
+
+	var version string
+	switch architecture {
+	case "amd64", "arm", "arm64":
+		if !strings.HasPrefix(variant, "v") {
+			return 0, false
+		}
+		version = variant[1:]
+	case "ppc64", "ppc64le":
+		if !strings.HasPrefix(variant, "power") {
+			return 0, false
+		}
+		version = variant[5:]
+	case "riscv64":
+		if !strings.HasPrefix(variant, "rva") || !strings.HasSuffix(variant, "u64") {
+			return 0, false
+		}
+		version = strings.TrimSuffix(variant[3:], "u64")
+	default:
+		return 0, false
+	}
+
+	major, minor := version, "0"
+	if i := strings.IndexByte(version, '.'); i >= 0 {
+		major, minor = version[:i], version[i+1:]
+	}
+	if !isDigits(major) || !isDigits(minor) {
+		return 0, false
+	}
+	ma, _ := strconv.Atoi(major)
+	mi, _ := strconv.Atoi(minor)
+	if mi > 99 {
+		return 0, false
+	}
+	return ma*100 + mi, true
+}
+
+// windowsBuild returns the major.minor.build prefix of a windows os.version.
+func windowsBuild(version string) string {
+	parts := strings.SplitN(version, ".", 4)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return strings.Join(parts, ".")
+}
+
+// windowsRevision returns the revision of a windows os.version, the number after its build.
+func windowsRevision(version string) int {
+	parts := strings.SplitN(version, ".", 4)
+	if len(parts) < 4 {
+		return 0
+	}
+	revision, _ := strconv.Atoi(parts[3])
+	return revision
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidPlatform is returned by Parse for a malformed platform specifier.
+var ErrInvalidPlatform = errors.New("invalid platform")
+
+var (
+	// componentRegexp matches the os, architecture and variant components of a platform specifier.
+	componentRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// osVersionRegexp matches the os component of a platform specifier with its os.version, e.g. windows(10.0.17763).
+	osVersionRegexp = regexp.MustCompile(`^([A-Za-z0-9_.-]+)\(([A-Za-z0-9_.-]+)\)$`)
+)
+
+// Parse parses a platform specifier of the form os[(os.version)][/architecture[/variant]],
+// e.g. "linux/arm64/v8" or "windows(10.0.17763.1)/amd64", and returns the normalized platform.
+// If the architecture is omitted, it is the one of the host.
+func Parse(specifier string) (v1.Platform, error) {
+	var p v1.Platform
+
+	parts := strings.Split(specifier, "/")
+	if len(parts) > 3 {
+		return p, errors.Wrapf(ErrInvalidPlatform, "%q has more than 3 components", specifier)
+	}
+
+	if m := osVersionRegexp.FindStringSubmatch(parts[0]); m != nil {
+		p.OS, p.OSVersion = m[1], m[2]
+	} else {
+		p.OS = parts[0]
+	}
+	if len(parts) > 1 {
+		p.Architecture = parts[1]
+	} else {
+		host := Host()
+		p.Architecture, p.Variant = host.Architecture, host.Variant
+	}
+	if len(parts) > 2 {
+		p.Variant = parts[2]
+	}
+
+	for _, component := range []string{p.OS, p.Architecture} {
+		if !componentRegexp.MatchString(component) {
+			return p, errors.Wrapf(ErrInvalidPlatform, "%q has an invalid component %q", specifier, component)
+		}
+	}
+	if len(parts) > 2 && !componentRegexp.MatchString(p.Variant) {
+		return p, errors.Wrapf(ErrInvalidPlatform, "%q has an invalid component %q", specifier, p.Variant)
+	}
+
+	return Normalize(p), nil
+}
+
+// Format returns the platform specifier of p, the reverse of Parse.
+// os.features are not part of platform specifiers and are ignored.
+func Format(p v1.Platform) string {
+	s := p.OS
+	if p.OSVersion != "" {
+		s += "(" + p.OSVersion + ")"
+	}
+	s += "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Normalize returns p with the os, architecture and variant spelled the way OCI images use them,
+// e.g. aarch64 becomes arm64 and armhf becomes arm/v7, and its os.features sorted.
+// The default variant of an architecture is the empty variant, except for arm whose default is v7.
+func Normalize(p v1.Platform) v1.Platform {
+	p.OS = strings.ToLower(p.OS)
+	if p.OS == "macos" {
+		p.OS = "darwin"
+	}
+	p.Architecture, p.Variant = normalizeArchitecture(strings.ToLower(p.Architecture), strings.ToLower(p.Variant))
+	if p.OSFeatures != nil {
+		features := make([]string, len(p.OSFeatures))
+		copy(features, p.OSFeatures)
+		sort.Strings(features)
+		p.OSFeatures = features
+	}
+	return p
+}
+
+// normalizeArchitecture returns the normalized architecture and variant.
+func normalizeArchitecture(architecture, variant string) (string, string) {
+	if isDigits(variant) {
+		variant = "v" + variant
+	}
+
+	switch architecture {
+	case "i386", "i486", "i586", "i686", "x86":
+		return "386", ""
+	case "x86_64", "x86-64", "amd64":
+		if variant == "v1" {
+			variant = ""
+		}
+		return "amd64", variant
+	case "aarch64", "arm64":
+		if variant == "v8" || variant == "v8.0" {
+			variant = ""
+		}
+		return "arm64", variant
+	case "armhf":
+		return "arm", "v7"
+	case "armel":
+		return "arm", "v6"
+	case "armv5l", "armv6l", "armv7l", "armv8l":
+		return "arm", architecture[3:5]
+	case "arm":
+		if variant == "" {
+			variant = "v7"
+		}
+		return "arm", variant
+	case "ppc64el":
+		return "ppc64le", variant
+	case "loongarch64":
+		return "loong64", variant
+	}
+	return architecture, variant
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected string // formatted platform, "" if the input is invalid
+	}{
+		{input: "linux/amd64", expected: "linux/amd64"},
+		{input: "Linux/x86_64", expected: "linux/amd64"},
+		{input: "linux/amd64/v3", expected: "linux/amd64/v3"},
+		{input: "linux/aarch64", expected: "linux/arm64"},
+		{input: "linux/arm64/v8", expected: "linux/arm64"},
+		{input: "linux/arm64/v8.2", expected: "linux/arm64/v8.2"},
+		{input: "linux/armhf", expected: "linux/arm/v7"},
+		{input: "linux/armel", expected: "linux/arm/v6"},
+		{input: "linux/arm", expected: "linux/arm/v7"},
+		{input: "linux/arm/6", expected: "linux/arm/v6"},
+		{input: "linux/armv7l", expected: "linux/arm/v7"},
+		{input: "linux/i686", expected: "linux/386"},
+		{input: "linux/ppc64el", expected: "linux/ppc64le"},
+		{input: "macos/arm64", expected: "darwin/arm64"},
+		{input: "windows(10.0.17763.1)/amd64", expected: "windows(10.0.17763.1)/amd64"},
+		{input: "linux", expected: Format(v1.Platform{OS: "linux", Architecture: Host().Architecture, Variant: Host().Variant})},
+		{input: ""},
+		{input: "linux/"},
+		{input: "linux/amd64/"},
+		{input: "linux/amd64/v3/extra"},
+		{input: "linux os/amd64"},
+		{input: "windows(10.0/amd64"},
+	} {
+		p, err := Parse(tc.input)
+		if tc.expected == "" {
+			if errors.Cause(err) != ErrInvalidPlatform {
+				t.Errorf("%q: expected ErrInvalidPlatform, got %v", tc.input, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if Format(p) != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, Format(p))
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		host       string
+		candidates []string
+		matches    string // candidates matched, in order of preference
+	}{
+		{
+			host:       "linux/arm/v7",
+			candidates: []string{"linux/arm/v5", "linux/arm/v8", "linux/arm/v6", "linux/arm64", "windows/arm/v7"},
+			matches:    "linux/arm/v6 linux/arm/v5",
+		},
+		{
+			host:       "linux/arm64",
+			candidates: []string{"linux/arm/v7", "linux/arm64/v8.2", "linux/arm64", "linux/amd64", "linux/arm/v6"},
+			matches:    "linux/arm64 linux/arm/v7 linux/arm/v6",
+		},
+		{
+			host:       "linux/arm64/v9",
+			candidates: []string{"linux/arm64/v8.2", "linux/arm64/v9.1", "linux/arm64", "linux/arm64/v9"},
+			matches:    "linux/arm64/v9 linux/arm64/v8.2 linux/arm64",
+		},
+		{
+			host:       "linux/amd64/v3",
+			candidates: []string{"linux/386", "linux/amd64", "linux/amd64/v4", "linux/amd64/v2"},
+			matches:    "linux/amd64/v2 linux/amd64 linux/386",
+		},
+		{
+			host:       "windows(10.0.17763.1000)/amd64",
+			candidates: []string{"windows(10.0.20348.1)/amd64", "windows(10.0.17763.100)/amd64", "windows(10.0.17763.1000)/amd64", "windows(10.0.17763.2000)/amd64"},
+			matches:    "windows(10.0.17763.1000)/amd64 windows(10.0.17763.2000)/amd64 windows(10.0.17763.100)/amd64",
+		},
+	} {
+		host, err := Parse(tc.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := NewMatcher(host)
+
+		var candidates []v1.Platform
+		for _, c := range tc.candidates {
+			p, err := Parse(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			candidates = append(candidates, p)
+		}
+
+		var matches []string
+		for len(candidates) > 0 {
+			best := Best(m, candidates)
+			if best < 0 {
+				break
+			}
+			matches = append(matches, Format(candidates[best]))
+			candidates = append(candidates[:best], candidates[best+1:]...)
+		}
+		if got := strings.Join(matches, " "); got != tc.matches {
+			t.Errorf("%s: expected matches %q, got %q", tc.host, tc.matches, got)
+		}
+	}
+
+	windows := NewMatcher(v1.Platform{OS: "windows", Architecture: "amd64", OSFeatures: []string{"win32k"}})
+	if !windows.Match(v1.Platform{OS: "windows", Architecture: "amd64", OSFeatures: []string{"win32k"}}) {
+		t.Errorf("expected the win32k feature to match")
+	}
+	nano := NewMatcher(v1.Platform{OS: "windows", Architecture: "amd64"})
+	if nano.Match(v1.Platform{OS: "windows", Architecture: "amd64", OSFeatures: []string{"win32k"}}) {
+		t.Errorf("expected the win32k feature not to match a host without it")
+	}
+}
+
+func TestHost(t *testing.T) {
+	host := Host()
+	if host.OS != runtime.GOOS || !Default().Match(host) {
+		t.Errorf("unexpected host platform %v", host)
+	}
+
+	for cpuinfo, expected := range map[string]string{
+		"processor\t: 0\nCPU architecture: 7\nCPU variant\t: 0x0\n": "v7",
+		"CPU architecture: AArch64\n":                               "v8",
+		"processor\t: 0\n":                                          "",
+	} {
+		if variant := cpuinfoVariant(strings.NewReader(cpuinfo)); variant != expected {
+			t.Errorf("%q: expected variant %q, got %q", cpuinfo, expected, variant)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package platform describes the platforms, i.e. combinations of operating system,
+// CPU architecture and variant, OCI images are built for.
+package platform
+
+import (
+	"sort"
+	"sync"
+)
+
+// builtinArchitectures maps the known operating systems to their architectures,
+// following the GOOS/GOARCH values of the Go toolchain.
+var builtinArchitectures = map[string][]string{
+	"aix":       {"ppc64"},
+	"android":   {"386", "amd64", "arm", "arm64"},
+	"darwin":    {"386", "amd64", "arm", "arm64"},
+	"dragonfly": {"amd64"},
+	"freebsd":   {"386", "amd64", "arm", "arm64", "riscv64"},
+	"illumos":   {"amd64"},
+	"ios":       {"amd64", "arm64"},
+	"js":        {"wasm"},
+	"linux":     {"386", "amd64", "arm", "arm64", "loong64", "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le", "riscv64", "s390x"},
+	"netbsd":    {"386", "amd64", "arm", "arm64"},
+	"openbsd":   {"386", "amd64", "arm", "arm64", "ppc64", "riscv64"},
+	"plan9":     {"386", "amd64", "arm"},
+	"solaris":   {"amd64"},
+	"wasi":      {"wasm"},
+	"wasip1":    {"wasm"},
+	"windows":   {"386", "amd64", "arm", "arm64"},
+}
+
+// builtinVariants maps the known architectures to their variants.
+// The empty variant means the variant may be omitted.
+var builtinVariants = map[string][]string{
+	"386":      {""},
+	"amd64":    {"", "v1", "v2", "v3", "v4"},
+	"arm":      {"", "v5", "v6", "v7", "v8"},
+	"arm64":    {"", "v8", "v8.0", "v8.1", "v8.2", "v8.3", "v8.4", "v8.5", "v8.6", "v8.7", "v8.8", "v8.9", "v9", "v9.0", "v9.1", "v9.2", "v9.3", "v9.4", "v9.5"},
+	"loong64":  {""},
+	"mips":     {""},
+	"mipsle":   {""},
+	"mips64":   {""},
+	"mips64le": {""},
+	"ppc64":    {"", "power8", "power9", "power10"},
+	"ppc64le":  {"", "power8", "power9", "power10"},
+	"riscv64":  {"", "rva20u64", "rva22u64"},
+	"s390x":    {""},
+	"wasm":     {""},
+}
+
+// A Registry is a table of the known operating systems, the architectures
+// each of them runs on, and the variants of each architecture.
+// The zero value is an empty Registry, while NewRegistry returns one holding the built-in platforms.
+// It is safe for concurrent use.
+type Registry struct {
+	mu            sync.RWMutex
+	architectures map[string]map[string]bool
+	variants      map[string]map[string]bool
+}
+
+// NewRegistry returns a Registry holding the built-in platforms,
+// which callers may extend with AddOS and AddArchitecture.
+func NewRegistry() *Registry {
+	r := &Registry{}
+	for arch, variants := range builtinVariants {
+		r.AddArchitecture(arch, variants...)
+	}
+	for os, archs := range builtinArchitectures {
+		r.AddOS(os, archs...)
+	}
+	return r
+}
+
+// init allocates the maps of a zero Registry. r.mu must be held for writing.
+func (r *Registry) init() {
+	if r.architectures == nil {
+		r.architectures = map[string]map[string]bool{}
+	}
+	if r.variants == nil {
+		r.variants = map[string]map[string]bool{}
+	}
+}
+
+// AddOS adds os and the architectures it runs on to r.
+// An architecture which is not known yet is added without variants.
+func (r *Registry) AddOS(os string, architectures ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.init()
+
+	archs := r.architectures[os]
+	if archs == nil {
+		archs = map[string]bool{}
+		r.architectures[os] = archs
+	}
+	for _, arch := range architectures {
+		archs[arch] = true
+		if r.variants[arch] == nil {
+			r.variants[arch] = map[string]bool{"": true}
+		}
+	}
+}
+
+// AddArchitecture adds architecture and its variants to r.
+// The empty variant allows the variant to be omitted.
+func (r *Registry) AddArchitecture(architecture string, variants ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.init()
+
+	known := r.variants[architecture]
+	if known == nil {
+		known = map[string]bool{}
+		r.variants[architecture] = known
+	}
+	for _, variant := range variants {
+		known[variant] = true
+	}
+}
+
+// OSes returns the known operating systems, sorted.
+func (r *Registry) OSes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	oses := make([]string, 0, len(r.architectures))
+	for os := range r.architectures {
+		oses = append(oses, os)
+	}
+	sort.Strings(oses)
+	return oses
+}
+
+// Architectures returns the architectures os runs on, sorted.
+func (r *Registry) Architectures(os string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return sortedKeys(r.architectures[os])
+}
+
+// Variants returns the variants of architecture, sorted.
+// The empty variant is first if the variant may be omitted.
+func (r *Registry) Variants(architecture string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return sortedKeys(r.variants[architecture])
+}
+
+// HasOS reports whether os is known.
+func (r *Registry) HasOS(os string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.architectures[os]
+	return ok
+}
+
+// HasArchitecture reports whether architecture is known.
+func (r *Registry) HasArchitecture(architecture string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.variants[architecture]
+	return ok
+}
+
+// Supports reports whether os is known to run on architecture.
+func (r *Registry) Supports(os, architecture string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.architectures[os][architecture]
+}
+
+// SupportsVariant reports whether variant is a known variant of architecture.
+func (r *Registry) SupportsVariant(architecture, variant string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.variants[architecture][variant]
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
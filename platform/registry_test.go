@@ -0,0 +1,71 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	if !r.Supports("linux", "riscv64") || !r.Supports("linux", "loong64") || !r.Supports("js", "wasm") {
+		t.Errorf("expected the modern linux and wasm platforms to be supported")
+	}
+	if r.Supports("plan9", "s390x") {
+		t.Errorf("expected plan9/s390x not to be supported")
+	}
+	for _, variant := range []string{"", "v8", "v8.2", "v9", "v9.5"} {
+		if !r.SupportsVariant("arm64", variant) {
+			t.Errorf("expected arm64 variant %q to be supported", variant)
+		}
+	}
+	if r.SupportsVariant("arm64", "v7") || r.SupportsVariant("amd64", "v5") {
+		t.Errorf("expected arm64/v7 and amd64/v5 not to be supported")
+	}
+	if expected := []string{"", "v1", "v2", "v3", "v4"}; !reflect.DeepEqual(r.Variants("amd64"), expected) {
+		t.Errorf("expected amd64 variants %v, got %v", expected, r.Variants("amd64"))
+	}
+
+	r.AddOS("acmeos", "amd64", "acme64")
+	r.AddArchitecture("acme64", "gen2")
+	if !r.HasOS("acmeos") || !r.Supports("acmeos", "amd64") || !r.Supports("acmeos", "acme64") {
+		t.Errorf("expected acmeos to be added")
+	}
+	if expected := []string{"", "gen2"}; !reflect.DeepEqual(r.Variants("acme64"), expected) {
+		t.Errorf("expected acme64 variants %v, got %v", expected, r.Variants("acme64"))
+	}
+	if expected := []string{"acme64", "amd64"}; !reflect.DeepEqual(r.Architectures("acmeos"), expected) {
+		t.Errorf("expected acmeos architectures %v, got %v", expected, r.Architectures("acmeos"))
+	}
+
+	// registries are independent of each other
+	if NewRegistry().HasOS("acmeos") || NewRegistry().HasArchitecture("acme64") {
+		t.Errorf("expected a new registry to hold the built-in platforms only")
+	}
+}
+
+func TestRegistryZeroValue(t *testing.T) {
+	var r Registry
+	if len(r.OSes()) != 0 || r.Supports("linux", "amd64") {
+		t.Errorf("expected an empty registry, got %v", r.OSes())
+	}
+	r.AddArchitecture("acme64", "gen2")
+	r.AddOS("acmeos", "acme64")
+	if !r.Supports("acmeos", "acme64") || !r.SupportsVariant("acme64", "gen2") {
+		t.Errorf("expected acmeos/acme64/gen2 to be added")
+	}
+}
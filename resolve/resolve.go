@@ -0,0 +1,357 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package resolve selects the image manifest of an image index which suits a platform.
+package resolve
+
+import (
+	"context"
+	_ "crypto/sha256" // side-effect to install impls, sha256
+	_ "crypto/sha512" // side-effect to install impls, sha384/sh512
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/opencontainers/image-spec/platform"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// ErrNoMatch is the cause of the *NoMatchError returned when no manifest is selected.
+var ErrNoMatch = errors.New("no matching manifest")
+
+// DefaultMaxDepth is the depth of nested indexes a Resolver follows when MaxDepth is zero.
+const DefaultMaxDepth = 8
+
+// A Fetcher reads the content a descriptor points to.
+type Fetcher interface {
+	Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error)
+}
+
+// FetcherFunc adapts a function to a Fetcher.
+type FetcherFunc func(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error)
+
+// Fetch calls f(ctx, desc).
+func (f FetcherFunc) Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	return f(ctx, desc)
+}
+
+// Fallback decides what a Resolver selects when no manifest matches the platform.
+type Fallback int
+
+const (
+	// FallbackUnspecified selects a manifest without platform, the way container runtimes do.
+	FallbackUnspecified Fallback = iota
+
+	// FallbackNone selects nothing: manifests without platform never match.
+	FallbackNone
+
+	// FallbackFirst selects a manifest without platform, or else the first manifest whose platform does not match.
+	FallbackFirst
+)
+
+// Reason is the reason a manifest was rejected.
+type Reason string
+
+// Reasons for rejecting a manifest.
+const (
+	// ReasonRefName is given for a descriptor whose org.opencontainers.image.ref.name annotation is not the requested one.
+	ReasonRefName Reason = "ref-name"
+
+	// ReasonMediaType is given for a descriptor which is neither an image manifest nor an image index.
+	ReasonMediaType Reason = "media-type"
+
+	// ReasonPlatform is given for a descriptor whose platform does not match.
+	ReasonPlatform Reason = "platform"
+
+	// ReasonNoPlatform is given for a descriptor without platform when the fallback policy excludes them.
+	ReasonNoPlatform Reason = "no-platform"
+
+	// ReasonNotPreferred is given for a matching descriptor when a preferred one was selected.
+	ReasonNotPreferred Reason = "not-preferred"
+
+	// ReasonFetch is given for a nested index which could not be read.
+	ReasonFetch Reason = "fetch"
+
+	// ReasonDepth is given for a nested index beyond the maximum depth.
+	ReasonDepth Reason = "depth"
+)
+
+// A Rejection explains why a descriptor was not selected.
+type Rejection struct {
+	// Descriptor is the rejected descriptor.
+	Descriptor v1.Descriptor
+
+	// Path lists the descriptors of the nested indexes holding Descriptor, outermost first.
+	Path []v1.Descriptor
+
+	Reason Reason
+
+	// Message is a human readable explanation.
+	Message string
+}
+
+func (r Rejection) String() string {
+	return fmt.Sprintf("%s: %s", r.Descriptor.Digest, r.Message)
+}
+
+// A NoMatchError is returned when a Resolver selects no manifest.
+type NoMatchError struct {
+	// Rejections explains why each descriptor was rejected.
+	Rejections []Rejection
+}
+
+func (e *NoMatchError) Error() string {
+	reasons := make([]string, 0, len(e.Rejections))
+	for _, r := range e.Rejections {
+		reasons = append(reasons, r.String())
+	}
+	if len(reasons) == 0 {
+		return ErrNoMatch.Error() + ": the index is empty"
+	}
+	return ErrNoMatch.Error() + ": " + strings.Join(reasons, "; ")
+}
+
+// Cause returns ErrNoMatch, so that errors.Cause(err) == ErrNoMatch.
+func (e *NoMatchError) Cause() error {
+	return ErrNoMatch
+}
+
+// A Result is the manifest selected by a Resolver.
+type Result struct {
+	// Descriptor is the descriptor of the selected image manifest.
+	Descriptor v1.Descriptor
+
+	// Path lists the descriptors of the nested indexes holding Descriptor, outermost first.
+	Path []v1.Descriptor
+
+	// Rejections explains why each other descriptor was not selected.
+	Rejections []Rejection
+}
+
+// A Resolver selects the image manifest of an image index which suits a platform.
+// The zero value selects the manifest for the host among the top-level descriptors.
+type Resolver struct {
+	// Matcher decides which platforms are acceptable, platform.Default() if nil.
+	// If it is a platform.MatchComparer, the preferred platform is selected,
+	// otherwise the first acceptable one.
+	Matcher platform.Matcher
+
+	// RefName, if not empty, restricts the top-level descriptors to those
+	// whose org.opencontainers.image.ref.name annotation is RefName.
+	RefName string
+
+	// Fallback decides what is selected when no platform matches.
+	Fallback Fallback
+
+	// Fetcher reads nested indexes. If nil, nested indexes are rejected.
+	Fetcher Fetcher
+
+	// MaxDepth bounds the depth of nested indexes, DefaultMaxDepth if zero.
+	MaxDepth int
+}
+
+// candidate is a descriptor which may be selected.
+type candidate struct {
+	desc v1.Descriptor
+	path []v1.Descriptor
+}
+
+// resolution holds the state of a single Resolve.
+type resolution struct {
+	*Resolver
+	matcher     platform.Matcher
+	matches     []candidate // manifests whose platform matches
+	unspecified []candidate // manifests without platform
+	unmatched   []candidate // manifests whose platform does not match
+	rejections  []Rejection
+}
+
+// Resolve selects the image manifest of index which suits the platform.
+// It returns a *NoMatchError if there is none.
+func (r *Resolver) Resolve(ctx context.Context, index v1.Index) (Result, error) {
+	s := &resolution{Resolver: r, matcher: r.Matcher}
+	if s.matcher == nil {
+		s.matcher = platform.Default()
+	}
+
+	if err := s.walk(ctx, index, nil); err != nil {
+		return Result{}, err
+	}
+
+	selected, ok := s.selectCandidate()
+	if !ok {
+		return Result{}, &NoMatchError{Rejections: s.rejections}
+	}
+	return Result{
+		Descriptor: selected.desc,
+		Path:       selected.path,
+		Rejections: s.rejections,
+	}, nil
+}
+
+// walk collects the candidates of index, whose nested indexes are path.
+func (s *resolution) walk(ctx context.Context, index v1.Index, path []v1.Descriptor) error {
+	for _, desc := range index.Manifests {
+		if len(path) == 0 && s.RefName != "" && desc.Annotations[v1.AnnotationRefName] != s.RefName {
+			s.reject(desc, path, ReasonRefName, fmt.Sprintf("ref.name %q is not %q", desc.Annotations[v1.AnnotationRefName], s.RefName))
+			continue
+		}
+
+		switch desc.MediaType {
+		case v1.MediaTypeImageManifest:
+			switch {
+			case desc.Platform == nil:
+				s.unspecified = append(s.unspecified, candidate{desc, path})
+			case s.matcher.Match(*desc.Platform):
+				s.matches = append(s.matches, candidate{desc, path})
+			default:
+				s.unmatched = append(s.unmatched, candidate{desc, path})
+			}
+		case v1.MediaTypeImageIndex:
+			if desc.Platform != nil && !s.matcher.Match(*desc.Platform) {
+				s.reject(desc, path, ReasonPlatform, fmt.Sprintf("platform %s does not match", platform.Format(*desc.Platform)))
+				continue
+			}
+			if err := s.walkNested(ctx, desc, path); err != nil {
+				return err
+			}
+		default:
+			s.reject(desc, path, ReasonMediaType, fmt.Sprintf("media type %q is neither an image manifest nor an image index", desc.MediaType))
+		}
+	}
+	return nil
+}
+
+// walkNested collects the candidates of the nested index desc.
+func (s *resolution) walkNested(ctx context.Context, desc v1.Descriptor, path []v1.Descriptor) error {
+	maxDepth := s.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if len(path) >= maxDepth {
+		s.reject(desc, path, ReasonDepth, fmt.Sprintf("nested index is deeper than %d", maxDepth))
+		return nil
+	}
+	for _, p := range path {
+		if p.Digest == desc.Digest {
+			s.reject(desc, path, ReasonDepth, "nested index refers to itself")
+			return nil
+		}
+	}
+	if s.Fetcher == nil {
+		s.reject(desc, path, ReasonFetch, "nested index cannot be read without a fetcher")
+		return nil
+	}
+
+	nested, err := s.fetchIndex(ctx, desc)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.reject(desc, path, ReasonFetch, err.Error())
+		return nil
+	}
+
+	nestedPath := make([]v1.Descriptor, len(path), len(path)+1)
+	copy(nestedPath, path)
+	return s.walk(ctx, nested, append(nestedPath, desc))
+}
+
+// fetchIndex reads and verifies the nested index desc.
+func (s *resolution) fetchIndex(ctx context.Context, desc v1.Descriptor) (v1.Index, error) {
+	var index v1.Index
+
+	if err := desc.Digest.Validate(); err != nil {
+		return index, errors.Wrap(err, "invalid digest")
+	}
+	rc, err := s.Fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return index, errors.Wrap(err, "fetch nested index")
+	}
+	defer rc.Close()
+
+	buf, err := ioutil.ReadAll(io.LimitReader(rc, desc.Size+1))
+	if err != nil {
+		return index, errors.Wrap(err, "read nested index")
+	}
+	if int64(len(buf)) != desc.Size {
+		return index, errors.Errorf("nested index size is not %d", desc.Size)
+	}
+	if desc.Digest.Algorithm().FromBytes(buf) != desc.Digest {
+		return index, errors.Errorf("nested index digest is not %s", desc.Digest)
+	}
+	if err := json.Unmarshal(buf, &index); err != nil {
+		return index, errors.Wrap(err, "decode nested index")
+	}
+	return index, nil
+}
+
+// selectCandidate selects the preferred match, or a fallback, and rejects the other candidates.
+func (s *resolution) selectCandidate() (candidate, bool) {
+	comparer, _ := s.matcher.(platform.MatchComparer)
+
+	var selected *candidate
+	switch {
+	case len(s.matches) > 0:
+		best := 0
+		for i := 1; comparer != nil && i < len(s.matches); i++ {
+			if comparer.Less(*s.matches[i].desc.Platform, *s.matches[best].desc.Platform) {
+				best = i
+			}
+		}
+		selected = &s.matches[best]
+	case len(s.unspecified) > 0 && s.Fallback != FallbackNone:
+		selected = &s.unspecified[0]
+	case len(s.unmatched) > 0 && s.Fallback == FallbackFirst:
+		selected = &s.unmatched[0]
+	}
+
+	for i := range s.matches {
+		if c := &s.matches[i]; c != selected {
+			s.reject(c.desc, c.path, ReasonNotPreferred, fmt.Sprintf("platform %s matches, but %s is preferred",
+				platform.Format(*c.desc.Platform), platform.Format(*selected.desc.Platform)))
+		}
+	}
+	for i := range s.unspecified {
+		switch c := &s.unspecified[i]; {
+		case c == selected:
+		case s.Fallback == FallbackNone:
+			s.reject(c.desc, c.path, ReasonNoPlatform, "manifest has no platform")
+		default:
+			s.reject(c.desc, c.path, ReasonNotPreferred, "manifest has no platform, and another one is preferred")
+		}
+	}
+	for i := range s.unmatched {
+		if c := &s.unmatched[i]; c != selected {
+			s.reject(c.desc, c.path, ReasonPlatform, fmt.Sprintf("platform %s does not match", platform.Format(*c.desc.Platform)))
+		}
+	}
+
+	if selected == nil {
+		return candidate{}, false
+	}
+	return *selected, true
+}
+
+func (s *resolution) reject(desc v1.Descriptor, path []v1.Descriptor, reason Reason, message string) {
+	s.rejections = append(s.rejections, Rejection{
+		Descriptor: desc,
+		Path:       path,
+		Reason:     reason,
+		Message:    message,
+	})
+}
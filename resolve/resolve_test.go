@@ -0,0 +1,226 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/platform"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// blobs is an in-memory Fetcher.
+type blobs map[digest.Digest][]byte
+
+func (b blobs) Fetch(ctx context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	buf, ok := b[desc.Digest]
+	if !ok {
+		return nil, errors.Errorf("%s not found", desc.Digest)
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+// add stores index in b and returns its descriptor.
+func (b blobs) add(t *testing.T, index v1.Index, p *v1.Platform) v1.Descriptor {
+	buf, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst := digest.FromBytes(buf)
+	b[dgst] = buf
+	return v1.Descriptor{MediaType: v1.MediaTypeImageIndex, Digest: dgst, Size: int64(len(buf)), Platform: p}
+}
+
+func manifest(name string, p *v1.Platform) v1.Descriptor {
+	return v1.Descriptor{
+		MediaType: v1.MediaTypeImageManifest,
+		Digest:    digest.FromString(name),
+		Size:      int64(len(name)),
+		Platform:  p,
+	}
+}
+
+func mustParse(t *testing.T, specifier string) *v1.Platform {
+	p, err := platform.Parse(specifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &p
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	store := blobs{}
+
+	amd64 := manifest("amd64", mustParse(t, "linux/amd64"))
+	armv6 := manifest("armv6", mustParse(t, "linux/arm/v6"))
+	armv7 := manifest("armv7", mustParse(t, "linux/arm/v7"))
+	arm64 := manifest("arm64", mustParse(t, "linux/arm64"))
+	windows := manifest("windows", mustParse(t, "windows/amd64"))
+	noPlatform := manifest("no-platform", nil)
+	attestation := v1.Descriptor{MediaType: "application/vnd.in-toto+json", Digest: digest.FromString("attestation"), Size: 11}
+
+	arm := store.add(t, v1.Index{Versioned: specs.Versioned{SchemaVersion: 2}, Manifests: []v1.Descriptor{armv6, armv7}}, nil)
+	top := v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{amd64, windows, arm, attestation, arm64},
+	}
+
+	for i, tt := range []struct {
+		resolver Resolver
+		index    v1.Index
+		expected v1.Descriptor
+		path     []v1.Descriptor
+		reasons  map[digest.Digest]Reason
+	}{
+		{
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/amd64")), Fetcher: store},
+			index:    top,
+			expected: amd64,
+			reasons: map[digest.Digest]Reason{
+				windows.Digest:     ReasonPlatform,
+				armv6.Digest:       ReasonPlatform,
+				armv7.Digest:       ReasonPlatform,
+				attestation.Digest: ReasonMediaType,
+				arm64.Digest:       ReasonPlatform,
+			},
+		},
+		{
+			// arm64 prefers its own architecture to the nested arm manifests
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/arm64")), Fetcher: store},
+			index:    top,
+			expected: arm64,
+			reasons: map[digest.Digest]Reason{
+				armv6.Digest: ReasonNotPreferred,
+				armv7.Digest: ReasonNotPreferred,
+			},
+		},
+		{
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/arm/v7")), Fetcher: store},
+			index:    top,
+			expected: armv7,
+			path:     []v1.Descriptor{arm},
+			reasons: map[digest.Digest]Reason{
+				armv6.Digest: ReasonNotPreferred,
+			},
+		},
+		{
+			// without a fetcher, the nested index is rejected
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/arm/v7"))},
+			index:    top,
+			reasons: map[digest.Digest]Reason{
+				arm.Digest: ReasonFetch,
+			},
+		},
+		{
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/s390x"))},
+			index:    v1.Index{Manifests: []v1.Descriptor{amd64, noPlatform}},
+			expected: noPlatform,
+		},
+		{
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/s390x")), Fallback: FallbackNone},
+			index:    v1.Index{Manifests: []v1.Descriptor{amd64, noPlatform}},
+			reasons: map[digest.Digest]Reason{
+				amd64.Digest:      ReasonPlatform,
+				noPlatform.Digest: ReasonNoPlatform,
+			},
+		},
+		{
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/s390x")), Fallback: FallbackFirst},
+			index:    v1.Index{Manifests: []v1.Descriptor{windows, amd64}},
+			expected: windows,
+		},
+		{
+			resolver: Resolver{Matcher: platform.NewMatcher(*mustParse(t, "linux/amd64")), RefName: "v2"},
+			index: v1.Index{Manifests: []v1.Descriptor{
+				withRefName(manifest("v1", mustParse(t, "linux/amd64")), "v1"),
+				withRefName(manifest("v2", mustParse(t, "linux/amd64")), "v2"),
+			}},
+			expected: withRefName(manifest("v2", mustParse(t, "linux/amd64")), "v2"),
+			reasons: map[digest.Digest]Reason{
+				digest.FromString("v1"): ReasonRefName,
+			},
+		},
+	} {
+		result, err := tt.resolver.Resolve(ctx, tt.index)
+		rejections := result.Rejections
+		if tt.expected.Digest == "" {
+			nerr, ok := err.(*NoMatchError)
+			if !ok || errors.Cause(err) != ErrNoMatch {
+				t.Errorf("test %d: expected a *NoMatchError, got %v", i, err)
+				continue
+			}
+			rejections = nerr.Rejections
+		} else {
+			if err != nil {
+				t.Errorf("test %d: unexpected error: %v", i, err)
+				continue
+			}
+			if result.Descriptor.Digest != tt.expected.Digest || len(result.Path) != len(tt.path) {
+				t.Errorf("test %d: expected %s at depth %d, got %s at depth %d", i, tt.expected.Digest, len(tt.path), result.Descriptor.Digest, len(result.Path))
+			}
+		}
+
+		for _, r := range rejections {
+			if expected, ok := tt.reasons[r.Descriptor.Digest]; ok && expected != r.Reason {
+				t.Errorf("test %d: expected %s to be rejected for %s, got %s", i, r.Descriptor.Digest, expected, r)
+			}
+		}
+	}
+}
+
+func TestResolveNested(t *testing.T) {
+	ctx := context.Background()
+	store := blobs{}
+
+	amd64 := manifest("amd64", mustParse(t, "linux/amd64"))
+	inner := store.add(t, v1.Index{Manifests: []v1.Descriptor{amd64}}, nil)
+	outer := store.add(t, v1.Index{Manifests: []v1.Descriptor{inner}}, nil)
+	top := v1.Index{Manifests: []v1.Descriptor{outer}}
+	matcher := platform.NewMatcher(*mustParse(t, "linux/amd64"))
+
+	result, err := (&Resolver{Matcher: matcher, Fetcher: store}).Resolve(ctx, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Descriptor.Digest != amd64.Digest || len(result.Path) != 2 || result.Path[0].Digest != outer.Digest {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	_, err = (&Resolver{Matcher: matcher, Fetcher: store, MaxDepth: 1}).Resolve(ctx, top)
+	if nerr, ok := err.(*NoMatchError); !ok || len(nerr.Rejections) != 1 || nerr.Rejections[0].Reason != ReasonDepth {
+		t.Errorf("expected the nested index to be too deep, got %v", err)
+	}
+
+	// content which does not match its descriptor is rejected
+	store[inner.Digest] = []byte(`{"manifests":[]}`)
+	_, err = (&Resolver{Matcher: matcher, Fetcher: store}).Resolve(ctx, top)
+	if nerr, ok := err.(*NoMatchError); !ok || len(nerr.Rejections) != 1 || nerr.Rejections[0].Reason != ReasonFetch {
+		t.Errorf("expected the altered index to be rejected, got %v", err)
+	}
+}
+
+func withRefName(desc v1.Descriptor, name string) v1.Descriptor {
+	desc.Annotations = map[string]string{v1.AnnotationRefName: name}
+	return desc
+}
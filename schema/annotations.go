@@ -0,0 +1,154 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/spdx"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// annotationFormat is the format of the value of a pre-defined annotation.
+type annotationFormat struct {
+	// name identifies the format, it is the Expected value of the *FieldError reporting invalid values.
+	name  string
+	check func(value string) error
+}
+
+// annotationFormats maps the pre-defined annotation keys whose value has a format to that format.
+var annotationFormats = map[string]annotationFormat{
+	v1.AnnotationCreated:         {"date-time", checkDateTime},
+	v1.AnnotationURL:             {"uri", checkURL},
+	v1.AnnotationDocumentation:   {"uri", checkURL},
+	v1.AnnotationSource:          {"uri", checkURL},
+	v1.AnnotationLicenses:        {"spdx-expression", checkLicenseExpression},
+	v1.AnnotationRefName:         {"ref", checkRefName},
+	v1.AnnotationBaseImageDigest: {"digest", checkDigest},
+	v1.AnnotationBaseImageName:   {"image-reference", checkImageReference},
+}
+
+var (
+	// refNameRegexp matches the grammar of the org.opencontainers.image.ref.name annotation.
+	refNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]+(?:(?:[-._:@+]|--)[A-Za-z0-9]+)*(?:/[A-Za-z0-9]+(?:(?:[-._:@+]|--)[A-Za-z0-9]+)*)*$`)
+
+	// imageReferenceRegexp matches the image references of distribution/distribution: name[:tag][@digest].
+	imageReferenceRegexp = regexp.MustCompile(
+		`^(?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?/)?` +
+			`[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*` +
+			`(?::[\w][\w.-]{0,127})?` +
+			`(?:@[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,})?$`)
+)
+
+// checkAnnotations checks the values of the pre-defined annotations of the object at ptr in doc.
+// Invalid values are returned as *FieldError in strict mode, and reported as warnings otherwise.
+func (s *validation) checkAnnotations(doc *document, ptr string, annotations map[string]string) []error {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		format, ok := annotationFormats[key]
+		if !ok {
+			continue
+		}
+		value := annotations[key]
+		err := format.check(value)
+		if err == nil {
+			continue
+		}
+
+		field := ptr + "/annotations/" + escapePointer(key)
+		if !s.opts.Strict {
+			s.warn(Warning{
+				Code:    WarningInvalidAnnotation,
+				Message: fmt.Sprintf("annotation %s is not a valid %s: %v", key, format.name, err),
+				Field:   field,
+			})
+			continue
+		}
+
+		fe := &FieldError{
+			Field:       field,
+			Keyword:     "format",
+			Expected:    format.name,
+			Value:       value,
+			Description: fmt.Sprintf("annotation %s is not a valid %s: %v", key, format.name, err),
+		}
+		doc.locate(fe)
+		errs = append(errs, fe)
+	}
+	return errs
+}
+
+func checkDateTime(value string) error {
+	_, err := time.Parse(time.RFC3339, value)
+	return err
+}
+
+func checkURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+		return errors.New("not an absolute URL")
+	}
+	return nil
+}
+
+func checkDigest(value string) error {
+	_, err := digest.Parse(value)
+	return err
+}
+
+// ValidRefName reports whether name matches the grammar of the org.opencontainers.image.ref.name annotation,
+// defined in annotations.md.
+func ValidRefName(name string) bool {
+	return refNameRegexp.MatchString(name)
+}
+
+func checkRefName(value string) error {
+	if !ValidRefName(value) {
+		return errors.New("does not match the ref grammar")
+	}
+	return nil
+}
+
+func checkImageReference(value string) error {
+	if !imageReferenceRegexp.MatchString(value) {
+		return errors.New("does not match the image reference grammar")
+	}
+	return nil
+}
+
+// checkLicenseExpression checks that value is an SPDX license expression
+// whose identifiers are in the SPDX License List.
+func checkLicenseExpression(value string) error {
+	e, err := spdx.Parse(value)
+	if err != nil {
+		return err
+	}
+	return spdx.Validate(e)
+}
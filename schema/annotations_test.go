@@ -0,0 +1,103 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func TestAnnotations(t *testing.T) {
+	for i, tt := range []struct {
+		key   string
+		value string
+		fail  bool
+	}{
+		{key: v1.AnnotationCreated, value: "2015-10-31T22:22:56.015925234Z"},
+		{key: v1.AnnotationCreated, value: "2015-10-31T22:22:56+01:00"},
+		{key: v1.AnnotationCreated, value: "2015-10-31 22:22:56", fail: true},
+		{key: v1.AnnotationURL, value: "https://example.com/image"},
+		{key: v1.AnnotationDocumentation, value: "example.com/docs", fail: true},
+		{key: v1.AnnotationSource, value: "git+ssh://git@example.com/repo.git"},
+		{key: v1.AnnotationSource, value: "://", fail: true},
+		{key: v1.AnnotationLicenses, value: "MIT"},
+		{key: v1.AnnotationLicenses, value: "(MIT OR Apache-2.0) AND GPL-2.0+ WITH Classpath-exception-2.0"},
+		{key: v1.AnnotationLicenses, value: "LicenseRef-custom AND DocumentRef-spdx:LicenseRef-other"},
+		{key: v1.AnnotationLicenses, value: "MIT OR", fail: true},
+		{key: v1.AnnotationLicenses, value: "(MIT", fail: true},
+		{key: v1.AnnotationLicenses, value: "MIT, Apache-2.0", fail: true},
+		{key: v1.AnnotationLicenses, value: " ( ) ", fail: true},
+		{key: v1.AnnotationLicenses, value: "LicenseRef-custom+", fail: true},
+		{key: v1.AnnotationLicenses, value: "MIT WITH", fail: true},
+		{key: v1.AnnotationLicenses, value: "(MIT) WITH Classpath-exception-2.0", fail: true},
+		{key: v1.AnnotationLicenses, value: "MIT)", fail: true},
+		{key: v1.AnnotationLicenses, value: "MIT OR Not-A-License", fail: true},
+		{key: v1.AnnotationLicenses, value: "GPL-2.0+ WITH Not-An-Exception", fail: true},
+		{key: v1.AnnotationRefName, value: "registry.example.com/repo:v1.0--rc1"},
+		{key: v1.AnnotationRefName, value: "v1..0", fail: true},
+		{key: v1.AnnotationBaseImageDigest, value: "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"},
+		{key: v1.AnnotationBaseImageDigest, value: "sha256:c86f", fail: true},
+		{key: v1.AnnotationBaseImageName, value: "registry.example.com:5000/my-org/my-image:tag"},
+		{key: v1.AnnotationBaseImageName, value: "docker.io/library/busybox@sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"},
+		{key: v1.AnnotationBaseImageName, value: "Registry/Image:tag", fail: true},
+		{key: v1.AnnotationTitle, value: "anything goes"},
+	} {
+		annotations, err := json.Marshal(map[string]string{tt.key: tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := `{
+  "mediaType": "application/vnd.oci.image.manifest.v1+json",
+  "size": 7682,
+  "digest": "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+  "annotations": ` + string(annotations) + `
+}`
+		field := "/annotations/" + strings.Replace(tt.key, "/", "~1", -1)
+
+		result, err := schema.ValidatorMediaTypeDescriptor.ValidateWithOptions(strings.NewReader(doc), schema.Options{})
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if tt.fail != (len(result.Warnings) == 1) {
+			t.Errorf("test %d: expected failure %t, got warnings %v", i, tt.fail, result.Warnings)
+		} else if tt.fail && (result.Warnings[0].Code != schema.WarningInvalidAnnotation || result.Warnings[0].Field != field) {
+			t.Errorf("test %d: unexpected warning %v", i, result.Warnings[0])
+		}
+
+		// the strict profile turns the warnings into errors
+		_, err = schema.ValidatorMediaTypeDescriptor.ValidateWithOptions(strings.NewReader(doc), schema.Options{Strict: true})
+		if tt.fail != (err != nil) {
+			t.Errorf("test %d: expected failure %t in strict mode, got %v", i, tt.fail, err)
+			continue
+		}
+		if tt.fail {
+			verr, ok := errors.Cause(err).(schema.ValidationError)
+			if !ok || len(verr.Errs) != 1 {
+				t.Errorf("test %d: expected a single validation error, got %v", i, err)
+				continue
+			}
+			ferr, ok := verr.Errs[0].(*schema.FieldError)
+			if !ok || ferr.Field != field || ferr.Keyword != "format" || ferr.Line != 5 {
+				t.Errorf("test %d: unexpected error %v", i, verr.Errs[0])
+			}
+		}
+	}
+}
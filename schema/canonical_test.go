@@ -0,0 +1,180 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestMarshalCanonical(t *testing.T) {
+	manifest := v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config: v1.Descriptor{
+			MediaType: v1.MediaTypeImageConfig,
+			Digest:    digest.FromString("config"),
+			Size:      6,
+		},
+		Layers: []v1.Descriptor{{
+			MediaType: v1.MediaTypeImageLayerGzip,
+			Digest:    digest.FromString("layer"),
+			Size:      5,
+		}},
+		Annotations: map[string]string{
+			"z":      "<tag> & \"quote\" \\",
+			"a":      "\u00e9\u2028\t", // json.Marshal escapes U+2028
+			"\u00e9": "",
+		},
+	}
+
+	// only the quotation mark, the backslash and the control characters are escaped
+	expected := "{\"annotations\":{\"a\":\"\u00e9\u2028\\t\",\"z\":\"<tag> & \\\"quote\\\" \\\\\",\"\u00e9\":\"\"}," +
+		`"config":{"digest":"` + digest.FromString("config").String() + `","mediaType":"application/vnd.oci.image.config.v1+json","size":6},` +
+		`"layers":[{"digest":"` + digest.FromString("layer").String() + `","mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","size":5}],` +
+		`"schemaVersion":2}`
+
+	for i := 0; i < 10; i++ {
+		p, err := v1.MarshalCanonical(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != expected {
+			t.Fatalf("expected\n%s\ngot\n%s", expected, p)
+		}
+	}
+
+	manifest.Annotations["invalid"] = "\xff"
+	if _, err := v1.MarshalCanonical(manifest); err == nil {
+		t.Error("expected invalid UTF-8 to fail")
+	}
+
+	for i, tt := range []struct {
+		doc       string
+		canonical string
+		fail      bool
+	}{
+		{doc: `{"b": [1, -0, true, null], "a": {}}`, canonical: `{"a":{},"b":[1,0,true,null]}`},
+		{doc: `"\u0041\n\"\\\/"`, canonical: `"A\n\"\\/"`},
+		{doc: `"\u0000\u001F\u007f"`, canonical: "\"\\u0000\\u001f\u007f\""},
+		{doc: `"\ud83d\ude00 \\ud800"`, canonical: "\"\U0001f600 \\\\ud800\""},
+		{doc: `1.5`, fail: true},
+		{doc: `1e3`, fail: true},
+		{doc: `{} {}`, fail: true},
+		{doc: "\"\xff\"", fail: true},
+		{doc: `"\ud800"`, fail: true},
+		{doc: `"\ud800\u0041"`, fail: true},
+		{doc: `{"\udc00": 1}`, fail: true},
+	} {
+		canonical, err := v1.CanonicalizeJSON([]byte(tt.doc))
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: expected failure %t, got %v", i, tt.fail, err)
+			continue
+		}
+		if !tt.fail && string(canonical) != tt.canonical {
+			t.Errorf("test %d: expected %q, got %q", i, tt.canonical, canonical)
+		}
+	}
+}
+
+func TestMarshalCanonicalControlCharacters(t *testing.T) {
+	var control []byte
+	for c := byte(0); c < 0x20; c++ {
+		control = append(control, c)
+	}
+	index := v1.Index{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		Manifests:   []v1.Descriptor{},
+		Annotations: map[string]string{"control": string(control)},
+	}
+
+	canonical, err := v1.MarshalCanonical(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"annotations":{"control":"` +
+		`\u0000\u0001\u0002\u0003\u0004\u0005\u0006\u0007\b\t\n\u000b\f\r\u000e\u000f` +
+		`\u0010\u0011\u0012\u0013\u0014\u0015\u0016\u0017\u0018\u0019\u001a\u001b\u001c\u001d\u001e\u001f` +
+		`"},"manifests":[],"schemaVersion":2}`
+	if string(canonical) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, canonical)
+	}
+
+	var decoded v1.Index
+	if err := json.Unmarshal(canonical, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Annotations["control"] != string(control) {
+		t.Errorf("expected %q, got %q", control, decoded.Annotations["control"])
+	}
+	if again, err := v1.CanonicalizeJSON(canonical); err != nil || !bytes.Equal(again, canonical) {
+		t.Errorf("expected the canonical form to be stable, got %q, %v", again, err)
+	}
+	if _, err := schema.ValidatorMediaTypeImageIndex.ValidateWithOptions(bytes.NewReader(canonical), schema.Options{Strict: true}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	index := v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []v1.Descriptor{{
+			MediaType: v1.MediaTypeImageManifest,
+			Digest:    digest.FromString("manifest"),
+			Size:      8,
+			Platform:  &v1.Platform{Architecture: "amd64", OS: "linux"},
+		}},
+	}
+	canonical, err := v1.MarshalCanonical(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshaled, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indented, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		doc       []byte
+		canonical bool
+	}{
+		{doc: canonical, canonical: true},
+		{doc: marshaled},
+		{doc: indented},
+		{doc: append(append([]byte(nil), canonical...), '\n')},
+	} {
+		result, err := schema.ValidatorMediaTypeImageIndex.ValidateWithOptions(bytes.NewReader(tt.doc), schema.Options{Canonical: true})
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		var warned bool
+		for _, w := range result.Warnings {
+			warned = warned || w.Code == schema.WarningNonCanonical
+		}
+		if warned == tt.canonical {
+			t.Errorf("test %d: expected canonical %t, got warnings %v", i, tt.canonical, result.Warnings)
+		}
+	}
+}
@@ -17,6 +17,7 @@ package schema
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
 )
 
@@ -55,3 +56,89 @@ func WrapSyntaxError(r io.Reader, err error) error {
 
 	return err
 }
+
+// position returns the 1-based line and column of the byte at offset in r.
+func position(r io.Reader, offset int64) (line, col int) {
+	buf := bufio.NewReader(r)
+	line = 1
+	col = 1
+	for i := int64(0); i < offset; i++ {
+		b, berr := buf.ReadByte()
+		if berr != nil {
+			break
+		}
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// A FieldError describes a single schema violation in a validated document.
+type FieldError struct {
+	// Field is the JSON Pointer (RFC 6901) of the offending value, "" for the document root.
+	Field string
+
+	// Keyword is the JSON schema keyword which failed, e.g. "type", "required" or "pattern",
+	// or one of the Keyword constants for the violations of the strict profile and of the semantic checks.
+	Keyword string
+
+	// Expected is the value required by the schema rule, if the rule provides one.
+	Expected interface{}
+
+	// Value is the actual value found at Field.
+	Value interface{}
+
+	// Description is a human readable description of the violated rule.
+	Description string
+
+	// Line and Col locate the start of the offending value in the document (1-based).
+	// They are zero if the location is unknown.
+	Line, Col int
+
+	// Offset is the byte offset of the offending value in the document.
+	Offset int64
+}
+
+func (e *FieldError) Error() string {
+	field := e.Field
+	if field == "" {
+		field = "/"
+	}
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", field, e.Description)
+	}
+	return fmt.Sprintf("%s (line %d, col %d): %s", field, e.Line, e.Col, e.Description)
+}
+
+// A LayerError describes an entry of a layer archive which violates the layer format.
+type LayerError struct {
+	// Entry is the 0-based position of the offending entry in the archive.
+	Entry int
+
+	// Path is the name of the offending entry as stored in the archive.
+	Path string
+
+	// Description is a human readable description of the violated rule.
+	Description string
+}
+
+func (e *LayerError) Error() string {
+	return fmt.Sprintf("entry %d %q: %s", e.Entry, e.Path, e.Description)
+}
+
+// A LayoutError describes a problem with a file of an image layout.
+type LayoutError struct {
+	// Path is the slash-separated path of the file relative to the root of the layout.
+	Path string
+
+	// Err describes the problem.
+	Err error
+}
+
+func (e *LayoutError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+func TestFieldError(t *testing.T) {
+	for i, tt := range []struct {
+		manifest string
+		field    string
+		keyword  string
+		line     int
+		col      int
+	}{
+		// config.size is a string, expected integer
+		{
+			manifest: `{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.oci.image.config.v1+json",
+    "size": "1470",
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ]
+}`,
+			field:   "/config/size",
+			keyword: "type",
+			line:    5,
+			col:     13,
+		},
+
+		// layers[1].digest does not match the digest pattern
+		{
+			manifest: `{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.oci.image.config.v1+json",
+    "size": 1470,
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    },
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "SHA256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ]
+}`,
+			field:   "/layers/1/digest",
+			keyword: "pattern",
+			line:    17,
+			col:     17,
+		},
+
+		// annotation keys containing "/" and "." are escaped
+		{
+			manifest: `{"schemaVersion": 2, "config": {"mediaType": "application/vnd.oci.image.config.v1+json", "size": 1470, "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"}, "layers": [{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "size": 148, "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"}], "annotations": {"com.example/key": 1}}`,
+			field:    "/annotations/com.example~1key",
+			keyword:  "type",
+			line:     1,
+			col:      397,
+		},
+
+		// the required config is missing, reported against the enclosing object
+		{
+			manifest: `
+{
+  "schemaVersion": 2,
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ]
+}`,
+			field:   "",
+			keyword: "required",
+			line:    2,
+			col:     1,
+		},
+	} {
+		err := schema.ValidatorMediaTypeManifest.Validate(strings.NewReader(tt.manifest))
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok {
+			t.Errorf("test %d: expected a validation error, got %v", i, err)
+			continue
+		}
+		if len(verr.Errs) != 1 {
+			t.Errorf("test %d: expected a single error, got %v", i, verr.Errs)
+			continue
+		}
+		ferr, ok := verr.Errs[0].(*schema.FieldError)
+		if !ok {
+			t.Errorf("test %d: expected *schema.FieldError, got %T", i, verr.Errs[0])
+			continue
+		}
+		if ferr.Field != tt.field || ferr.Keyword != tt.keyword {
+			t.Errorf("test %d: expected field %q keyword %q, got field %q keyword %q", i, tt.field, tt.keyword, ferr.Field, ferr.Keyword)
+		}
+		if ferr.Line != tt.line || ferr.Col != tt.col {
+			t.Errorf("test %d: expected line %d col %d, got line %d col %d", i, tt.line, tt.col, ferr.Line, ferr.Col)
+		}
+	}
+}
+
+func TestWrapSyntaxError(t *testing.T) {
+	doc := "{\n  \"schemaVersion\": 2,\n  \"layers\": [}\n}"
+	var v interface{}
+	err := schema.WrapSyntaxError(strings.NewReader(doc), json.Unmarshal([]byte(doc), &v))
+	serr, ok := err.(*schema.SyntaxError)
+	if !ok {
+		t.Fatalf("expected *schema.SyntaxError, got %T: %v", err, err)
+	}
+	// Line counts the newlines before the offset and Col the bytes up to and including the offending one,
+	// unlike FieldError whose Line and Col are 1-based.
+	if serr.Line != 2 || serr.Col != 15 || serr.Offset != 38 {
+		t.Errorf("expected line 2 col 15 offset 38, got line %d col %d offset %d", serr.Line, serr.Col, serr.Offset)
+	}
+}
@@ -245,33 +245,35 @@ E9WgzMB+hm9ZsmE43JvwOHy75sL3Mul2Z538CQAA//9C38scmQsAAA==
 	"/content-descriptor.json": {
 		name:    "content-descriptor.json",
 		local:   "content-descriptor.json",
-		size:    1079,
+		size:    1387,
 		modtime: 1625865919,
 		compressed: `
-H4sIAAAAAAAC/5yTsW7cMAyGdz8F4QTIkos6BB2MIEu7d2i3ooNOok5Mz5JK8RBci7x7QcvX2G2RILfZ
-xP+Rn2zqVwfQe6yOqQjl1A/QfyqYPuQklhIy6BMmgY9zKDN8LugokLMTca0tLquLOFrFo0gZjHmoOW1a
-9Sbzzni2QTbvbk2rXTSO/AmpgzG5YHKnyXXCWtr4P9MbJ8eCSubtAzpptcK5IAth7QfQgwH0I3qyX1q4
-lf49r0SEKadNIQfQAmNAxuTQw2LGhF8yBuU8hrp5FrvRE18Yj4ESae9qnqdP7FNr0Vf6+ZqPRoASbI+C
-9Y1O/xGhJO9v1xKedljlFQ3HxyJ5x7ZEcuAiuu/1MEJjT1rN5Vp19bVYEeQEV3d2v8tMEsf74U5/rEd/
-f3XOd5xdV/4H3tcX7C3sqSlqEALnER4juQgSqc7OMNojbBF8fkz7bD36c+wmk5WbTSnLdDtWim9fdrPs
-dIbaEm+G3WzZM/44EKMqff37riz3dL0uHcC37qn7HQAA//9DKIMKNwQAAA==
+H4sIAAAAAAAC/6yUP2/bMBDFd32KgxIgix12MDIIQZZ279BuRQeKPEmXWiR7PCNwi3z34kSpsfonaYx6
+sg733v14xOP3CqD2mB1TEoqhbqB+nzC8jUEsBWTQfxgE3s1NkeFDQkcdOTspNmpxmd2Ao1X5IJIaY+5z
+DNtSvY7cG8+2k+2bnSm1i6Ijv0hyY0xMGNwyOU+y0m38z+lFJ8eEqoztPToptcQxIQthrhvQgwHUI3qy
+H0tzKf1+XhkQpj41hdiBFhg7ZAwOPZzM0F99ydipzmOXt09g13riC+Oxo0Dqnc3T9En7WCzqTN9e4tEW
+oADtUTC/kukPIBTkZreG8NRjlhcwHB+TxJ5tGsiBG9B9yYcRinbBKiwbxdXPZEWQA1zd2n0fmWQY75pb
+vViP/u7qnD3OrCv+A+/zM/QW9lQQtRE6jiM8DOQGkIHyzAyjPUKL4OND2Efr0Z9DN5Gsd2vFPscWAMcW
+vafQL0sUyz0KenAlbxtobcabHcyLO2ttirECsyzUWSf/mgj4SyQWn/8YChtClOlFWV3r6x8Ic+p0Bt+p
+vBBWM2XN+PVAjIr06df35TTb64hVAJ+rx+rHAFbvufxrBQAA
 `,
 	},
 
 	"/defs-descriptor.json": {
 		name:    "defs-descriptor.json",
 		local:   "defs-descriptor.json",
-		size:    844,
+		size:    1050,
 		modtime: 1625865919,
 		compressed: `
-H4sIAAAAAAAC/5SST2/TTBDG7/kU826jt0DiOHBAqlWKKnrnUE6t0mi6O7aneP9od6IqVPnuaG03SYtA
-cLC1+2jmefwbz9MEQBlKOnIQ9k5VoK6oZsf5liBgFNabDiOIh6+B3BfvBNlRhKuxzUe4DqS5Zo29x3ww
-3buoCnIOgLJkGL9tA+0lAMUmp7YiIVVl6QM5/ZyRFj42ZdItWSzZYkOl2aeWB7f5s5cM3ipJZNcc9IAi
-FHu8u9vL4gaLH8vibHU4/ncy/b+4Wy9mq6fl/P2Hj7vy78qmqo/YDUnKcENJjuleDVdaAh23QXwTMbSs
-Qbekv6eNhaEXfA25yN8/kJY5sOuvIwCcnmPX+MjS2ovqPI/KkLk4/ccJjFyzN5+r29liXaz2ytt3VT5f
-FjfL4uzTuljNXhFuYpf+wIfQ8QCRC6GO3sJjy7oFaTmNVGBxC/cExj+6zqMh8+v3Y4y4PcgsZI9zf08K
-oGofLea/oDaR1ajvXmCgc17w5XoCqGmkOvcZqtPiIXl3Uh4tcmkxXPdpw3uczCQ/u8nPAAAA///5nDLG
-TAMAAA==
+H4sIAAAAAAAC/5RTXU/bMBR976+4M9VYadN0DCERURAa73tgT6BS3do3iVljW/atUNflv09u0k80NB4S
+2UfX5/jc47vqAAhFQXrtWFsjMhD3lGuj4y6AQ89aLubogS38cGS+W8OoDXm4b49ZDw+OpM61xDXHoCHd
+sogMog6AqEhp/Ll0tIUAhFZRtWR2IUtT68jIjUYYWl+kQZZUYaorLChVW9V0xzbYcHHDLQJ7bYod7pCZ
+/Nre89Nd8ojJ71FyNdktP510PyfP02F/shoNvp5f1un/lXXFWqJulITSBQXed3fUXC4JpF86toVHV2oJ
+siT5KywqaM6CzSEW2dkLSR6ANuttawBOr3FeWK+5rG6y69gqRerm9IMdaH31v9xmT/3hNJlskd5ZFtd3
+yeMouRpPk0n/yOHCz8M7/hDmujERCyH3toLXUssSuNShdQUVLmFGoOyrmVtUpN7eH73H5Q7WTNW+7r+d
+Aojc+gpjCmLhtWjx+jAoZHzPhgGqZqSUNsUmEUZfEJOC+DzJ8ABmGOjyAtoUPpZBbP32WfXTyeqi7p29
+Ac/r8fjPIfStHvduj0JBYyzj4bABiK6nPIopysPwJVhzku6NZVqhe1jfsPm3lJ341Z2/AwBqnG9+GgQA
+AA==
 `,
 	},
 
@@ -294,21 +296,23 @@ fIvD7in0ryMEy+fK1G6UfmdTE+tvpoL+1wV/AgAA//96IpqyhgYAAA==
 	"/image-index-schema.json": {
 		name:    "image-index-schema.json",
 		local:   "image-index-schema.json",
-		size:    2993,
+		size:    3736,
 		modtime: 1625865919,
 		compressed: `
-H4sIAAAAAAAC/6yWz0/jOhDH7/0rRgGJC5CnJ/QOFeLy9sJpD4v2suJg7EkybGNnx1Ogu+r/vrJN2qRJ
-C4Te2rHnO5/vxL/+zAAyg14zNULOZnPIvjZo/3dWFFlkuK1ViXBrDb7AtwY1FaRVnHoeck+9rrBWIa8S
-aeZ5/uidvUjRS8dlblgVcvHPVZ5iJymPTJvi53nuGrS6LeljWpqdUyifUyifEmXVYEh1D4+oJcUadg2y
-EPpsDsESQJbyvyP7ZCuFh27vKvJQEC4M+GQPPUiFECtDrAxJDJ6SGigPygJZwRI5IkTlCZ7yPuZGqnU5
-qFGTpXpZZ3P4dxtTL20shtZpJKuVpQK9+K79Vlkxq1WHXbDuzvuwnbbYl9f2ui30+Fd7HWH8tSTGUOvH
-Jhrg0ZC6C2nn3bCn3zsRQyV6yTah+474yMIYyPcHhgskrIU4O3gAV8TFwVggo9VoYGApipwyFiHbYOEv
-zKYnl2F3nOQGC7IUKvh8S9JRWA9Nv4czTASy8LAS9JNYRwDJyn9X++Fe+/8ePM2rRlzJqqlIg65Q//TL
-GpJCi5sYz4ON8LdRIsgWzq7VonRMUtU38+uwFg2am7Ppfd9dN7u+lrzwb7pSsKCEHqZDwa6G54p0BRLO
-leQFarWCBwTjnu3CKYNmOnWk2svcLJQUjush98c280Znh3PvNj60leOYYl2RoJYl404eQOZ6nnp7+PA+
-HmoPxye7zw9Cd9rhhcmW2c6E9ZjNY+I5fxyoy6fBLXkMuI3scSALVOE7HLuFW90DmP3Lslt2cG2+2yTA
-+k3bT4pJWRm3/EYPZ/v+9Y8MZa2T+KDznz01tgdX3lWdfNZ1RWZjXtpf696zZ9zRpNfZmI3PGAigEXN4
-VmZjL8HOE24GcD9bz/4GAAD//yCnv52xCwAA
+H4sIAAAAAAAC/7RXPW/jOBDt9SsGSoA0TnQ4BCmMIM1dk+qKC645pKDJkTRZi9SS4yTehf/7gqIl05L8
+EdtbBRly3rw3Qz5TPxOAVKGTlmomo9MppP/UqP8ymgVptPBciQLhWSv8hH9rlJSTFM3Wic+9drLESvi8
+krmeZtmbM/o2RO+MLTJlRc63f9xnIXYV8ki1KW6aZaZGLduSrkkLuzPy5TPy5UMiL2v0qWb2hpJDrLam
+RsuELp2ClwSQhvz/0LogK4SHal9KcpATzhW4IA8dcInQVIamMgQweA9oIBwIDaQZC7TppEU+QVO2TbOD
+alUOalSkqVpU6RT+3MTEZxtrQquwklaoSLwEpF3yvdJmn68IJu9L31S+tpj7DIW5u21RjL3z877KFOak
+yaO6bFN3i46wTLmQfCwjiCm1yRP4KFEPBhQwZujAaLwg50poytGxiwm3wxHWimU0fsYq3vflE9EW+7sj
+2oGPH/z1isXvC7Loa/3fRbfmP4nDjn70IooKdJx2odcIfORuDeC3F448ZBZztKglKhhIOm94ANEIY9HH
+8PQbgTTMlozuJK4jBEnzw/1ucuv+H0NP2mXNprCiLkmCLFF+c4sKAkJLN3CcAIWLUgtmtBpuHsW8MJa4
+rJ6mj/4sKlRPN6f3vX9u+roWdu4OqhIwp0Ddb4fcmgo+SpIlsLfmoAUqsYQZgjIfem6EQnU664bV7lkI
+Foc5a8BqhkqRLtqms7AFMirwVxw1T2AmHD7cw7rRZ7TZU9pJeIetfsVco+Pdov3Wy1jPBefGVkO6XzPM
+DqdHdqdV7rPLdTNlSYySFxZ7eQCp2To3Wz653yuH2MP1k9Vne0lH7XBsSRdpb8NqTOYl6Rl3GVJ374PH
+3CXIdbCXIZmj8HO4dAs3uHtobj9I4rKDp8nRIgFWB2W/C0tC87jkAz1Mdv3XczmtDTffHe5c19i4Vxaj
+nmx4MUgypmWVxH/XulK3CO60UdPVXP+C9Mv2ntOjHTnpI2SsDec0YJWsaQ69Nh374Ime2QnAa7JKfg0A
+YY1qBpgOAAA=
 `,
 	},
 
@@ -329,16 +333,136 @@ HrRoV8JRtyHJaO0DOruZpYLJtaZsrM/FWEi+BMysfzuhXbUQfcDIhEkZyG2yQyYl8TPGJLVk97fth1yA
 	"/image-manifest-schema.json": {
 		name:    "image-manifest-schema.json",
 		local:   "image-manifest-schema.json",
-		size:    921,
+		size:    1314,
 		modtime: 1625865903,
 		compressed: `
-H4sIAAAAAAAC/5ySMW8iMRCF+/0VI0MJ+O501bZXUZxSJEoTpXB2x7uDWNsZmygo4r9HtnHAkCKifTvv
-zTdv/dEAiB59x+QCWSNaEHcOzT9rgiKDDOtJDQj/lSGNPsC9w440dSpNL6J97rsRJxWtYwiulXLjrVlm
-dWV5kD0rHZa//sqszbKP+mLxrZTWoenKVp9seVpSJJDTkSB7w95hdNuXDXZHzbF1yIHQixbiYQAiRzwi
-+3xclq9vfhjJgybc9uDzheghjAhpOZTlkPPgLQeC8qAMkAk4ICeKFH7bZbKG/Uort16tmcjQtJtEC39O
-mnovWpIO+YvorNE0nDcwZ9QxNqKhCcvSiOVV/H+ism/VHtmf2wuVYlb7imkdcIqjv099HJVi/ul2gENF
-oYyxIb28CuXGus/TFpet9Kj9JdRM9qjJULJU9qawJlLB+Lojxoj19N07rP9JXXED8Nwcms8AAAD//7u3
-Dj+ZAwAA
+H4sIAAAAAAAC/6xUPY/TQBDt/StGe1cmt4Co3FJdgSg40SCKPXs2ntN51sxsgAjlv6P1Zi9eLkiRRfsy
+78sv9u8GwPSondAUKbBpwXyakD8Ejo4YBe5Ht0P46Jg8aoTPE3bkqXPz9SbRb7UbcHSJOsQ4tdY+aeBt
+Ru+C7Gwvzsftm/c2YzeZR32haGttmJC74qozLV9bSgnseEqQufEwYWKHxyfsTtgkYUKJhGpaSMUATJb4
+gqK5XIZfd34YSMETPveguSEqxAFhNodiDlkPfmRBcAqOgTjiDsVsivi6ZrYO+6JWur6yGYlp3I+mhXdn
+zP0q2Awd8y9mxJ7cQ1b610NIfee75AjBX3gAZ/NbQZ9IPXrdFqEgd2n7G9ujJ6YkrPZsXSVyEsm7Ll4b
+CpapCnkDPwfkS0tlmUdUCIz/MXYX2NNuGbhIpo2R49+qNf3ZHVB0SS/zOhF3qMa9jzim07cvIJ2QQr7W
+HeBYpdB9fm/WtnDMIc6fgKrKyv/9Um3FUEt6U7rOSY3g9z0JplhfL30Q6k3riRqAb82x+TMAsqXcWSIF
+AAA=
+`,
+	},
+
+	"/v1.0/config-schema.json": {
+		name:    "config-schema.json",
+		local:   "v1.0/config-schema.json",
+		size:    2771,
+		modtime: 1792190037,
+		compressed: `
+H4sIAAAAAAAC/+RWsW7bQAzd7yuIS8Yk6tDJa9qtQAoYbYciCM4SZV+qO155VFEh8L8XkuxGkiXZcOAu
+nQzQ5HuPjzyBLwpAZxhTtkEseb0A/RDQ35MXYz0y3JPP7RqWAVOb29Q0WTcKQF/HdIPO1CUbkbBIkudI
+/raN3hGvk4xNLrfv3idt7Kqts9m+JC6ShAL6dM8Wm7I2O7HOrDFJG/62UqqAdS2tnjGVNhaYArJYjHoB
+LwoAQKeMRjD7G+iURmHrWzgAAJ0TOyP1P5kRvBXrUCsAgG2bok0pG+IZqH42pxsrmErJeGoNxVMzd16M
+ZHccARh3BQBAf4nIvcgEY4cVAEB//B0oYvaZWOKw/poxbwzEPN7VK3CVZJhbb+tViYkzYdkgP7Qax/H9
+rylZhtlU+qb7lxV0QxkzjQBsJ0iFq0DWy5CbPD7UPX3vBGFANytxRuYRqX25A8mzKnxZFFpN4TyOWnDv
+sv+2969UlA7jmf2fu/WX7uob8Q/r1x/sWe/8k1lhcWlLliODv6QlS6GwtGtvipMtUd3fHZZmIsnjWz6/
+mc3zJ5vFf/+t2+XPdd+jRV+6g4nrwlTIUY87rgasmvFnaRmzHs6rB0N1qou493xjoxBXY6b3zRoxamo8
+0wMavR2OuzV3R8Dheh/eFMeHejOi8WlVvQGDnEMv5wOgC1I9NRsxDbIiKtD4if3svzK1Yzjcm/5Z9Xo2
+9d+lAnhUW/VnAEpj2wvTCgAA
+`,
+	},
+
+	"/v1.0/content-descriptor.json": {
+		name:    "content-descriptor.json",
+		local:   "v1.0/content-descriptor.json",
+		size:    1079,
+		modtime: 1792190037,
+		compressed: `
+H4sIAAAAAAAC/5yTsW4bMQyG93sKQgmQJY46BB0OQZZ279BuRQdZoiymPkmlaARukXcveLIbX1skiD35
+iP8jP91RvwYAE7B5pipUshnBfKqYP5QsjjIy6D/MAh8PocLwuaKnSN7NxLW2uGw+4eQUTyJ1tPahlbzq
+1ZvCGxvYRVm9u7W9dtE5CkekjdaWitkfJ7cZ62kb/kzvnOwrKlnWD+il1yqXiiyEzYygBwMwEwZyX3q4
+l/49rySEOadNoUTQAmNExuwxwMkM/ZlLxqhcwNhWz2I3euILGzBSJu3d7PP0mX3qLUyjn6/5aAQow3ov
+2N7o9B8RyvL+dikRaINNXtHwvK9SNuxqIg8+of/edhN09qjVXa5VVx+rE0HOcHXntpvCJGm6H+/0wwYM
+91fnvMeD68J/x9v2gr2DLXVFDULkMsFjIp9AErWDM0xuD2uEUB7ztriA4Ry72WTh5nIuMt+OheLbl92e
+djpD7RTvhsPB0jD+2BGjKn39+66c7ulyXQaAb8PT8HsAQyiDCjcEAAA=
+`,
+	},
+
+	"/v1.0/defs-descriptor.json": {
+		name:    "defs-descriptor.json",
+		local:   "v1.0/defs-descriptor.json",
+		size:    844,
+		modtime: 1792190037,
+		compressed: `
+H4sIAAAAAAAC/5SST2/TTBDG7/kU826jt0DiOHBAqlWKKnrnUE6t0mi6O7aneP9od6IqVPnuaG03SYtA
+cLC1+2jmefwbz9MEQBlKOnIQ9k5VoK6oZsf5liBgFNabDiOIh6+B3BfvBNlRhKuxzUe4DqS5Zo29x3ww
+3buoCnIOgLJkGL9tA+0lAMUmp7YiIVVl6QM5/ZyRFj42ZdItWSzZYkOl2aeWB7f5s5cM3ipJZNcc9IAi
+FHu8u9vL4gaLH8vibHU4/ncy/b+4Wy9mq6fl/P2Hj7vy78qmqo/YDUnKcENJjuleDVdaAh23QXwTMbSs
+Qbekv6eNhaEXfA25yN8/kJY5sOuvIwCcnmPX+MjS2ovqPI/KkLk4/ccJjFyzN5+r29liXaz2ytt3VT5f
+FjfL4uzTuljNXhFuYpf+wIfQ8QCRC6GO3sJjy7oFaTmNVGBxC/cExj+6zqMh8+v3Y4y4PcgsZI9zf08K
+oGofLea/oDaR1ajvXmCgc17w5XoCqGmkOvcZqtPiIXl3Uh4tcmkxXPdpw3uczCQ/u8nPAQD5nDLGTAMA
+AA==
+`,
+	},
+
+	"/v1.0/defs.json": {
+		name:    "defs.json",
+		local:   "v1.0/defs.json",
+		size:    1670,
+		modtime: 1792190037,
+		compressed: `
+H4sIAAAAAAAC/7STT4+bMBDF7/kUI7dH2sV/sIFre89Ke6x6oOwkcbXYyBip1YrvXjkQlgi3EhUbKYDf
+eH7v2ZjXAwB5xq52uvXaGlIC+YonbXQYddB3+Az+4mx/vtjeg78gHFs0X6zxlTbo4KnFWp90XV3bk5E3
+A0gJwQKAaOPzeQRA/O8Wg5s2Hs/oSHIrNNropm9ICZ8oy9/k6tckU6au4pDMZCq3ojlTMgYP+grP2VY8
+o0KJnEsR85iLKyMpthoVjHGuWMplngmlZJqmEcfIrDvr/j/eTsyHZdmKS+UOYJllfI3mbAe0YIUopGLF
+mi/FDnyaCyGVEKniKi2yjMU2n8pHG7huaWgNHk+khG+TAHMp/MhHh6FKPjwsPriHacvniUMS776txvQv
+L4vZ09P3yF7smVCKfRN23mlz3p7w5jH275upqdqnK3a8xo6S/fETa/92ktrKe3Tm0dkWndfYLZoAyOdX
+mgx30r+WcFjeV6GOo/U7h5pYfwt1CP/h8GcAeiKasoYGAAA=
+`,
+	},
+
+	"/v1.0/image-index-schema.json": {
+		name:    "image-index-schema.json",
+		local:   "v1.0/image-index-schema.json",
+		size:    2993,
+		modtime: 1792190037,
+		compressed: `
+H4sIAAAAAAAC/6yWQU/jOhDH7/kUI4PEpeCnJ/QOFeLy9sJpD4v2suJg7EkybGNn7SnQXeW7rxw3bdqk
+BUJ7qTL2/Of/m9iO/2QAwmDQnmomZ8UcxNca7f/OsiKLHu4qVSDcWYOv8K1GTTlp1U6dxdzzoEusVMwr
+meu5lE/B2csUvXK+kMarnC//uZYpdpbyyHQpYS6lq9HqrmRo09JsSbG8pFg+JfKqxpjqHp9Qc4rV3tXo
+mTCIOUQkAJHyv6MPCSuFh7T3JQXICRcGQsLDAFwitJWhrQxJDJ6TGqgAygJZxgK9mHXKE5jkrs2NVEc5
+qFGRpWpZiTn8u42p1y7Whpo0IiplKcfAoY/fKSvv1arnnbHqz/swTlfsy7q9bmt6/K2tRzz+WpLHWOvH
+JhrNoyF1H9Nm/XCg33sRQwUGFpvQQ098ZGEM5HcHhgskroV2dmQAl7eLw2OOHq1GAwOk+BPnHvOYbTAP
+l2bTk6u4O86kwZwsxQpBbp30FJoh9Ht8xolAFh5XjGGS1xGDZPm/68Pm1v1/jz3tVzW7wqu6JA26RP0z
+LCtICp3d5HEGZNvHWjGjt3BxoxaF88RldTu/iWvRoLm9mN73/XWzz7X0i/AmlYIFJetxOuTeVfBSki6B
+SwprFqjUCh4RjHuxC6cMmumuW1cHPdcLxbnz1dD3xzbzRmfP58FtfGwrt2PK65IYNS897uUBCLfDtLOH
+j+/jofZwfDK9PGq6147Anmwh9iY0Y5intOfCaUxdPQ++kqcwt5E9jckcVXwPp27hVveIzd2PZb/s4LP5
+bkiA5k3sZ+VJWR5HfqOH2aGnnTJCWeu4vdCFz54a24NL9lUnn3V9kWyMpcn6/2uuA0STbmdjGJ8BaLK1
+zeFZKcZugr0rXAbwkDXZ3wEAIKe/nbELAAA=
+`,
+	},
+
+	"/v1.0/image-layout-schema.json": {
+		name:    "image-layout-schema.json",
+		local:   "v1.0/image-layout-schema.json",
+		size:    439,
+		modtime: 1792190037,
+		compressed: `
+H4sIAAAAAAAC/2yPQUvEMBCF7/0VQ/SgsG0qeMp1TwvCHgQv4qG203aWbRKTqbBI/7sk0yrinsK8mS/v
+va8CQHUY20CeyVllQB092r2z3JDFAIepGRCemoubGZ7bEadG7RJ1G2UwoEZmb7Q+RWdLUSsXBt2Fpuey
+ftSi3QhH3YZEo7XzaNvNLGZMrjUlY33OxkLyxWNi3fsJ21XzwXkMTBiVgdQmOSRSEr9giFJLdv/bfsoF
+uB54RDjuD38r35HNC9dSKWGgpzPeq9324RYrciA7/Opo50kZeF1nAPVQ1VWt1vktv0sBsOQmAT9mCtj9
+INd6FIlbiu8BAJN9Z+W3AQAA
+`,
+	},
+
+	"/v1.0/image-manifest-schema.json": {
+		name:    "image-manifest-schema.json",
+		local:   "v1.0/image-manifest-schema.json",
+		size:    921,
+		modtime: 1792190037,
+		compressed: `
+H4sIAAAAAAAC/5ySMY/bMAyFd/8KQsmYRG3RyWunDEWHFl2KDqpN2QxiSqWUwwWH/PeDrCgXJTccsj7z
+PX6P1ksDoHoMnZCP5Fi1oH545G+OoyFGge1kBoTvhsliiPDTY0eWOjNPr5J9GboRJ5OsY4y+1XoXHK+z
+unEy6F6MjetPX3XWFtlHfbGEVmvnkbuyNcy2PK0pEejpTJC98egxud2/HXZnzYvzKJEwqBZSMQCVI36j
+hFwuy/edf40UwBLuewi5IQaII8K8HMpyyHnwlAPBBDAMxBEHFLUq4Y810zXsJa10vVszEdN0mFQLX940
+81y0WTrlL6pzbGm4vsBS0KbYhIYc1+UiTjbp/6nKvjdHlHBtL1RGxBwrpm3EKY1+voh0Vor5o9sBThWF
+YXZxfnkVyoPnvk5b3V6lRxtuoRa6R0tMs6WyN4V1JlWC/w8kmLD+vPcO639Sn7gB+NucmtcBALu3Dj+Z
+AwAA
 `,
 	},
 
@@ -347,6 +471,12 @@ Dj+ZAwAA
 		local: `.`,
 		isDir: true,
 	},
+
+	"/v1.0": {
+		name:  "v1.0",
+		local: `v1.0`,
+		isDir: true,
+	},
 }
 
 var _escDirs = map[string][]os.FileInfo{
@@ -359,5 +489,16 @@ var _escDirs = map[string][]os.FileInfo{
 		_escData["/image-index-schema.json"],
 		_escData["/image-layout-schema.json"],
 		_escData["/image-manifest-schema.json"],
+		_escData["/v1.0"],
+	},
+
+	"v1.0": {
+		_escData["/v1.0/config-schema.json"],
+		_escData["/v1.0/content-descriptor.json"],
+		_escData["/v1.0/defs-descriptor.json"],
+		_escData["/v1.0/defs.json"],
+		_escData["/v1.0/image-index-schema.json"],
+		_escData["/v1.0/image-layout-schema.json"],
+		_escData["/v1.0/image-manifest-schema.json"],
 	},
 }
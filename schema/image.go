@@ -0,0 +1,208 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"io/ioutil"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// A BlobProvider gives access to the content of blobs.
+type BlobProvider interface {
+	// Open returns a reader for the content of the blob described by desc.
+	// The error wraps fs.ErrNotExist if the blob is not available.
+	Open(desc v1.Descriptor) (io.ReadCloser, error)
+}
+
+// LayoutBlobProvider returns a BlobProvider reading blobs from the image layout at the root of fsys.
+func LayoutBlobProvider(fsys iofs.FS) BlobProvider {
+	return layoutBlobProvider{fsys: fsys}
+}
+
+type layoutBlobProvider struct {
+	fsys iofs.FS
+}
+
+func (p layoutBlobProvider) Open(desc v1.Descriptor) (io.ReadCloser, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid digest %q", desc.Digest)
+	}
+	return p.fsys.Open(blobPath(desc.Digest))
+}
+
+// An ImageError describes an inconsistency between the manifest, config and layers of an image.
+type ImageError struct {
+	// Field is the JSON Pointer of the inconsistent value.
+	// Pointers starting with "/config" or "/layers" refer to the manifest,
+	// all others refer to the config.
+	Field string
+
+	// Err describes the inconsistency.
+	Err error
+}
+
+func (e *ImageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+// ValidateImage checks that the manifest, its config and its layers, read from blobs, are consistent:
+// the config and layers match the digest and size of their descriptors,
+// the config lists a DiffID for each layer, matching the digest of its uncompressed content,
+// and the config history has an entry for each layer.
+//
+// Inconsistencies are reported as *ImageError in a ValidationError.
+// Layers missing from blobs are reported as warnings.
+func ValidateImage(manifest v1.Manifest, blobs BlobProvider, opts Options) (Result, error) {
+	s := &validation{opts: opts}
+	return s.finish(validateImage(manifest, blobs, s))
+}
+
+func validateImage(manifest v1.Manifest, blobs BlobProvider, s *validation) error {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, &ImageError{Field: field, Err: err})
+	}
+
+	buf, err := readBlob(blobs, manifest.Config, s.opts.Limits)
+	if err != nil {
+		fail("/config", err)
+		return ValidationError{
+			Errs: errs,
+		}
+	}
+	var config v1.Image
+	if err := json.Unmarshal(buf, &config); err != nil {
+		fail("/config", errors.Wrap(err, "config format mismatch"))
+		return ValidationError{
+			Errs: errs,
+		}
+	}
+
+	if config.RootFS.Type != "layers" {
+		fail("/rootfs/type", errors.Errorf("unsupported rootfs type %q", config.RootFS.Type))
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		fail("/rootfs/diff_ids", errors.Errorf("%d diff_ids for %d layers", len(config.RootFS.DiffIDs), len(manifest.Layers)))
+	}
+	if len(config.History) > 0 {
+		nonEmpty := 0
+		for _, h := range config.History {
+			if !h.EmptyLayer {
+				nonEmpty++
+			}
+		}
+		if nonEmpty != len(manifest.Layers) {
+			fail("/history", errors.Errorf("%d non-empty history entries for %d layers", nonEmpty, len(manifest.Layers)))
+		}
+	}
+
+	for i, layer := range manifest.Layers {
+		field := fmt.Sprintf("/layers/%d", i)
+		var diffID digest.Digest
+		if i < len(config.RootFS.DiffIDs) {
+			diffID = config.RootFS.DiffIDs[i]
+		}
+		if err := checkLayer(layer, diffID, blobs, s); err != nil {
+			fail(field, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return ValidationError{
+			Errs: errs,
+		}
+	}
+	return nil
+}
+
+// readBlob reads the JSON document described by desc within limits, checking its size and digest.
+func readBlob(blobs BlobProvider, desc v1.Descriptor, limits Limits) ([]byte, error) {
+	if err := desc.Digest.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid digest %q", desc.Digest)
+	}
+	rc, err := blobs.Open(desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	vr := &verifyingReader{r: rc, verifier: desc.Digest.Verifier()}
+	buf, err := readDocument(vr, limits)
+	if err != nil {
+		return nil, err
+	}
+	return buf, vr.check(desc)
+}
+
+// checkLayer checks the size and digest of the layer described by desc,
+// and that diffID, if not empty, matches its uncompressed content.
+func checkLayer(desc v1.Descriptor, diffID digest.Digest, blobs BlobProvider, s *validation) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid digest %q", desc.Digest)
+	}
+	rc, err := blobs.Open(desc)
+	if errors.Is(err, iofs.ErrNotExist) {
+		s.warn(Warning{
+			Code:    WarningMissingBlob,
+			Message: fmt.Sprintf("layer %s is missing", desc.Digest),
+			Digest:  desc.Digest,
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	vr := &verifyingReader{r: rc, verifier: desc.Digest.Verifier()}
+
+	c, known := layerCompression[Validator(desc.MediaType)]
+	if !known {
+		s.warn(Warning{
+			Code:    WarningUnknownMediaType,
+			Message: fmt.Sprintf("layer %s has an unknown media type: %s, its diff_id is not checked", desc.Digest, desc.MediaType),
+			Digest:  desc.Digest,
+		})
+	}
+	if known && diffID != "" {
+		if err := diffID.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid diff_id %q", diffID)
+		}
+		dr, err := decompress(vr, c)
+		if err != nil {
+			return errors.Wrap(err, "unable to decompress layer")
+		}
+		verifier := diffID.Verifier()
+		_, err = io.Copy(verifier, dr)
+		dr.Close()
+		if err != nil {
+			return errors.Wrap(err, "unable to decompress layer")
+		}
+		if !verifier.Verified() {
+			return errors.Errorf("uncompressed content does not match diff_id %s", diffID)
+		}
+	}
+
+	if _, err := io.Copy(ioutil.Discard, vr); err != nil {
+		return err
+	}
+	return vr.check(desc)
+}
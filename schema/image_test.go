@@ -0,0 +1,147 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+func TestValidateImage(t *testing.T) {
+	l := newTestLayout(t)
+
+	uncompressed := makeLayer(t, []tar.Header{{Name: "usr/", Typeflag: tar.TypeDir}})
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(uncompressed); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gzipLayer := l.addBlob(v1.MediaTypeImageLayerGzip, buf.Bytes())
+	missingLayer := v1.Descriptor{
+		MediaType: v1.MediaTypeImageLayerNonDistributableGzip,
+		Digest:    digest.FromString("missing"),
+		Size:      7,
+	}
+
+	for _, tt := range []struct {
+		name     string
+		layers   []v1.Descriptor
+		config   v1.Image
+		fail     []string // fields of the expected *schema.ImageError
+		warnings int
+	}{
+		{
+			name:   "valid",
+			layers: []v1.Descriptor{l.layer, gzipLayer},
+			config: v1.Image{
+				RootFS: v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{l.layer.Digest, digest.FromBytes(uncompressed)}},
+				History: []v1.History{
+					{CreatedBy: "ADD etc"},
+					{CreatedBy: "ENV A=B", EmptyLayer: true},
+					{CreatedBy: "ADD usr"},
+				},
+			},
+		},
+		{
+			name:   "diff_ids count and history mismatch",
+			layers: []v1.Descriptor{l.layer, gzipLayer},
+			config: v1.Image{
+				RootFS:  v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{l.layer.Digest}},
+				History: []v1.History{{CreatedBy: "ADD etc"}},
+			},
+			fail: []string{"/rootfs/diff_ids", "/history"},
+		},
+		{
+			name:   "diff_id of a compressed layer is its compressed digest",
+			layers: []v1.Descriptor{gzipLayer},
+			config: v1.Image{
+				RootFS: v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{gzipLayer.Digest}},
+			},
+			fail: []string{"/layers/0"},
+		},
+		{
+			name:   "layer size mismatch",
+			layers: []v1.Descriptor{{MediaType: l.layer.MediaType, Digest: l.layer.Digest, Size: 1}},
+			config: v1.Image{
+				RootFS: v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{l.layer.Digest}},
+			},
+			fail: []string{"/layers/0"},
+		},
+		{
+			name:   "missing non-distributable layer",
+			layers: []v1.Descriptor{l.layer, missingLayer},
+			config: v1.Image{
+				RootFS: v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{l.layer.Digest, digest.FromString("diff")}},
+			},
+			warnings: 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.OS = "linux"
+			tt.config.Architecture = "amd64"
+			manifest := v1.Manifest{
+				Versioned: specs.Versioned{SchemaVersion: 2},
+				Config:    l.addBlob(v1.MediaTypeImageConfig, mustMarshal(t, tt.config)),
+				Layers:    tt.layers,
+			}
+
+			result, err := schema.ValidateImage(manifest, schema.LayoutBlobProvider(l.fsys), schema.Options{})
+			if len(tt.fail) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tt.fail) > 0 {
+				verr, ok := errors.Cause(err).(schema.ValidationError)
+				if !ok {
+					t.Fatalf("expected a validation error, got %v", err)
+				}
+				if len(verr.Errs) != len(tt.fail) {
+					t.Fatalf("expected errors for %v, got %v", tt.fail, verr.Errs)
+				}
+				for i, e := range verr.Errs {
+					ierr, ok := e.(*schema.ImageError)
+					if !ok || ierr.Field != tt.fail[i] {
+						t.Fatalf("expected errors for %v, got %v", tt.fail, verr.Errs)
+					}
+				}
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("expected %d warnings, got %v", tt.warnings, result.Warnings)
+			}
+		})
+	}
+
+	// the config must match its descriptor
+	manifest := v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    l.config,
+		Layers:    []v1.Descriptor{l.layer},
+	}
+	manifest.Config.Size--
+	_, err := schema.ValidateImage(manifest, schema.LayoutBlobProvider(l.fsys), schema.Options{})
+	if verr, ok := errors.Cause(err).(schema.ValidationError); !ok || len(verr.Errs) != 1 {
+		t.Errorf("expected a config error, got %v", err)
+	}
+}
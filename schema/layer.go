@@ -0,0 +1,214 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// compression identifies the compression applied to a layer tar archive.
+type compression int
+
+const (
+	compressionNone compression = iota
+	compressionGzip
+	compressionZstd
+)
+
+// layerCompression maps the layer media types to the compression of their payload.
+var layerCompression = map[Validator]compression{
+	v1.MediaTypeImageLayer:                     compressionNone,
+	v1.MediaTypeImageLayerGzip:                 compressionGzip,
+	v1.MediaTypeImageLayerZstd:                 compressionZstd,
+	v1.MediaTypeImageLayerNonDistributable:     compressionNone,
+	v1.MediaTypeImageLayerNonDistributableGzip: compressionGzip,
+	v1.MediaTypeImageLayerNonDistributableZstd: compressionZstd,
+}
+
+const (
+	// whiteoutPrefix prefixes the basename of a whiteout file.
+	whiteoutPrefix = ".wh."
+
+	// whiteoutMetaPrefix prefixes reserved whiteout names, such as the opaque whiteout.
+	whiteoutMetaPrefix = whiteoutPrefix + whiteoutPrefix
+
+	// whiteoutOpaque is the basename of an opaque whiteout file.
+	whiteoutOpaque = whiteoutMetaPrefix + ".opq"
+)
+
+// decompress returns a reader for the tar archive of a layer compressed with c.
+func decompress(r io.Reader, c compression) (io.ReadCloser, error) {
+	switch c {
+	case compressionGzip:
+		return gzip.NewReader(r)
+	case compressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(r), nil
+	}
+}
+
+// layerEntry records an entry already seen in a layer archive.
+type layerEntry struct {
+	index    int
+	typeflag byte
+}
+
+// whiteoutEntry records a whiteout file of a layer archive.
+type whiteoutEntry struct {
+	index int
+	name  string
+}
+
+// validateLayer walks the layer tar archive read from r and checks its entries against layer.md.
+func validateLayer(r io.Reader, c compression, s *validation) error {
+	rc, err := decompress(r, c)
+	if err != nil {
+		return errors.Wrap(err, "unable to decompress layer")
+	}
+	defer rc.Close()
+
+	var errs []error
+	fail := func(index int, name, format string, args ...interface{}) {
+		errs = append(errs, &LayerError{
+			Entry:       index,
+			Path:        name,
+			Description: fmt.Sprintf(format, args...),
+		})
+	}
+
+	seen := map[string]layerEntry{}
+	whiteouts := map[string]whiteoutEntry{}
+
+	tr := tar.NewReader(rc)
+	for index := 0; ; index++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to read layer archive")
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+			// pax global headers, e.g. from git archive, hold metadata of the archive, not a file
+			continue
+		case tar.TypeReg, tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+		case tar.TypeGNUSparse:
+			s.warn(Warning{
+				Code:    WarningSparseFile,
+				Message: fmt.Sprintf("entry %d %q is a sparse file", index, hdr.Name),
+			})
+		default:
+			fail(index, hdr.Name, "unsupported file type %q", hdr.Typeflag)
+		}
+
+		name, ok := cleanLayerPath(hdr.Name)
+		if !ok {
+			fail(index, hdr.Name, "path escapes the root of the layer")
+			continue
+		}
+
+		if prev, ok := seen[name]; ok {
+			fail(index, hdr.Name, "duplicate of entry %d", prev.index)
+		}
+		seen[name] = layerEntry{index: index, typeflag: hdr.Typeflag}
+
+		if hdr.Typeflag == tar.TypeLink {
+			target, ok := cleanLayerPath(hdr.Linkname)
+			switch entry, found := seen[target]; {
+			case !ok:
+				fail(index, hdr.Name, "hardlink target %q escapes the root of the layer", hdr.Linkname)
+			case !found || entry.index == index:
+				fail(index, hdr.Name, "hardlink target %q is not an earlier entry", hdr.Linkname)
+			case entry.typeflag == tar.TypeDir:
+				fail(index, hdr.Name, "hardlink target %q is a directory", hdr.Linkname)
+			}
+		}
+
+		if name == "." {
+			continue
+		}
+		dir, base := path.Split(name)
+		for _, component := range strings.Split(strings.TrimSuffix(dir, "/"), "/") {
+			if strings.HasPrefix(component, whiteoutPrefix) {
+				fail(index, hdr.Name, "parent directory %q has a whiteout name", component)
+				break
+			}
+		}
+		if !strings.HasPrefix(base, whiteoutPrefix) {
+			continue
+		}
+
+		if hdr.Typeflag != tar.TypeReg || hdr.Size != 0 {
+			fail(index, hdr.Name, "whiteout is not an empty regular file")
+		}
+		switch {
+		case base == whiteoutOpaque:
+		case strings.HasPrefix(base, whiteoutMetaPrefix):
+			fail(index, hdr.Name, "reserved whiteout name")
+		case base == whiteoutPrefix:
+			fail(index, hdr.Name, "whiteout has no target")
+		default:
+			whiteouts[path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))] = whiteoutEntry{index: index, name: hdr.Name}
+		}
+	}
+
+	// Whiteouts may precede or follow their target, so they are checked once the whole archive is read.
+	targets := make([]string, 0, len(whiteouts))
+	for target := range whiteouts {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return whiteouts[targets[i]].index < whiteouts[targets[j]].index })
+	for _, target := range targets {
+		if entry, ok := seen[target]; ok {
+			wh := whiteouts[target]
+			fail(wh.index, wh.name, "whiteout target %q is entry %d of the same layer", target, entry.index)
+		}
+	}
+
+	if len(errs) > 0 {
+		return ValidationError{
+			Errs: errs,
+		}
+	}
+	return nil
+}
+
+// cleanLayerPath returns the path of a layer entry relative to the root of the layer,
+// or false if the path refers to a location outside of it.
+func cleanLayerPath(name string) (string, bool) {
+	p := path.Clean(strings.TrimLeft(name, "/"))
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
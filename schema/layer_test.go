@@ -0,0 +1,224 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+// makeLayer returns an uncompressed tar archive holding the given headers.
+// Regular files are filled with zero bytes up to their size.
+func makeLayer(t *testing.T, hdrs []tar.Header) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := range hdrs {
+		hdr := hdrs[i]
+		if hdr.Mode == 0 && hdr.Typeflag != tar.TypeXGlobalHeader {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			if _, err := tw.Write(make([]byte, hdr.Size)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLayer(t *testing.T) {
+	for i, tt := range []struct {
+		entries []tar.Header
+		fail    []int // entries expected to be reported
+	}{
+		// valid layer with whiteouts and a hardlink
+		{
+			entries: []tar.Header{
+				{Name: "./", Typeflag: tar.TypeDir},
+				{Name: "a/", Typeflag: tar.TypeDir},
+				{Name: "a/.wh..wh..opq", Typeflag: tar.TypeReg},
+				{Name: "a/b", Typeflag: tar.TypeReg, Size: 4},
+				{Name: "a/c", Typeflag: tar.TypeLink, Linkname: "a/b"},
+				{Name: "a/.wh.d", Typeflag: tar.TypeReg},
+				{Name: "a/l", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"},
+				{Name: "dev/null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3},
+				{Name: "fifo", Typeflag: tar.TypeFifo},
+			},
+		},
+
+		// valid layer with pax global headers, which are not files
+		{
+			entries: []tar.Header{
+				{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "0123456789abcdef"}},
+				{Name: "pax_global_header", Typeflag: tar.TypeReg, Size: 4},
+				{Name: "a/", Typeflag: tar.TypeDir},
+				{Name: "pax_global_header", Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "again"}},
+				{Name: "a/b", Typeflag: tar.TypeReg},
+			},
+		},
+
+		// expected failure: duplicate paths, including "a/" and "./a"
+		{
+			entries: []tar.Header{
+				{Name: "a/", Typeflag: tar.TypeDir},
+				{Name: "./a", Typeflag: tar.TypeDir},
+				{Name: "b", Typeflag: tar.TypeReg},
+				{Name: "/b", Typeflag: tar.TypeReg},
+			},
+			fail: []int{1, 3},
+		},
+
+		// expected failure: entries escaping the root
+		{
+			entries: []tar.Header{
+				{Name: "../a", Typeflag: tar.TypeReg},
+				{Name: "b/../../c", Typeflag: tar.TypeReg},
+				{Name: "d", Typeflag: tar.TypeLink, Linkname: "../etc/passwd"},
+			},
+			fail: []int{0, 1, 2},
+		},
+
+		// expected failure: hardlinks to later, missing and directory entries
+		{
+			entries: []tar.Header{
+				{Name: "a", Typeflag: tar.TypeLink, Linkname: "b"},
+				{Name: "b", Typeflag: tar.TypeReg},
+				{Name: "c", Typeflag: tar.TypeLink, Linkname: "missing"},
+				{Name: "d/", Typeflag: tar.TypeDir},
+				{Name: "e", Typeflag: tar.TypeLink, Linkname: "d"},
+			},
+			fail: []int{0, 2, 4},
+		},
+
+		// expected failure: malformed whiteouts
+		{
+			entries: []tar.Header{
+				{Name: ".wh.", Typeflag: tar.TypeReg},
+				{Name: ".wh..wh.plnk", Typeflag: tar.TypeReg},
+				{Name: ".wh.a", Typeflag: tar.TypeReg, Size: 1},
+				{Name: ".wh.b/", Typeflag: tar.TypeDir},
+				{Name: ".wh.b/c", Typeflag: tar.TypeReg},
+			},
+			fail: []int{0, 1, 2, 3, 4},
+		},
+
+		// expected failure: whiteout and its target in the same layer, in either order
+		{
+			entries: []tar.Header{
+				{Name: "a/", Typeflag: tar.TypeDir},
+				{Name: "a/.wh.b", Typeflag: tar.TypeReg},
+				{Name: "a/b", Typeflag: tar.TypeReg},
+				{Name: "c", Typeflag: tar.TypeReg},
+				{Name: ".wh.c", Typeflag: tar.TypeReg},
+			},
+			fail: []int{1, 4},
+		},
+
+		// expected failure: unsupported file type
+		{
+			entries: []tar.Header{
+				{Name: "a", Typeflag: tar.TypeCont},
+			},
+			fail: []int{0},
+		},
+	} {
+		layer := makeLayer(t, tt.entries)
+		err := schema.ValidatorMediaTypeImageLayer.Validate(bytes.NewReader(layer))
+		if len(tt.fail) == 0 {
+			if err != nil {
+				t.Errorf("test %d: unexpected error %v", i, err)
+			}
+			continue
+		}
+
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok {
+			t.Errorf("test %d: expected a validation error, got %v", i, err)
+			continue
+		}
+		var got []int
+		for _, e := range verr.Errs {
+			lerr, ok := e.(*schema.LayerError)
+			if !ok {
+				t.Errorf("test %d: expected *schema.LayerError, got %T", i, e)
+				continue
+			}
+			got = append(got, lerr.Entry)
+		}
+		if len(got) != len(tt.fail) {
+			t.Errorf("test %d: expected failing entries %v, got %v (%v)", i, tt.fail, got, err)
+			continue
+		}
+		for j := range got {
+			if got[j] != tt.fail[j] {
+				t.Errorf("test %d: expected failing entries %v, got %v (%v)", i, tt.fail, got, err)
+				break
+			}
+		}
+	}
+}
+
+func TestLayerCompression(t *testing.T) {
+	layer := makeLayer(t, []tar.Header{
+		{Name: "a", Typeflag: tar.TypeReg, Size: 3},
+		{Name: "a", Typeflag: tar.TypeReg},
+	})
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	if _, err := gw.Write(layer); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zst := zw.EncodeAll(layer, nil)
+
+	for _, tt := range []struct {
+		validator schema.Validator
+		layer     []byte
+	}{
+		{schema.ValidatorMediaTypeImageLayer, layer},
+		{schema.ValidatorMediaTypeImageLayerGzip, gz.Bytes()},
+		{schema.ValidatorMediaTypeImageLayerZstd, zst},
+	} {
+		err := tt.validator.Validate(bytes.NewReader(tt.layer))
+		if _, ok := errors.Cause(err).(schema.ValidationError); !ok {
+			t.Errorf("%s: expected the duplicate entry to be reported, got %v", tt.validator, err)
+		}
+	}
+
+	// a gzip validator does not accept an uncompressed layer
+	if err := schema.ValidatorMediaTypeImageLayerGzip.Validate(bytes.NewReader(layer)); err == nil {
+		t.Error("expected an error for an uncompressed layer")
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	_ "crypto/sha256" // side-effect to install impls, sha256
+	_ "crypto/sha512" // side-effect to install impls, sha384/sh512
+	"encoding/json"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	// layoutBlobsDir is the directory of an image layout holding the blobs.
+	layoutBlobsDir = "blobs"
+
+	// layoutIndexFile is the file of an image layout holding its image index.
+	layoutIndexFile = "index.json"
+)
+
+var (
+	// layoutAlgorithmRegexp matches the <alg> directory names of an image layout.
+	layoutAlgorithmRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*$`)
+
+	// layoutEncodedRegexp matches the <encoded> blob names of an image layout.
+	layoutEncodedRegexp = regexp.MustCompile(`^[a-zA-Z0-9=_-]+$`)
+)
+
+// ValidateLayoutDir validates the image layout in the directory dir.
+// See ValidateLayout.
+func ValidateLayoutDir(dir string, opts Options) (Result, error) {
+	return ValidateLayout(os.DirFS(dir), opts)
+}
+
+// ValidateLayout validates the image layout at the root of fsys.
+//
+// It validates the oci-layout and index.json files,
+// checks that every blob matches its digest,
+// and walks all blobs reachable from index.json,
+// checking their size against the referencing descriptor
+// and validating them according to their media type.
+// Referenced blobs missing from the layout are reported as warnings.
+//
+// Problems are reported as *LayoutError in a ValidationError.
+func ValidateLayout(fsys iofs.FS, opts Options) (Result, error) {
+	s := &validation{opts: opts}
+	l := &layoutValidation{
+		fsys:    fsys,
+		s:       s,
+		visited: map[digest.Digest]bool{},
+	}
+	return s.finish(l.validate())
+}
+
+// layoutValidation carries the state of a single ValidateLayout call.
+type layoutValidation struct {
+	fsys    iofs.FS
+	s       *validation
+	errs    []error
+	visited map[digest.Digest]bool
+}
+
+func (l *layoutValidation) fail(p string, err error) {
+	l.errs = append(l.errs, &LayoutError{Path: p, Err: err})
+}
+
+func (l *layoutValidation) validate() error {
+	if err := l.validateFile(v1.ImageLayoutFile, ValidatorMediaTypeLayoutHeader); err != nil {
+		l.fail(v1.ImageLayoutFile, err)
+	}
+
+	if fi, err := iofs.Stat(l.fsys, layoutBlobsDir); err != nil {
+		l.fail(layoutBlobsDir, err)
+	} else if !fi.IsDir() {
+		l.fail(layoutBlobsDir, errors.New("not a directory"))
+	}
+
+	var buf []byte
+	f, err := l.fsys.Open(layoutIndexFile)
+	if err == nil {
+		buf, err = readDocument(f, l.s.opts.Limits)
+		f.Close()
+	}
+	if err == nil {
+		err = ValidatorMediaTypeImageIndex.validateDocument(buf, l.s)
+	}
+	if err != nil {
+		l.fail(layoutIndexFile, err)
+	} else {
+		var index v1.Index
+		if err := json.Unmarshal(buf, &index); err != nil {
+			l.fail(layoutIndexFile, err)
+		}
+		for i, desc := range index.Manifests {
+			l.walk(fmt.Sprintf("%s/manifests/%d", layoutIndexFile, i), desc)
+		}
+	}
+
+	l.checkUnreferenced()
+
+	if len(l.errs) > 0 {
+		return ValidationError{
+			Errs: l.errs,
+		}
+	}
+	return nil
+}
+
+// validateFile validates the file p of the layout with the validator v.
+func (l *layoutValidation) validateFile(p string, v Validator) error {
+	f, err := l.fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return v.validate(f, l.s)
+}
+
+// walk checks the blob referenced by desc and all blobs reachable from it.
+// ref describes where desc was found, for error messages.
+func (l *layoutValidation) walk(ref string, desc v1.Descriptor) {
+	if err := desc.Digest.Validate(); err == digest.ErrDigestUnsupported {
+		l.s.warn(Warning{
+			Code:    WarningUnsupportedDigest,
+			Message: fmt.Sprintf("unsupported digest: %q: %v", desc.Digest, err),
+			Digest:  desc.Digest,
+		})
+		return
+	} else if err != nil {
+		l.fail(ref, errors.Wrapf(err, "invalid digest %q", desc.Digest))
+		return
+	}
+	if l.visited[desc.Digest] {
+		return
+	}
+	l.visited[desc.Digest] = true
+
+	p := blobPath(desc.Digest)
+	f, err := l.fsys.Open(p)
+	if errors.Is(err, iofs.ErrNotExist) {
+		l.s.warn(Warning{
+			Code:    WarningMissingBlob,
+			Message: fmt.Sprintf("blob %s referenced by %s is missing", desc.Digest, ref),
+			Digest:  desc.Digest,
+		})
+		return
+	}
+	if err != nil {
+		l.fail(p, err)
+		return
+	}
+	defer f.Close()
+
+	vr := &verifyingReader{r: f, verifier: desc.Digest.Verifier()}
+	var children []v1.Descriptor
+	switch desc.MediaType {
+	case v1.MediaTypeImageIndex, v1.MediaTypeImageManifest:
+		var buf []byte
+		buf, err = readDocument(vr, l.s.opts.Limits)
+		if err == nil {
+			err = Validator(desc.MediaType).validateDocument(buf, l.s)
+		}
+		if err == nil {
+			children, err = referencedDescriptors(desc.MediaType, buf)
+		}
+	default:
+		if _, ok := l.s.registry().lookup(desc.MediaType); ok {
+			err = Validator(desc.MediaType).validate(vr, l.s)
+		}
+	}
+	if err != nil {
+		l.fail(p, err)
+	}
+
+	// Drain what the validator left unread so that the whole blob is verified.
+	if _, err := io.Copy(ioutil.Discard, vr); err != nil {
+		l.fail(p, err)
+		return
+	}
+	if err := vr.check(desc); err != nil {
+		l.fail(p, errors.Wrapf(err, "referenced by %s", ref))
+	}
+
+	for i, child := range children {
+		l.walk(fmt.Sprintf("%s%s", p, childPointer(desc.MediaType, i)), child)
+	}
+}
+
+// checkUnreferenced checks the name and content of the blobs which are not reachable from index.json.
+func (l *layoutValidation) checkUnreferenced() {
+	algs, err := iofs.ReadDir(l.fsys, layoutBlobsDir)
+	if err != nil {
+		return // reported by validate
+	}
+	for _, alg := range algs {
+		dir := path.Join(layoutBlobsDir, alg.Name())
+		if !alg.IsDir() || !layoutAlgorithmRegexp.MatchString(alg.Name()) {
+			l.fail(dir, errors.New("not a valid digest algorithm directory"))
+			continue
+		}
+		blobs, err := iofs.ReadDir(l.fsys, dir)
+		if err != nil {
+			l.fail(dir, err)
+			continue
+		}
+		for _, blob := range blobs {
+			p := path.Join(dir, blob.Name())
+			if !blob.Type().IsRegular() || !layoutEncodedRegexp.MatchString(blob.Name()) {
+				l.fail(p, errors.New("not a valid blob"))
+				continue
+			}
+			dgst := digest.NewDigestFromEncoded(digest.Algorithm(alg.Name()), blob.Name())
+			if l.visited[dgst] {
+				continue
+			}
+			if err := dgst.Validate(); err == digest.ErrDigestUnsupported {
+				l.s.warn(Warning{
+					Code:    WarningUnsupportedDigest,
+					Message: fmt.Sprintf("unsupported digest: %q: %v", dgst, err),
+					Digest:  dgst,
+				})
+				continue
+			} else if err != nil {
+				l.fail(p, err)
+				continue
+			}
+			if err := l.verifyBlob(p, dgst); err != nil {
+				l.fail(p, err)
+			}
+		}
+	}
+}
+
+// verifyBlob checks that the content of the blob p matches dgst.
+func (l *layoutValidation) verifyBlob(p string, dgst digest.Digest) error {
+	f, err := l.fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(verifier, f); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return errors.Errorf("content does not match digest %s", dgst)
+	}
+	return nil
+}
+
+// blobPath returns the path of the blob with the digest dgst relative to the root of an image layout.
+func blobPath(dgst digest.Digest) string {
+	return path.Join(layoutBlobsDir, dgst.Algorithm().String(), dgst.Encoded())
+}
+
+// referencedDescriptors returns the descriptors referenced by an index or a manifest.
+func referencedDescriptors(mediaType string, buf []byte) ([]v1.Descriptor, error) {
+	switch mediaType {
+	case v1.MediaTypeImageIndex:
+		var index v1.Index
+		if err := json.Unmarshal(buf, &index); err != nil {
+			return nil, err
+		}
+		return index.Manifests, nil
+	case v1.MediaTypeImageManifest:
+		var manifest v1.Manifest
+		if err := json.Unmarshal(buf, &manifest); err != nil {
+			return nil, err
+		}
+		return append([]v1.Descriptor{manifest.Config}, manifest.Layers...), nil
+	}
+	return nil, nil
+}
+
+// childPointer returns the JSON Pointer of the i-th descriptor returned by referencedDescriptors.
+func childPointer(mediaType string, i int) string {
+	switch {
+	case mediaType == v1.MediaTypeImageIndex:
+		return fmt.Sprintf("/manifests/%d", i)
+	case i == 0:
+		return "/config"
+	default:
+		return fmt.Sprintf("/layers/%d", i-1)
+	}
+}
+
+// verifyingReader counts and verifies the bytes read through it.
+type verifyingReader struct {
+	r        io.Reader
+	verifier digest.Verifier
+	n        int64
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.verifier.Write(p[:n])
+	return n, err
+}
+
+// check returns an error if the content read does not match the size and digest of desc.
+func (r *verifyingReader) check(desc v1.Descriptor) error {
+	if r.n != desc.Size {
+		return errors.Errorf("size %d does not match the descriptor size %d", r.n, desc.Size)
+	}
+	if !r.verifier.Verified() {
+		return errors.Errorf("content does not match digest %s", desc.Digest)
+	}
+	return nil
+}
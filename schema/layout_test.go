@@ -0,0 +1,221 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"path"
+	"testing"
+	"testing/fstest"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// testLayout is an image layout with a single image, built by newTestLayout.
+type testLayout struct {
+	fsys     fstest.MapFS
+	manifest v1.Descriptor
+	config   v1.Descriptor
+	layer    v1.Descriptor
+}
+
+// addBlob stores p as a blob of the layout and returns its descriptor.
+func (l *testLayout) addBlob(mediaType string, p []byte) v1.Descriptor {
+	dgst := digest.FromBytes(p)
+	l.fsys[path.Join("blobs", dgst.Algorithm().String(), dgst.Encoded())] = &fstest.MapFile{Data: p}
+	return v1.Descriptor{
+		MediaType: mediaType,
+		Digest:    dgst,
+		Size:      int64(len(p)),
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	p, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func newTestLayout(t *testing.T) *testLayout {
+	l := &testLayout{
+		fsys: fstest.MapFS{
+			"oci-layout": &fstest.MapFile{Data: []byte(`{"imageLayoutVersion": "1.0.0"}`)},
+		},
+	}
+
+	l.layer = l.addBlob(v1.MediaTypeImageLayer, makeLayer(t, []tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir},
+		{Name: "etc/hostname", Typeflag: tar.TypeReg, Size: 8},
+	}))
+	l.config = l.addBlob(v1.MediaTypeImageConfig, mustMarshal(t, v1.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS: v1.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{l.layer.Digest},
+		},
+	}))
+	l.manifest = l.addBlob(v1.MediaTypeImageManifest, mustMarshal(t, v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    l.config,
+		Layers:    []v1.Descriptor{l.layer},
+	}))
+	l.writeIndex(t, l.manifest)
+	return l
+}
+
+func (l *testLayout) writeIndex(t *testing.T, manifests ...v1.Descriptor) {
+	l.fsys["index.json"] = &fstest.MapFile{Data: mustMarshal(t, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: manifests,
+	})}
+}
+
+// layoutBlob returns the path of the blob described by desc in an image layout.
+func layoutBlob(desc v1.Descriptor) string {
+	return path.Join("blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+}
+
+func TestValidateLayout(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// modify breaks the layout and returns the paths of the expected *schema.LayoutError
+		modify   func(t *testing.T, l *testLayout) []string
+		warnings []schema.WarningCode
+	}{
+		{
+			name:   "valid",
+			modify: func(t *testing.T, l *testLayout) []string { return nil },
+		},
+		{
+			name: "missing oci-layout and index.json",
+			modify: func(t *testing.T, l *testLayout) []string {
+				delete(l.fsys, "oci-layout")
+				delete(l.fsys, "index.json")
+				return []string{"oci-layout", "index.json"}
+			},
+		},
+		{
+			name: "invalid oci-layout",
+			modify: func(t *testing.T, l *testLayout) []string {
+				l.fsys["oci-layout"] = &fstest.MapFile{Data: []byte(`{"imageLayoutVersion": "2.0.0"}`)}
+				return []string{"oci-layout"}
+			},
+		},
+		{
+			name: "corrupted layer",
+			modify: func(t *testing.T, l *testLayout) []string {
+				p := layoutBlob(l.layer)
+				l.fsys[p].Data = append([]byte(nil), l.fsys[p].Data...)
+				l.fsys[p].Data[1024] = 'x' // content of etc/hostname
+				return []string{p}
+			},
+		},
+		{
+			name: "size mismatch",
+			modify: func(t *testing.T, l *testLayout) []string {
+				l.manifest.Size++
+				l.writeIndex(t, l.manifest)
+				return []string{layoutBlob(l.manifest)}
+			},
+		},
+		{
+			name: "invalid layer",
+			modify: func(t *testing.T, l *testLayout) []string {
+				layer := l.addBlob(v1.MediaTypeImageLayer, makeLayer(t, []tar.Header{
+					{Name: "a", Typeflag: tar.TypeReg},
+					{Name: "a", Typeflag: tar.TypeReg},
+				}))
+				manifest := l.addBlob(v1.MediaTypeImageManifest, mustMarshal(t, v1.Manifest{
+					Versioned: specs.Versioned{SchemaVersion: 2},
+					Config:    l.config,
+					Layers:    []v1.Descriptor{layer},
+				}))
+				l.writeIndex(t, l.manifest, manifest)
+				return []string{layoutBlob(layer)}
+			},
+		},
+		{
+			name: "missing config",
+			modify: func(t *testing.T, l *testLayout) []string {
+				delete(l.fsys, layoutBlob(l.config))
+				return nil
+			},
+			warnings: []schema.WarningCode{schema.WarningMissingBlob},
+		},
+		{
+			name: "unreferenced blobs",
+			modify: func(t *testing.T, l *testLayout) []string {
+				l.addBlob("", []byte("unreferenced"))
+				corrupted := "blobs/sha256/" + digest.FromString("other").Encoded()
+				l.fsys[corrupted] = &fstest.MapFile{Data: []byte("corrupted")}
+				l.fsys["blobs/sha256/not.valid"] = &fstest.MapFile{Data: []byte("corrupted")}
+				return []string{corrupted, "blobs/sha256/not.valid"}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLayout(t)
+			fail := tt.modify(t, l)
+
+			result, err := schema.ValidateLayout(l.fsys, schema.Options{})
+			if len(fail) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(fail) > 0 {
+				verr, ok := errors.Cause(err).(schema.ValidationError)
+				if !ok {
+					t.Fatalf("expected a validation error, got %v", err)
+				}
+				var got []string
+				for _, e := range verr.Errs {
+					lerr, ok := e.(*schema.LayoutError)
+					if !ok {
+						t.Fatalf("expected *schema.LayoutError, got %T", e)
+					}
+					got = append(got, lerr.Path)
+				}
+				if len(got) != len(fail) {
+					t.Fatalf("expected errors for %v, got %v", fail, verr.Errs)
+				}
+				for i := range got {
+					if got[i] != fail[i] {
+						t.Fatalf("expected errors for %v, got %v", fail, verr.Errs)
+					}
+				}
+			}
+
+			var codes []schema.WarningCode
+			for _, w := range result.Warnings {
+				codes = append(codes, w.Code)
+			}
+			if len(codes) != len(tt.warnings) {
+				t.Fatalf("expected warnings %v, got %v", tt.warnings, result.Warnings)
+			}
+			for i := range codes {
+				if codes[i] != tt.warnings[i] {
+					t.Fatalf("expected warnings %v, got %v", tt.warnings, result.Warnings)
+				}
+			}
+		})
+	}
+}
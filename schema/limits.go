@@ -0,0 +1,182 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Limits bounds the resources spent on validating JSON documents from untrusted sources.
+// A zero field means no limit.
+type Limits struct {
+	// MaxDocumentSize is the maximum size of a document in bytes.
+	MaxDocumentSize int64
+
+	// MaxArrayLength is the maximum number of elements of any array, such as "layers" or "manifests".
+	MaxArrayLength int
+
+	// MaxAnnotations is the maximum number of entries of any "annotations" object.
+	MaxAnnotations int
+
+	// MaxAnnotationSize is the maximum size in bytes of the key plus the value of an annotation.
+	MaxAnnotationSize int
+
+	// MaxDepth is the maximum nesting depth of objects and arrays.
+	MaxDepth int
+}
+
+// DefaultLimits are limits suitable for validating documents received from a registry client.
+// The document size matches the manifest size limit commonly enforced by registries.
+var DefaultLimits = Limits{
+	MaxDocumentSize:   4 << 20,
+	MaxArrayLength:    10000,
+	MaxAnnotations:    1000,
+	MaxAnnotationSize: 64 << 10,
+	MaxDepth:          32,
+}
+
+// structural reports whether l limits anything beyond the document size.
+func (l Limits) structural() bool {
+	return l.MaxArrayLength > 0 || l.MaxAnnotations > 0 || l.MaxAnnotationSize > 0 || l.MaxDepth > 0
+}
+
+// A LimitError is returned when a document exceeds one of its Limits.
+// Validation stops at the first exceeded limit.
+type LimitError struct {
+	// Limit is the name of the exceeded Limits field, e.g. "MaxDocumentSize".
+	Limit string
+
+	// Max is the value of the exceeded limit.
+	Max int64
+
+	// Field is the JSON Pointer of the value exceeding the limit,
+	// or "" if the limit applies to the whole document.
+	Field string
+}
+
+func (e *LimitError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("document exceeds %s of %d", e.Limit, e.Max)
+	}
+	return fmt.Sprintf("%s: document exceeds %s of %d", e.Field, e.Limit, e.Max)
+}
+
+// readDocument reads a JSON document from src, enforcing limits while reading.
+// Reading stops as soon as a limit is exceeded.
+func readDocument(src io.Reader, limits Limits) ([]byte, error) {
+	if limits.MaxDocumentSize > 0 {
+		src = io.LimitReader(src, limits.MaxDocumentSize+1)
+	}
+
+	var buf bytes.Buffer
+	if limits.structural() {
+		// The decoder reads through buf, which keeps what it read for the schema validation.
+		if err := checkLimits(json.NewDecoder(io.TeeReader(src, &buf)), limits); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := buf.ReadFrom(src); err != nil {
+		return nil, errors.Wrap(err, "unable to read the document file")
+	}
+
+	if limits.MaxDocumentSize > 0 && int64(buf.Len()) > limits.MaxDocumentSize {
+		return nil, &LimitError{Limit: "MaxDocumentSize", Max: limits.MaxDocumentSize}
+	}
+	return buf.Bytes(), nil
+}
+
+// limitFrame is an object or array being scanned by checkLimits.
+type limitFrame struct {
+	ptr         string
+	array       bool
+	annotations bool
+	wantKey     bool
+	key         string
+	n           int
+}
+
+// checkLimits scans the tokens of the document read by dec and returns a *LimitError
+// for the first value exceeding limits.
+// Syntax errors are left to the schema validation and end the scan without error.
+func checkLimits(dec *json.Decoder, limits Limits) error {
+	var stack []limitFrame
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return nil
+			}
+			continue
+		}
+
+		ptr := ""
+		if len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			switch {
+			case top.wantKey:
+				top.wantKey = false
+				top.key, _ = tok.(string)
+				top.n++
+				if top.annotations && limits.MaxAnnotations > 0 && top.n > limits.MaxAnnotations {
+					return &LimitError{Limit: "MaxAnnotations", Max: int64(limits.MaxAnnotations), Field: top.ptr}
+				}
+				continue
+			case top.array:
+				top.n++
+				if limits.MaxArrayLength > 0 && top.n > limits.MaxArrayLength {
+					return &LimitError{Limit: "MaxArrayLength", Max: int64(limits.MaxArrayLength), Field: top.ptr}
+				}
+				ptr = top.ptr + "/" + strconv.Itoa(top.n-1)
+			default:
+				top.wantKey = true
+				ptr = top.ptr + "/" + escapePointer(top.key)
+				if value, ok := tok.(string); ok && top.annotations && limits.MaxAnnotationSize > 0 &&
+					len(top.key)+len(value) > limits.MaxAnnotationSize {
+					return &LimitError{Limit: "MaxAnnotationSize", Max: int64(limits.MaxAnnotationSize), Field: ptr}
+				}
+			}
+		}
+
+		d, ok := tok.(json.Delim)
+		if !ok {
+			if len(stack) == 0 {
+				return nil
+			}
+			continue
+		}
+		if limits.MaxDepth > 0 && len(stack) >= limits.MaxDepth {
+			return &LimitError{Limit: "MaxDepth", Max: int64(limits.MaxDepth), Field: ptr}
+		}
+		frame := limitFrame{
+			ptr:     ptr,
+			array:   d == '[',
+			wantKey: d == '{',
+		}
+		if n := len(stack); d == '{' && n > 0 && !stack[n-1].array && stack[n-1].key == "annotations" {
+			frame.annotations = true
+		}
+		stack = append(stack, frame)
+	}
+}
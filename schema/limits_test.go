@@ -0,0 +1,137 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+// repeatReader endlessly repeats its content.
+type repeatReader string
+
+func (r repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r[i%len(r)]
+	}
+	return len(p) - len(p)%len(r), nil
+}
+
+const limitsManifest = `{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.oci.image.config.v1+json",
+    "size": 1470,
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    },
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd",
+      "annotations": {
+        "com.example.a": "aaaaaaaa",
+        "com.example.b": "b"
+      }
+    }
+  ]
+}`
+
+func TestLimits(t *testing.T) {
+	for i, tt := range []struct {
+		doc    io.Reader
+		limits schema.Limits
+		limit  string
+		field  string
+	}{
+		{
+			doc:    strings.NewReader(limitsManifest),
+			limits: schema.Limits{MaxDocumentSize: 100},
+			limit:  "MaxDocumentSize",
+		},
+		{
+			doc:    strings.NewReader(limitsManifest),
+			limits: schema.Limits{MaxArrayLength: 1},
+			limit:  "MaxArrayLength",
+			field:  "/layers",
+		},
+		{
+			doc:    strings.NewReader(limitsManifest),
+			limits: schema.Limits{MaxAnnotations: 1},
+			limit:  "MaxAnnotations",
+			field:  "/layers/1/annotations",
+		},
+		{
+			doc:    strings.NewReader(limitsManifest),
+			limits: schema.Limits{MaxAnnotationSize: 16},
+			limit:  "MaxAnnotationSize",
+			field:  "/layers/1/annotations/com.example.a",
+		},
+		{
+			doc:    strings.NewReader(limitsManifest),
+			limits: schema.Limits{MaxDepth: 3},
+			limit:  "MaxDepth",
+			field:  "/layers/1/annotations",
+		},
+
+		// endless documents are rejected without reading them completely
+		{
+			doc:    io.MultiReader(strings.NewReader(`{"schemaVersion": 2, "layers": [`), repeatReader(`{},`)),
+			limits: schema.DefaultLimits,
+			limit:  "MaxArrayLength",
+			field:  "/layers",
+		},
+		{
+			doc:    repeatReader(`[`),
+			limits: schema.DefaultLimits,
+			limit:  "MaxDepth",
+			field:  strings.Repeat("/0", schema.DefaultLimits.MaxDepth),
+		},
+		{
+			doc:    io.MultiReader(strings.NewReader(`{"schemaVersion": 2`), repeatReader(` `)),
+			limits: schema.DefaultLimits,
+			limit:  "MaxDocumentSize",
+		},
+	} {
+		_, err := schema.ValidatorMediaTypeManifest.ValidateWithOptions(tt.doc, schema.Options{Limits: tt.limits})
+		lerr, ok := errors.Cause(err).(*schema.LimitError)
+		if !ok {
+			t.Errorf("test %d: expected a *schema.LimitError, got %v", i, err)
+			continue
+		}
+		if lerr.Limit != tt.limit || lerr.Field != tt.field {
+			t.Errorf("test %d: expected %s at %q, got %s at %q", i, tt.limit, tt.field, lerr.Limit, lerr.Field)
+		}
+	}
+
+	// documents within the limits are validated as usual
+	_, err := schema.ValidatorMediaTypeManifest.ValidateWithOptions(strings.NewReader(limitsManifest), schema.Options{Limits: schema.DefaultLimits})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = schema.ValidatorMediaTypeManifest.ValidateWithOptions(strings.NewReader(`{"schemaVersion": 2,}`), schema.Options{Limits: schema.DefaultLimits})
+	if _, ok := errors.Cause(err).(*schema.SyntaxError); !ok {
+		t.Errorf("expected a syntax error, got %v", err)
+	}
+}
@@ -31,6 +31,9 @@ import (
 type fsLoaderFactory struct {
 	namespaces []string
 	fs         http.FileSystem
+
+	// parent, if not nil, loads the references outside of namespaces.
+	parent *fsLoaderFactory
 }
 
 // newFSLoaderFactory returns a fsLoaderFactory reading files under the specified namespaces from the root of fs.
@@ -58,6 +61,9 @@ func (factory *fsLoaderFactory) refContents(ref gojsonreference.JsonReference) (
 			break
 		}
 	}
+	if path == "" && factory.parent != nil {
+		return factory.parent.refContents(ref)
+	}
 	if path == "" {
 		return nil, fmt.Errorf("schema reference %#v unexpectedly not available in fsLoaderFactory with namespaces %#v", path, factory.namespaces)
 	}
@@ -0,0 +1,120 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import "github.com/opencontainers/image-spec/platform"
+
+// builtinPlatforms holds the platforms known when Options.Platforms is nil.
+var builtinPlatforms = platform.NewRegistry()
+
+// Options controls how a document is validated.
+// The zero value collects warnings without reporting them anywhere else.
+type Options struct {
+	// WarningHandler, if not nil, is called with every warning as it is found.
+	WarningHandler WarningHandler
+
+	// WarningsAsErrors makes validation fail with a ValidationError
+	// holding the warnings if any warning was found.
+	WarningsAsErrors bool
+
+	// Limits bounds the size and structure of the validated JSON documents.
+	// Documents exceeding a limit fail with a *LimitError.
+	Limits Limits
+
+	// Strict rejects duplicate object keys and strings which are not valid UTF-8,
+	// and, for the OCI media types, members which do not exactly match a field
+	// of the corresponding specs-go/v1 type, e.g. v1.Manifest.
+	// It also turns the invalid values of pre-defined annotations into errors.
+	// Each violation is reported as a *FieldError.
+	Strict bool
+
+	// Canonical reports the JSON documents which are not encoded as canonical JSON,
+	// see v1.MarshalCanonical, as warnings.
+	Canonical bool
+
+	// SpecVersion, if not empty, is the version of the specification, e.g. SpecVersion100,
+	// the documents must conform to. The OCI media types are validated against the schemas
+	// of that version, and properties, media types and annotations defined by later versions
+	// fail with a *VersionError.
+	// The empty string validates against the schemas of the latest version and accepts
+	// everything defined by the versions known to this package.
+	SpecVersion string
+
+	// Registry, if not nil, provides the validators of the media types
+	// instead of the OCI media types only.
+	Registry *Registry
+
+	// Platforms, if not nil, provides the known operating systems, architectures and variants
+	// instead of the built-in ones of platform.NewRegistry.
+	// Platforms which are not known are reported as warnings.
+	Platforms *platform.Registry
+}
+
+// Result holds the outcome of a validation beyond its error.
+type Result struct {
+	// Warnings lists the warnings found, in the order they were found.
+	Warnings []Warning
+}
+
+// validation carries the state of a single validation through the semantic checks.
+type validation struct {
+	opts     Options
+	warnings []Warning
+}
+
+// warn records a warning and passes it to the warning handler.
+func (s *validation) warn(w Warning) {
+	s.warnings = append(s.warnings, w)
+	if s.opts.WarningHandler != nil {
+		s.opts.WarningHandler.Warn(w)
+	}
+}
+
+// registry returns the Registry providing the validators.
+func (s *validation) registry() *Registry {
+	if s.opts.Registry != nil {
+		return s.opts.Registry
+	}
+	return builtinRegistry
+}
+
+// platforms returns the Registry providing the known platforms.
+func (s *validation) platforms() *platform.Registry {
+	if s.opts.Platforms != nil {
+		return s.opts.Platforms
+	}
+	return builtinPlatforms
+}
+
+// finish returns the Result of the validation and its error,
+// turning the warnings into errors if requested by the options.
+func (s *validation) finish(err error) (Result, error) {
+	result := Result{Warnings: s.warnings}
+	if err != nil {
+		return result, err
+	}
+
+	if s.opts.WarningsAsErrors && len(s.warnings) > 0 {
+		errs := make([]error, 0, len(s.warnings))
+		for _, w := range s.warnings {
+			errs = append(errs, w)
+		}
+		return result, ValidationError{
+			Errs: errs,
+		}
+	}
+
+	return result, nil
+}
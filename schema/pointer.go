@@ -0,0 +1,206 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// keywords maps gojsonschema result types to the JSON schema keyword which produced them.
+var keywords = map[string]string{
+	"false":                           "false",
+	"required":                        "required",
+	"invalid_type":                    "type",
+	"number_any_of":                   "anyOf",
+	"number_one_of":                   "oneOf",
+	"number_all_of":                   "allOf",
+	"number_not":                      "not",
+	"missing_dependency":              "dependencies",
+	"const":                           "const",
+	"enum":                            "enum",
+	"array_no_additional_items":       "additionalItems",
+	"array_min_items":                 "minItems",
+	"array_max_items":                 "maxItems",
+	"unique":                          "uniqueItems",
+	"contains":                        "contains",
+	"array_min_properties":            "minProperties",
+	"array_max_properties":            "maxProperties",
+	"additional_property_not_allowed": "additionalProperties",
+	"invalid_property_pattern":        "patternProperties",
+	"invalid_property_name":           "propertyNames",
+	"string_gte":                      "minLength",
+	"string_lte":                      "maxLength",
+	"pattern":                         "pattern",
+	"format":                          "format",
+	"multiple_of":                     "multipleOf",
+	"number_gte":                      "minimum",
+	"number_gt":                       "exclusiveMinimum",
+	"number_lte":                      "maximum",
+	"number_lt":                       "exclusiveMaximum",
+	"condition_then":                  "then",
+	"condition_else":                  "else",
+}
+
+// expectedDetails lists, in order of preference, the gojsonschema detail keys carrying the value a rule expects.
+var expectedDetails = []string{"expected", "allowed", "pattern", "format", "min", "max", "property", "dependency"}
+
+// newFieldError converts a gojsonschema result error into a *FieldError,
+// locating the offending value in the document using offsets.
+func newFieldError(re gojsonschema.ResultError, offsets map[string]int64, buf []byte) *FieldError {
+	keyword, ok := keywords[re.Type()]
+	if !ok {
+		keyword = re.Type()
+	}
+
+	var expected interface{}
+	details := re.Details()
+	for _, key := range expectedDetails {
+		if v, ok := details[key]; ok {
+			expected = v
+			break
+		}
+	}
+
+	fe := &FieldError{
+		Field:       contextPointer(re.Context()),
+		Keyword:     keyword,
+		Expected:    expected,
+		Value:       re.Value(),
+		Description: re.Description(),
+	}
+	if offset, ok := offsets[fe.Field]; ok {
+		fe.Offset = offset
+		fe.Line, fe.Col = position(bytes.NewReader(buf), offset)
+	}
+	return fe
+}
+
+// contextPointer converts a gojsonschema context such as "(root).layers.0.size"
+// into the equivalent JSON Pointer "/layers/0/size".
+func contextPointer(ctx *gojsonschema.JsonContext) string {
+	if ctx == nil {
+		return ""
+	}
+	// Use a delimiter which cannot appear in a decoded JSON key
+	// so that keys containing "." are not split.
+	const del = "\x00"
+	parts := strings.Split(ctx.String(del), del)
+	var ptr strings.Builder
+	for _, p := range parts[1:] {
+		ptr.WriteByte('/')
+		ptr.WriteString(escapePointer(p))
+	}
+	return ptr.String()
+}
+
+// escapePointer escapes a reference token as described in RFC 6901, section 3.
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// valueOffsets maps the JSON Pointer of every value in the JSON document buf
+// to the byte offset where that value starts.
+// Documents which fail to parse yield the offsets found up to the error.
+func valueOffsets(buf []byte) map[string]int64 {
+	l := &locator{
+		buf:     buf,
+		dec:     json.NewDecoder(bytes.NewReader(buf)),
+		offsets: map[string]int64{},
+	}
+	_ = l.value("")
+	return l.offsets
+}
+
+// A document is a JSON document being checked.
+// The offsets of its values are computed on first use, once for all the errors found in the document.
+type document struct {
+	buf     []byte
+	offsets map[string]int64
+}
+
+// locate sets the position of the value at fe.Field in d, if that value is found.
+func (d *document) locate(fe *FieldError) {
+	if d.offsets == nil {
+		d.offsets = valueOffsets(d.buf)
+	}
+	if offset, ok := d.offsets[fe.Field]; ok {
+		fe.Offset = offset
+		fe.Line, fe.Col = position(bytes.NewReader(d.buf), offset)
+	}
+}
+
+type locator struct {
+	buf     []byte
+	dec     *json.Decoder
+	offsets map[string]int64
+}
+
+// start skips the separators between the decoder's position and the next value.
+func (l *locator) start() int64 {
+	return skipSeparators(l.buf, l.dec.InputOffset())
+}
+
+// skipSeparators returns the offset of the first token of buf at or after off.
+func skipSeparators(buf []byte, off int64) int64 {
+	for off < int64(len(buf)) {
+		switch buf[off] {
+		case ' ', '\t', '\r', '\n', ':', ',':
+			off++
+		default:
+			return off
+		}
+	}
+	return off
+}
+
+func (l *locator) value(ptr string) error {
+	l.offsets[ptr] = l.start()
+	tok, err := l.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for l.dec.More() {
+			key, err := l.dec.Token()
+			if err != nil {
+				return err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return fmt.Errorf("unexpected object key %v", key)
+			}
+			if err := l.value(ptr + "/" + escapePointer(name)); err != nil {
+				return err
+			}
+		}
+		_, err = l.dec.Token()
+	case json.Delim('['):
+		for i := 0; l.dec.More(); i++ {
+			if err := l.value(ptr + "/" + strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		_, err = l.dec.Token()
+	}
+	return err
+}
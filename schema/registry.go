@@ -0,0 +1,327 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ErrMediaTypeRegistered is returned by Registry.Register for a media type which already has a validator.
+var ErrMediaTypeRegistered = errors.New("media type already registered")
+
+// mediaTypeRegexp matches the media types accepted by the descriptor schema.
+var mediaTypeRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9!#$&-^_.+]{0,126}/[A-Za-z0-9][A-Za-z0-9!#$&-^_.+]{0,126}$`)
+
+// JSONSchema locates the JSON schema of a media type.
+type JSONSchema struct {
+	// URI is the URI of the schema, it must start with one of Namespaces.
+	URI string
+
+	// Namespaces is a set of URI prefixes which are treated as containing the files of FileSystem,
+	// so that the schema and its references are loaded without accessing the network.
+	// Subdirectories must be listed before their parent directories.
+	// References outside of Namespaces are loaded from the OCI schemas, see FileSystem().
+	Namespaces []string
+
+	// FileSystem holds the schema files.
+	FileSystem http.FileSystem
+}
+
+// A CheckFunc performs the semantic checks of a document which is valid against its JSON schema.
+// Warnings are passed to warnings rather than returned.
+type CheckFunc func(doc []byte, warnings WarningHandler) error
+
+// A Registry maps media types to the validators of their documents.
+// Registries are independent of each other: registering a media type
+// in a Registry does not affect other registries nor the Validator type.
+// The zero value of Registry holds the validators of the OCI media types, as NewRegistry returns.
+// A Registry is safe for concurrent use.
+type Registry struct {
+	mu sync.RWMutex
+
+	// entries is nil until a media type is registered, standing for the entries of builtinRegistry.
+	entries map[string]registryEntry
+}
+
+// registryEntry describes how documents of a media type are validated.
+type registryEntry struct {
+	// schema loads the JSON schema of the documents, if any.
+	schema gojsonschema.JSONLoader
+
+	// versions loads the JSON schema of the documents for each version of the specification
+	// which defines them, for the OCI media types.
+	versions map[string]gojsonschema.JSONLoader
+
+	// check performs the semantic checks of schema-valid documents, if any.
+	check validateFunc
+
+	// goType is the Go type of the documents, against which Options.Strict reports unknown fields, if any.
+	goType reflect.Type
+
+	// layer is set for layer media types, whose blobs are tar archives compressed by compression.
+	layer       bool
+	compression compression
+
+	// custom is set for the media types added by Register.
+	custom bool
+}
+
+// builtinRegistry holds the validators of the OCI media types, used when Options.Registry is nil.
+// It must not be modified.
+var builtinRegistry *Registry
+
+func init() {
+	// assigned in init, since looking up entries refers to builtinRegistry for the zero Registry
+	builtinRegistry = newBuiltinRegistry()
+}
+
+func newBuiltinRegistry() *Registry {
+	r := &Registry{entries: map[string]registryEntry{}}
+	factory := newFSLoaderFactory(schemaNamespaces, fs)
+	versionFactories := make(map[string]*fsLoaderFactory, len(schemaDirs))
+	for version, dir := range schemaDirs {
+		versionFactories[version] = newFSLoaderFactory(schemaNamespaces, _escDir(false, dir))
+	}
+	for v, uri := range specs {
+		versions := make(map[string]gojsonschema.JSONLoader, len(versionFactories))
+		for version, f := range versionFactories {
+			versions[version] = f.New(uri)
+		}
+		r.entries[string(v)] = registryEntry{
+			schema:   factory.New(uri),
+			versions: versions,
+			check:    mapValidate[v],
+			goType:   strictTypes[v],
+		}
+	}
+	for v, c := range layerCompression {
+		r.entries[string(v)] = registryEntry{
+			layer:       true,
+			compression: c,
+		}
+	}
+	return r
+}
+
+// NewRegistry returns a Registry holding the validators of the OCI media types.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// registered returns the entries of r. r.mu must be held.
+func (r *Registry) registered() map[string]registryEntry {
+	if r.entries == nil {
+		return builtinRegistry.entries
+	}
+	return r.entries
+}
+
+// Register adds a validator for mediaType.
+// Documents of mediaType are validated against schema, if its URI is not empty,
+// and then passed to check, if not nil.
+// Register fails if the schema or one of its references cannot be loaded.
+// Registering a media type which already has a validator, including the OCI media types,
+// fails with ErrMediaTypeRegistered.
+func (r *Registry) Register(mediaType string, schema JSONSchema, check CheckFunc) error {
+	if !mediaTypeRegexp.MatchString(mediaType) {
+		return errors.Errorf("invalid media type %q", mediaType)
+	}
+
+	e := registryEntry{custom: true}
+	if schema.URI != "" {
+		if schema.FileSystem == nil {
+			return errors.Errorf("media type %s: schema %s has no file system", mediaType, schema.URI)
+		}
+		factory := newFSLoaderFactory(schema.Namespaces, schema.FileSystem)
+		factory.parent = newFSLoaderFactory(schemaNamespaces, fs)
+		e.schema = factory.New(schema.URI)
+		if _, err := gojsonschema.NewSchema(e.schema); err != nil {
+			return errors.Wrapf(err, "media type %s: unable to load schema %s", mediaType, schema.URI)
+		}
+	}
+	if check != nil {
+		e.check = func(buf []byte, s *validation) error {
+			return check(buf, WarningHandlerFunc(s.warn))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.registered()[mediaType]; ok {
+		return errors.Wrapf(ErrMediaTypeRegistered, "media type %s", mediaType)
+	}
+	if r.entries == nil {
+		r.entries = make(map[string]registryEntry, len(builtinRegistry.entries)+1)
+		for mediaType, e := range builtinRegistry.entries {
+			r.entries[mediaType] = e
+		}
+	}
+	r.entries[mediaType] = e
+	return nil
+}
+
+// MediaTypes returns the sorted list of the media types having a validator.
+func (r *Registry) MediaTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entries := r.registered()
+	mediaTypes := make([]string, 0, len(entries))
+	for mediaType := range entries {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	return mediaTypes
+}
+
+// Validate validates the given reader as a document of mediaType as configured by opts,
+// using the validators of r.
+// See Validator.ValidateWithOptions.
+func (r *Registry) Validate(mediaType string, src io.Reader, opts Options) (Result, error) {
+	opts.Registry = r
+	return Validator(mediaType).ValidateWithOptions(src, opts)
+}
+
+func (r *Registry) lookup(mediaType string) (registryEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.registered()[mediaType]
+	return e, ok
+}
+
+// isCustom reports whether mediaType was added by Register.
+// A nil Registry has no custom media types.
+func (r *Registry) isCustom(mediaType string) bool {
+	if r == nil {
+		return false
+	}
+	e, ok := r.lookup(mediaType)
+	return ok && e.custom
+}
+
+// validate validates the document src of mediaType.
+func (r *Registry) validate(mediaType string, src io.Reader, s *validation) error {
+	e, ok := r.lookup(mediaType)
+	if !ok {
+		return errors.Errorf("schema %s: unsupported media type", mediaType)
+	}
+	if e.layer {
+		if err := checkMediaTypeVersion(mediaType, s.opts.SpecVersion); err != nil {
+			return err
+		}
+		return validateLayer(src, e.compression, s)
+	}
+
+	buf, err := readDocument(src, s.opts.Limits)
+	if err != nil {
+		return err
+	}
+	return e.validateDocument(mediaType, buf, s)
+}
+
+// validateDocument validates the JSON document buf of mediaType.
+func (r *Registry) validateDocument(mediaType string, buf []byte, s *validation) error {
+	e, ok := r.lookup(mediaType)
+	if !ok || e.layer {
+		return errors.Errorf("schema %s: unsupported media type", mediaType)
+	}
+	return e.validateDocument(mediaType, buf, s)
+}
+
+func (e registryEntry) validateDocument(mediaType string, buf []byte, s *validation) error {
+	var errs []error
+	if s.opts.Strict {
+		errs = checkStrict(buf, e.goType)
+	}
+
+	schema := e.schema
+	if versioned, ok := e.versions[s.opts.SpecVersion]; ok {
+		schema = versioned
+	}
+	if schema != nil {
+		result, err := gojsonschema.Validate(schema, gojsonschema.NewBytesLoader(buf))
+		if err != nil {
+			return errors.Wrapf(
+				WrapSyntaxError(bytes.NewReader(buf), err),
+				"schema %s: unable to validate", mediaType)
+		}
+
+		if !result.Valid() {
+			offsets := valueOffsets(buf)
+			for _, desc := range result.Errors() {
+				errs = append(errs, newFieldError(desc, offsets, buf))
+			}
+		}
+	}
+	if s.opts.SpecVersion != "" {
+		verrs, err := checkVersion(mediaType, buf, s.opts.SpecVersion)
+		if err != nil {
+			return errors.Wrapf(err, "schema %s: unable to validate", mediaType)
+		}
+		errs = append(errs, verrs...)
+	}
+	if len(errs) > 0 {
+		return ValidationError{
+			Errs: errs,
+		}
+	}
+
+	if s.opts.Canonical {
+		checkCanonical(buf, s)
+	}
+
+	// The semantic checks run on schema-valid documents only,
+	// so that type mismatches are reported as a *FieldError
+	// rather than as a decoding error.
+	if e.check != nil {
+		return e.check(buf, s)
+	}
+	return nil
+}
+
+// checkCanonical warns if buf is not canonical JSON.
+func checkCanonical(buf []byte, s *validation) {
+	canonical, err := v1.CanonicalizeJSON(buf)
+	if err != nil {
+		s.warn(Warning{
+			Code:    WarningNonCanonical,
+			Message: fmt.Sprintf("document is not canonical JSON: %v", err),
+		})
+		return
+	}
+	if bytes.Equal(buf, canonical) {
+		return
+	}
+
+	n := 0
+	for n < len(buf) && n < len(canonical) && buf[n] == canonical[n] {
+		n++
+	}
+	line, col := position(bytes.NewReader(buf), int64(n))
+	s.warn(Warning{
+		Code:    WarningNonCanonical,
+		Message: fmt.Sprintf("document is not canonical JSON: first difference at line %d, col %d", line, col),
+	})
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/opencontainers/image-spec/schema"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const mediaTypeChartConfig = "application/vnd.example.chart.config.v1+json"
+
+// chartSchema references the OCI definitions, which are loaded from the embedded schemas.
+var chartSchema = schema.JSONSchema{
+	URI:        "https://example.com/schema/chart-config.json",
+	Namespaces: []string{"https://example.com/schema/"},
+	FileSystem: http.FS(fstest.MapFS{
+		"chart-config.json": &fstest.MapFile{Data: []byte(`{
+  "id": "https://example.com/schema/chart-config.json",
+  "type": "object",
+  "properties": {
+    "name": {"type": "string"},
+    "size": {"$ref": "https://opencontainers.org/schema/defs.json#/definitions/int64"}
+  },
+  "required": ["name"]
+}`)},
+	}),
+}
+
+// checkChart warns about charts without a version and rejects charts named "invalid".
+func checkChart(doc []byte, warnings schema.WarningHandler) error {
+	var chart map[string]interface{}
+	if err := json.Unmarshal(doc, &chart); err != nil {
+		return err
+	}
+	if chart["name"] == "invalid" {
+		return errors.New("invalid chart name")
+	}
+	if _, ok := chart["version"]; !ok {
+		warnings.Warn(schema.Warning{Code: "missing-version", Message: "chart has no version", Field: "/version"})
+	}
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := schema.NewRegistry()
+	if err := r.Register(mediaTypeChartConfig, chartSchema, checkChart); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		doc      string
+		fail     bool
+		field    string // field of the expected *schema.FieldError
+		warnings int
+	}{
+		{doc: `{"name": "chart", "version": "1.0.0"}`},
+		{doc: `{"name": "chart"}`, warnings: 1},
+		{doc: `{"name": 1}`, fail: true, field: "/name"},
+		{doc: `{"name": "chart", "size": 1.5}`, fail: true, field: "/size"},
+		{doc: `{"name": "invalid", "version": "1.0.0"}`, fail: true},
+	} {
+		result, err := r.Validate(mediaTypeChartConfig, strings.NewReader(tt.doc), schema.Options{})
+		if (err != nil) != tt.fail {
+			t.Errorf("test %d: expected failure %t, got %v", i, tt.fail, err)
+			continue
+		}
+		if tt.field != "" {
+			verr, ok := errors.Cause(err).(schema.ValidationError)
+			if !ok || len(verr.Errs) != 1 {
+				t.Errorf("test %d: expected a single validation error, got %v", i, err)
+				continue
+			}
+			if ferr, ok := verr.Errs[0].(*schema.FieldError); !ok || ferr.Field != tt.field {
+				t.Errorf("test %d: expected an error at %q, got %v", i, tt.field, verr.Errs[0])
+			}
+		}
+		if len(result.Warnings) != tt.warnings {
+			t.Errorf("test %d: expected %d warnings, got %v", i, tt.warnings, result.Warnings)
+		}
+	}
+
+	// the OCI media types are still validated
+	_, err := r.Validate(v1.MediaTypeImageManifest, strings.NewReader(`{"schemaVersion": 1}`), schema.Options{})
+	if _, ok := errors.Cause(err).(schema.ValidationError); !ok {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := schema.NewRegistry()
+	if err := r.Register(mediaTypeChartConfig, chartSchema, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		mediaType string
+		schema    schema.JSONSchema
+		conflict  bool
+	}{
+		{mediaType: mediaTypeChartConfig, conflict: true},
+		{mediaType: v1.MediaTypeImageConfig, conflict: true},
+		{mediaType: v1.MediaTypeImageLayerGzip, conflict: true},
+		{mediaType: "not a media type"},
+		{
+			mediaType: "application/vnd.example.missing+json",
+			schema: schema.JSONSchema{
+				URI:        "https://example.com/schema/missing.json",
+				Namespaces: chartSchema.Namespaces,
+				FileSystem: chartSchema.FileSystem,
+			},
+		},
+		{
+			mediaType: "application/vnd.example.nofs+json",
+			schema:    schema.JSONSchema{URI: chartSchema.URI},
+		},
+	} {
+		err := r.Register(tt.mediaType, tt.schema, nil)
+		if err == nil {
+			t.Errorf("test %d: expected an error", i)
+			continue
+		}
+		if conflict := errors.Is(err, schema.ErrMediaTypeRegistered); conflict != tt.conflict {
+			t.Errorf("test %d: expected conflict %t, got %v", i, tt.conflict, err)
+		}
+	}
+
+	// registries are isolated from each other and from Validator
+	if !containsString(r.MediaTypes(), mediaTypeChartConfig) {
+		t.Errorf("expected %s in %v", mediaTypeChartConfig, r.MediaTypes())
+	}
+	if containsString(schema.NewRegistry().MediaTypes(), mediaTypeChartConfig) {
+		t.Errorf("unexpected %s in a new registry", mediaTypeChartConfig)
+	}
+	if err := schema.NewRegistry().Register(mediaTypeChartConfig, chartSchema, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := schema.Validator(mediaTypeChartConfig).Validate(strings.NewReader(`{"name": "chart"}`)); err == nil {
+		t.Errorf("expected an unsupported media type error")
+	}
+}
+
+func TestRegistryZeroValue(t *testing.T) {
+	var r schema.Registry
+	if !containsString(r.MediaTypes(), v1.MediaTypeImageManifest) {
+		t.Errorf("expected %s in %v", v1.MediaTypeImageManifest, r.MediaTypes())
+	}
+	if err := r.Register(mediaTypeChartConfig, chartSchema, checkChart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Validate(mediaTypeChartConfig, strings.NewReader(`{"name": "chart", "version": "1.0.0"}`), schema.Options{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := r.Validate(v1.MediaTypeImageManifest, strings.NewReader(`{"schemaVersion": 1}`), schema.Options{}); err == nil {
+		t.Error("expected a validation error")
+	}
+}
+
+func TestRegistryManifestConfig(t *testing.T) {
+	r := schema.NewRegistry()
+	if err := r.Register(mediaTypeChartConfig, chartSchema, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := `{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "` + mediaTypeChartConfig + `",
+    "size": 17,
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ]
+}`
+
+	// custom config media types are only known to the registry they are registered in
+	result, err := schema.ValidatorMediaTypeManifest.ValidateWithOptions(strings.NewReader(manifest), schema.Options{})
+	if err != nil || len(result.Warnings) != 1 || result.Warnings[0].Code != schema.WarningUnknownMediaType {
+		t.Errorf("expected an unknown media type warning, got %v, %v", result.Warnings, err)
+	}
+	result, err = r.Validate(v1.MediaTypeImageManifest, strings.NewReader(manifest), schema.Options{})
+	if err != nil || len(result.Warnings) != 0 {
+		t.Errorf("expected no warning, got %v, %v", result.Warnings, err)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -22,12 +22,14 @@ import (
 
 // Media types for the OCI image formats
 const (
-	ValidatorMediaTypeDescriptor   Validator     = v1.MediaTypeDescriptor
-	ValidatorMediaTypeLayoutHeader Validator     = v1.MediaTypeLayoutHeader
-	ValidatorMediaTypeManifest     Validator     = v1.MediaTypeImageManifest
-	ValidatorMediaTypeImageIndex   Validator     = v1.MediaTypeImageIndex
-	ValidatorMediaTypeImageConfig  Validator     = v1.MediaTypeImageConfig
-	ValidatorMediaTypeImageLayer   unimplemented = v1.MediaTypeImageLayer
+	ValidatorMediaTypeDescriptor     Validator = v1.MediaTypeDescriptor
+	ValidatorMediaTypeLayoutHeader   Validator = v1.MediaTypeLayoutHeader
+	ValidatorMediaTypeManifest       Validator = v1.MediaTypeImageManifest
+	ValidatorMediaTypeImageIndex     Validator = v1.MediaTypeImageIndex
+	ValidatorMediaTypeImageConfig    Validator = v1.MediaTypeImageConfig
+	ValidatorMediaTypeImageLayer     Validator = v1.MediaTypeImageLayer
+	ValidatorMediaTypeImageLayerGzip Validator = v1.MediaTypeImageLayerGzip
+	ValidatorMediaTypeImageLayerZstd Validator = v1.MediaTypeImageLayerZstd
 )
 
 var (
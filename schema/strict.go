@@ -0,0 +1,245 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Keywords of the *FieldError reported by the strict profile, see Options.Strict.
+const (
+	// KeywordUnknownField reports a member which has no matching field in the Go type of the document.
+	KeywordUnknownField = "additionalProperties"
+
+	// KeywordDuplicateKey reports a member whose key was already used in the same object.
+	KeywordDuplicateKey = "duplicateKey"
+
+	// KeywordInvalidUTF8 reports a string which is not valid UTF-8.
+	KeywordInvalidUTF8 = "utf8"
+)
+
+// strictTypes maps the media types to the Go types against which the strict profile reports unknown fields.
+var strictTypes = map[Validator]reflect.Type{
+	ValidatorMediaTypeDescriptor:   reflect.TypeOf(v1.Descriptor{}),
+	ValidatorMediaTypeLayoutHeader: reflect.TypeOf(v1.ImageLayout{}),
+	ValidatorMediaTypeManifest:     reflect.TypeOf(v1.Manifest{}),
+	ValidatorMediaTypeImageIndex:   reflect.TypeOf(v1.Index{}),
+	ValidatorMediaTypeImageConfig:  reflect.TypeOf(v1.Image{}),
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// checkStrict returns a *FieldError for every duplicate key, string which is not valid UTF-8
+// and, if t is not nil, member unknown to t in the JSON document buf.
+// Unlike encoding/json, member names must match the field names exactly.
+// Documents which fail to parse yield no error, the syntax error is left to the schema validation.
+func checkStrict(buf []byte, t reflect.Type) []error {
+	c := &strictChecker{
+		buf: buf,
+		dec: json.NewDecoder(bytes.NewReader(buf)),
+	}
+	if err := c.value("", t); err != nil {
+		return nil
+	}
+	return c.errs
+}
+
+type strictChecker struct {
+	buf  []byte
+	dec  *json.Decoder
+	errs []error
+}
+
+func (c *strictChecker) fail(ptr string, offset int64, keyword string, value interface{}, format string, args ...interface{}) {
+	fe := &FieldError{
+		Field:       ptr,
+		Keyword:     keyword,
+		Value:       value,
+		Description: fmt.Sprintf(format, args...),
+		Offset:      offset,
+	}
+	fe.Line, fe.Col = position(bytes.NewReader(c.buf), offset)
+	c.errs = append(c.errs, fe)
+}
+
+// token returns the next token and the offset where it starts.
+func (c *strictChecker) token() (json.Token, int64, error) {
+	start := skipSeparators(c.buf, c.dec.InputOffset())
+	tok, err := c.dec.Token()
+	if s, ok := tok.(string); ok && err == nil && !validStringLiteral(c.buf[start:c.dec.InputOffset()]) {
+		return s, start, errInvalidUTF8
+	}
+	return tok, start, err
+}
+
+// errInvalidUTF8 is returned by token for strings which are not valid UTF-8, and is not a syntax error.
+var errInvalidUTF8 = fmt.Errorf("invalid UTF-8")
+
+// value checks the value starting at the decoder's position, which is decoded into t.
+// A nil t accepts any member.
+func (c *strictChecker) value(ptr string, t reflect.Type) error {
+	tok, start, err := c.token()
+	if err == errInvalidUTF8 {
+		c.fail(ptr, start, KeywordInvalidUTF8, tok, "string is not valid UTF-8")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && reflect.PtrTo(t).Implements(unmarshalerType) {
+		t = nil
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		return c.object(ptr, t)
+	case json.Delim('['):
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i := 0; c.dec.More(); i++ {
+			if err := c.value(ptr+"/"+strconv.Itoa(i), elem); err != nil {
+				return err
+			}
+		}
+		_, err = c.dec.Token()
+	}
+	return err
+}
+
+func (c *strictChecker) object(ptr string, t reflect.Type) error {
+	var fields map[string]reflect.Type
+	var elem reflect.Type
+	if t != nil {
+		switch t.Kind() {
+		case reflect.Struct:
+			fields = map[string]reflect.Type{}
+			structFields(t, fields)
+		case reflect.Map:
+			elem = t.Elem()
+		}
+	}
+
+	seen := map[string]bool{}
+	for c.dec.More() {
+		tok, start, err := c.token()
+		name, _ := tok.(string)
+		member := ptr + "/" + escapePointer(name)
+		if err == errInvalidUTF8 {
+			c.fail(member, start, KeywordInvalidUTF8, name, "key is not valid UTF-8")
+		} else if err != nil {
+			return err
+		}
+
+		if seen[name] {
+			c.fail(member, start, KeywordDuplicateKey, name, "duplicate key %q", name)
+		}
+		seen[name] = true
+
+		typ := elem
+		if fields != nil {
+			var known bool
+			typ, known = fields[name]
+			if !known {
+				c.fail(member, start, KeywordUnknownField, name, "unknown field %q", name)
+			}
+		}
+		if err := c.value(member, typ); err != nil {
+			return err
+		}
+	}
+	_, err := c.dec.Token()
+	return err
+}
+
+// structFields adds the JSON member names of the struct type t, including those of its embedded structs, to fields.
+func structFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			structFields(f.Type, fields)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+}
+
+// validStringLiteral reports whether the JSON string literal lit, including its quotes,
+// is valid UTF-8 and does not escape unpaired UTF-16 surrogates.
+func validStringLiteral(lit []byte) bool {
+	if !utf8.Valid(lit) {
+		return false
+	}
+	for i := 0; i < len(lit); i++ {
+		if lit[i] != '\\' {
+			continue
+		}
+		i++
+		if i >= len(lit) || lit[i] != 'u' {
+			continue
+		}
+		r, ok := hexRune(lit, i+1)
+		if !ok {
+			return false
+		}
+		i += 4
+		switch {
+		case r >= 0xdc00 && r < 0xe000:
+			return false // low surrogate without a high surrogate
+		case r >= 0xd800 && r < 0xdc00:
+			if i+2 >= len(lit) || lit[i+1] != '\\' || lit[i+2] != 'u' {
+				return false
+			}
+			low, ok := hexRune(lit, i+3)
+			if !ok || low < 0xdc00 || low >= 0xe000 {
+				return false
+			}
+			i += 6
+		}
+	}
+	return true
+}
+
+// hexRune decodes the four hexadecimal digits of lit at i.
+func hexRune(lit []byte, i int) (rune, bool) {
+	if i+4 > len(lit) {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(string(lit[i:i+4]), 16, 32)
+	return rune(r), err == nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+func TestStrict(t *testing.T) {
+	const layer = `{
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"%s
+    }`
+	manifest := func(extra, layerExtra string) string {
+		return `{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.oci.image.manifest.v1+json",
+  "config": {
+    "mediaType": "application/vnd.oci.image.config.v1+json",
+    "size": 1470,
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    ` + strings.Replace(layer, "%s", layerExtra, 1) + `
+  ]` + extra + `
+}`
+	}
+
+	type failure struct {
+		field     string
+		keyword   string
+		line, col int
+	}
+	for i, tt := range []struct {
+		validator schema.Validator
+		doc       string
+		fail      []failure
+	}{
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest(`, "annotations": {"a": "😀"}`, ""),
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest(`, "schemaVersion": 2`, ""),
+			fail:      []failure{{"/schemaVersion", schema.KeywordDuplicateKey, 15, 6}},
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest(`, "annotations": {"a": "1", "a": "2"}`, ""),
+			fail:      []failure{{"/annotations/a", schema.KeywordDuplicateKey, 15, 32}},
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest("", `, "Annotations": {}, "platform": {"architecture": "amd64", "os": "linux", "features": []}`),
+			fail: []failure{
+				{"/layers/0/Annotations", schema.KeywordUnknownField, 13, 92},
+				{"/layers/0/platform/features", schema.KeywordUnknownField, 13, 164},
+			},
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest(`, "annotations": {"a": "\udc00", "b": "`+"\xff"+`"}`, ""),
+			fail: []failure{
+				{"/annotations/a", schema.KeywordInvalidUTF8, 15, 27},
+				{"/annotations/b", schema.KeywordInvalidUTF8, 15, 42},
+			},
+		},
+		{
+			validator: schema.ValidatorMediaTypeImageIndex,
+			doc:       `{"schemaVersion": 2, "manifests": [], "Manifests": []}`,
+			fail:      []failure{{"/Manifests", schema.KeywordUnknownField, 1, 39}},
+		},
+		{
+			validator: schema.ValidatorMediaTypeImageConfig,
+			doc:       `{"architecture": "amd64", "os": "linux", "created": "2015-10-31T22:22:56.015925234Z", "rootfs": {"type": "layers", "diff_ids": []}, "config": {"User": "root", "Healthcheck": {}}}`,
+			fail:      []failure{{"/config/Healthcheck", schema.KeywordUnknownField, 1, 160}},
+		},
+	} {
+		_, err := tt.validator.ValidateWithOptions(strings.NewReader(tt.doc), schema.Options{Strict: true})
+		if len(tt.fail) == 0 {
+			if err != nil {
+				t.Errorf("test %d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok || len(verr.Errs) != len(tt.fail) {
+			t.Errorf("test %d: expected %d errors, got %v", i, len(tt.fail), err)
+			continue
+		}
+		for j, e := range verr.Errs {
+			ferr, ok := e.(*schema.FieldError)
+			if !ok {
+				t.Errorf("test %d: expected a *schema.FieldError, got %v", i, e)
+				continue
+			}
+			got := failure{ferr.Field, ferr.Keyword, ferr.Line, ferr.Col}
+			if got != tt.fail[j] {
+				t.Errorf("test %d: expected %v, got %v", i, tt.fail[j], got)
+			}
+		}
+
+		// the documents are accepted without the strict profile
+		if err := tt.validator.Validate(strings.NewReader(tt.doc)); err != nil {
+			t.Errorf("test %d: unexpected error without the strict profile: %v", i, err)
+		}
+	}
+}
@@ -15,24 +15,21 @@
 package schema
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"regexp"
 
 	digest "github.com/opencontainers/go-digest"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
-	"github.com/xeipuuv/gojsonschema"
 )
 
 // Validator wraps a media type string identifier
 // and implements validation against a JSON schema.
 type Validator string
 
-type validateFunc func(r io.Reader) error
+type validateFunc func(buf []byte, s *validation) error
 
 var mapValidate = map[Validator]validateFunc{
 	ValidatorMediaTypeImageConfig: validateConfig,
@@ -41,7 +38,20 @@ var mapValidate = map[Validator]validateFunc{
 	ValidatorMediaTypeManifest:    validateManifest,
 }
 
+// Keywords of the *FieldError reported by the semantic checks of the properties introduced by 1.1.0.
+const (
+	// KeywordData reports embedded data which does not match the digest or size of its descriptor.
+	KeywordData = "data"
+
+	// KeywordEmptyDescriptor reports a descriptor of the empty media type which does not describe the value "{}".
+	KeywordEmptyDescriptor = "emptyDescriptor"
+
+	// KeywordArtifactType reports an image manifest whose config is empty but which has no artifactType.
+	KeywordArtifactType = "artifactType"
+)
+
 // ValidationError contains all the errors that happened during validation.
+// Schema violations are reported as *FieldError.
 type ValidationError struct {
 	Errs []error
 }
@@ -50,92 +60,101 @@ func (e ValidationError) Error() string {
 	return fmt.Sprintf("%v", e.Errs)
 }
 
-// Validate validates the given reader against the schema of the wrapped media type.
-func (v Validator) Validate(src io.Reader) error {
-	buf, err := ioutil.ReadAll(src)
-	if err != nil {
-		return errors.Wrap(err, "unable to read the document file")
-	}
-
-	if f, ok := mapValidate[v]; ok {
-		if f == nil {
-			return fmt.Errorf("internal error: mapValidate[%q] is nil", v)
-		}
-		err = f(bytes.NewReader(buf))
-		if err != nil {
-			return err
-		}
-	}
-
-	sl := newFSLoaderFactory(schemaNamespaces, fs).New(specs[v])
-	ml := gojsonschema.NewStringLoader(string(buf))
-
-	result, err := gojsonschema.Validate(sl, ml)
-	if err != nil {
-		return errors.Wrapf(
-			WrapSyntaxError(bytes.NewReader(buf), err),
-			"schema %s: unable to validate", v)
-	}
-
-	if result.Valid() {
+// validationError returns a ValidationError holding errs, or nil if errs is empty.
+func validationError(errs []error) error {
+	if len(errs) == 0 {
 		return nil
 	}
-
-	errs := make([]error, 0, len(result.Errors()))
-	for _, desc := range result.Errors() {
-		errs = append(errs, fmt.Errorf("%s", desc))
-	}
-
 	return ValidationError{
 		Errs: errs,
 	}
 }
 
-type unimplemented string
+// Validate validates the given reader against the schema of the wrapped media type.
+// Warnings are discarded; use ValidateWithOptions to receive them.
+func (v Validator) Validate(src io.Reader) error {
+	_, err := v.ValidateWithOptions(src, Options{})
+	return err
+}
 
-func (v unimplemented) Validate(src io.Reader) error {
-	return fmt.Errorf("%s: unimplemented", v)
+// ValidateWithOptions validates the given reader against the schema of the wrapped media type
+// as configured by opts.
+// The returned Result holds the warnings found, even if validation failed.
+func (v Validator) ValidateWithOptions(src io.Reader, opts Options) (Result, error) {
+	s := &validation{opts: opts}
+	return s.finish(v.validate(src, s))
 }
 
-func validateManifest(r io.Reader) error {
-	header := v1.Manifest{}
+func (v Validator) validate(src io.Reader, s *validation) error {
+	return s.registry().validate(string(v), src, s)
+}
 
-	buf, err := ioutil.ReadAll(r)
-	if err != nil {
-		return errors.Wrapf(err, "error reading the io stream")
-	}
+// validateDocument validates the JSON document buf.
+func (v Validator) validateDocument(buf []byte, s *validation) error {
+	return s.registry().validateDocument(string(v), buf, s)
+}
+
+func validateManifest(buf []byte, s *validation) error {
+	header := v1.Manifest{}
 
-	err = json.Unmarshal(buf, &header)
+	err := json.Unmarshal(buf, &header)
 	if err != nil {
 		return errors.Wrap(err, "manifest format mismatch")
 	}
 
-	if header.Config.MediaType != string(v1.MediaTypeImageConfig) {
-		fmt.Printf("warning: config %s has an unknown media type: %s\n", header.Config.Digest, header.Config.MediaType)
+	if header.Config.MediaType != string(v1.MediaTypeImageConfig) &&
+		header.Config.MediaType != v1.MediaTypeEmptyJSON &&
+		!s.opts.Registry.isCustom(header.Config.MediaType) {
+		s.warn(Warning{
+			Code:    WarningUnknownMediaType,
+			Message: fmt.Sprintf("config %s has an unknown media type: %s", header.Config.Digest, header.Config.MediaType),
+			Field:   "/config/mediaType",
+			Digest:  header.Config.Digest,
+		})
 	}
 
-	for _, layer := range header.Layers {
+	for i, layer := range header.Layers {
 		if layer.MediaType != string(v1.MediaTypeImageLayer) &&
 			layer.MediaType != string(v1.MediaTypeImageLayerGzip) &&
 			layer.MediaType != string(v1.MediaTypeImageLayerZstd) &&
 			layer.MediaType != string(v1.MediaTypeImageLayerNonDistributable) &&
 			layer.MediaType != string(v1.MediaTypeImageLayerNonDistributableGzip) &&
-			layer.MediaType != string(v1.MediaTypeImageLayerNonDistributableZstd) {
-			fmt.Printf("warning: layer %s has an unknown media type: %s\n", layer.Digest, layer.MediaType)
+			layer.MediaType != string(v1.MediaTypeImageLayerNonDistributableZstd) &&
+			layer.MediaType != v1.MediaTypeEmptyJSON {
+			s.warn(Warning{
+				Code:    WarningUnknownMediaType,
+				Message: fmt.Sprintf("layer %s has an unknown media type: %s", layer.Digest, layer.MediaType),
+				Field:   fmt.Sprintf("/layers/%d/mediaType", i),
+				Digest:  layer.Digest,
+			})
 		}
 	}
-	return nil
-}
 
-func validateDescriptor(r io.Reader) error {
-	header := v1.Descriptor{}
+	doc := &document{buf: buf}
+	errs := checkDescriptor(doc, "/config", header.Config)
+	for i, layer := range header.Layers {
+		errs = append(errs, checkDescriptor(doc, fmt.Sprintf("/layers/%d", i), layer)...)
+	}
+	if header.Subject != nil {
+		errs = append(errs, checkDescriptor(doc, "/subject", *header.Subject)...)
+	}
+	if header.Config.MediaType == v1.MediaTypeEmptyJSON && header.ArtifactType == "" {
+		errs = append(errs, doc.fieldError("", KeywordArtifactType, nil,
+			"artifactType is required when the config has the empty media type"))
+	}
 
-	buf, err := ioutil.ReadAll(r)
-	if err != nil {
-		return errors.Wrapf(err, "error reading the io stream")
+	errs = append(errs, s.checkAnnotations(doc, "", header.Annotations)...)
+	errs = append(errs, s.checkAnnotations(doc, "/config", header.Config.Annotations)...)
+	for i, layer := range header.Layers {
+		errs = append(errs, s.checkAnnotations(doc, fmt.Sprintf("/layers/%d", i), layer.Annotations)...)
 	}
+	return validationError(errs)
+}
 
-	err = json.Unmarshal(buf, &header)
+func validateDescriptor(buf []byte, s *validation) error {
+	header := v1.Descriptor{}
+
+	err := json.Unmarshal(buf, &header)
 	if err != nil {
 		return errors.Wrap(err, "descriptor format mismatch")
 	}
@@ -143,54 +162,72 @@ func validateDescriptor(r io.Reader) error {
 	err = header.Digest.Validate()
 	if err == digest.ErrDigestUnsupported {
 		// we ignore unsupported algorithms
-		fmt.Printf("warning: unsupported digest: %q: %v\n", header.Digest, err)
-		return nil
+		s.warn(Warning{
+			Code:    WarningUnsupportedDigest,
+			Message: fmt.Sprintf("unsupported digest: %q: %v", header.Digest, err),
+			Field:   "/digest",
+			Digest:  header.Digest,
+		})
+	} else if err != nil {
+		return err
 	}
-	return err
+
+	doc := &document{buf: buf}
+	errs := checkDescriptor(doc, "", header)
+	errs = append(errs, s.checkAnnotations(doc, "", header.Annotations)...)
+	return validationError(errs)
 }
 
-func validateIndex(r io.Reader) error {
+func validateIndex(buf []byte, s *validation) error {
 	header := v1.Index{}
 
-	buf, err := ioutil.ReadAll(r)
-	if err != nil {
-		return errors.Wrapf(err, "error reading the io stream")
-	}
-
-	err = json.Unmarshal(buf, &header)
+	err := json.Unmarshal(buf, &header)
 	if err != nil {
 		return errors.Wrap(err, "index format mismatch")
 	}
 
-	for _, manifest := range header.Manifests {
+	for i, manifest := range header.Manifests {
 		if manifest.MediaType != string(v1.MediaTypeImageManifest) {
-			fmt.Printf("warning: manifest %s has an unknown media type: %s\n", manifest.Digest, manifest.MediaType)
+			s.warn(Warning{
+				Code:    WarningUnknownMediaType,
+				Message: fmt.Sprintf("manifest %s has an unknown media type: %s", manifest.Digest, manifest.MediaType),
+				Field:   fmt.Sprintf("/manifests/%d/mediaType", i),
+				Digest:  manifest.Digest,
+			})
 		}
 		if manifest.Platform != nil {
-			checkPlatform(manifest.Platform.OS, manifest.Platform.Architecture)
-			checkArchitecture(manifest.Platform.Architecture, manifest.Platform.Variant)
+			field := fmt.Sprintf("/manifests/%d/platform", i)
+			s.checkPlatform(field, manifest.Digest, manifest.Platform.OS, manifest.Platform.Architecture)
+			s.checkArchitecture(field, manifest.Digest, manifest.Platform.Architecture, manifest.Platform.Variant)
 		}
+	}
 
+	doc := &document{buf: buf}
+	var errs []error
+	for i, manifest := range header.Manifests {
+		errs = append(errs, checkDescriptor(doc, fmt.Sprintf("/manifests/%d", i), manifest)...)
+	}
+	if header.Subject != nil {
+		errs = append(errs, checkDescriptor(doc, "/subject", *header.Subject)...)
 	}
 
-	return nil
+	errs = append(errs, s.checkAnnotations(doc, "", header.Annotations)...)
+	for i, manifest := range header.Manifests {
+		errs = append(errs, s.checkAnnotations(doc, fmt.Sprintf("/manifests/%d", i), manifest.Annotations)...)
+	}
+	return validationError(errs)
 }
 
-func validateConfig(r io.Reader) error {
+func validateConfig(buf []byte, s *validation) error {
 	header := v1.Image{}
 
-	buf, err := ioutil.ReadAll(r)
-	if err != nil {
-		return errors.Wrapf(err, "error reading the io stream")
-	}
-
-	err = json.Unmarshal(buf, &header)
+	err := json.Unmarshal(buf, &header)
 	if err != nil {
 		return errors.Wrap(err, "config format mismatch")
 	}
 
-	checkPlatform(header.OS, header.Architecture)
-	checkArchitecture(header.Architecture, header.Variant)
+	s.checkPlatform("", "", header.OS, header.Architecture)
+	s.checkArchitecture("", "", header.Architecture, header.Variant)
 
 	envRegexp := regexp.MustCompile(`^[^=]+=.*$`)
 	for _, e := range header.Config.Env {
@@ -202,52 +239,85 @@ func validateConfig(r io.Reader) error {
 	return nil
 }
 
-func checkArchitecture(Architecture string, Variant string) {
-	validCombins := map[string][]string{
-		"arm":      {"", "v6", "v7", "v8"},
-		"arm64":    {"", "v8"},
-		"386":      {""},
-		"amd64":    {""},
-		"ppc64":    {""},
-		"ppc64le":  {""},
-		"mips64":   {""},
-		"mips64le": {""},
-		"s390x":    {""},
-	}
-	for arch, variants := range validCombins {
-		if arch == Architecture {
-			for _, variant := range variants {
-				if variant == Variant {
-					return
-				}
-			}
-			fmt.Printf("warning: combination of architecture %q and variant %q is not valid.\n", Architecture, Variant)
-		}
+// checkDescriptor checks the descriptor desc at ptr in doc: its embedded data, if any,
+// must match its digest and size, and a descriptor of the empty media type must describe the value "{}".
+func checkDescriptor(doc *document, ptr string, desc v1.Descriptor) []error {
+	var errs []error
+	if desc.Data != nil && (int64(len(desc.Data)) != desc.Size || !matchesDigest(desc.Digest, desc.Data)) {
+		errs = append(errs, doc.fieldError(ptr+"/data", KeywordData, nil,
+			fmt.Sprintf("data does not match the digest %s and size %d of the descriptor", desc.Digest, desc.Size)))
 	}
-	fmt.Printf("warning: architecture %q is not supported yet.\n", Architecture)
-}
-
-func checkPlatform(OS string, Architecture string) {
-	validCombins := map[string][]string{
-		"android":   {"arm"},
-		"darwin":    {"386", "amd64", "arm", "arm64"},
-		"dragonfly": {"amd64"},
-		"freebsd":   {"386", "amd64", "arm"},
-		"linux":     {"386", "amd64", "arm", "arm64", "ppc64", "ppc64le", "mips64", "mips64le", "s390x"},
-		"netbsd":    {"386", "amd64", "arm"},
-		"openbsd":   {"386", "amd64", "arm"},
-		"plan9":     {"386", "amd64"},
-		"solaris":   {"amd64"},
-		"windows":   {"386", "amd64"}}
-	for os, archs := range validCombins {
-		if os == OS {
-			for _, arch := range archs {
-				if arch == Architecture {
-					return
-				}
-			}
-			fmt.Printf("warning: combination of os %q and architecture %q is invalid.\n", OS, Architecture)
-		}
+	empty := v1.DescriptorEmptyJSON.Data
+	if desc.MediaType == v1.MediaTypeEmptyJSON && (desc.Size != int64(len(empty)) || !matchesDigest(desc.Digest, empty)) {
+		errs = append(errs, doc.fieldError(ptr+"/digest", KeywordEmptyDescriptor, desc.Digest,
+			fmt.Sprintf("descriptor of media type %s does not describe the value {}", v1.MediaTypeEmptyJSON)))
+	}
+	return errs
+}
+
+// matchesDigest reports whether content matches dgst.
+// Digests whose algorithm is not available match any content, they are reported elsewhere.
+func matchesDigest(dgst digest.Digest, content []byte) bool {
+	if dgst.Validate() != nil {
+		return true
+	}
+	return dgst.Algorithm().FromBytes(content) == dgst
+}
+
+// fieldError returns a *FieldError for the value at field in d, which violates the rule keyword.
+func (d *document) fieldError(field, keyword string, value interface{}, description string) *FieldError {
+	fe := &FieldError{
+		Field:       field,
+		Keyword:     keyword,
+		Value:       value,
+		Description: description,
+	}
+	d.locate(fe)
+	return fe
+}
+
+// checkArchitecture warns about unknown architectures and variants.
+// field is the JSON Pointer of the object holding the "architecture" and "variant" properties.
+func (s *validation) checkArchitecture(field string, dgst digest.Digest, Architecture string, Variant string) {
+	platforms := s.platforms()
+	if !platforms.HasArchitecture(Architecture) {
+		s.warn(Warning{
+			Code:    WarningUnsupportedPlatform,
+			Message: fmt.Sprintf("architecture %q is not supported yet.", Architecture),
+			Field:   field + "/architecture",
+			Digest:  dgst,
+		})
+		return
+	}
+	if !platforms.SupportsVariant(Architecture, Variant) {
+		s.warn(Warning{
+			Code:    WarningInvalidPlatform,
+			Message: fmt.Sprintf("combination of architecture %q and variant %q is not valid.", Architecture, Variant),
+			Field:   field + "/variant",
+			Digest:  dgst,
+		})
+	}
+}
+
+// checkPlatform warns about unknown operating systems and os/architecture combinations.
+// field is the JSON Pointer of the object holding the "os" and "architecture" properties.
+func (s *validation) checkPlatform(field string, dgst digest.Digest, OS string, Architecture string) {
+	platforms := s.platforms()
+	if !platforms.HasOS(OS) {
+		s.warn(Warning{
+			Code:    WarningUnsupportedPlatform,
+			Message: fmt.Sprintf("operating system %q of the bundle is not supported yet.", OS),
+			Field:   field + "/os",
+			Digest:  dgst,
+		})
+		return
+	}
+	if !platforms.Supports(OS, Architecture) {
+		s.warn(Warning{
+			Code:    WarningInvalidPlatform,
+			Message: fmt.Sprintf("combination of os %q and architecture %q is invalid.", OS, Architecture),
+			Field:   field + "/architecture",
+			Digest:  dgst,
+		})
 	}
-	fmt.Printf("warning: operating system %q of the bundle is not supported yet.\n", OS)
 }
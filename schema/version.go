@@ -0,0 +1,207 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Released versions of the specification which can be targeted by Options.SpecVersion.
+const (
+	SpecVersion100 = "1.0.0"
+	SpecVersion101 = "1.0.1"
+	SpecVersion110 = "1.1.0"
+)
+
+// specVersions lists the supported versions of the specification, oldest first.
+var specVersions = []string{SpecVersion100, SpecVersion101, SpecVersion110}
+
+// schemaDirs maps the supported versions of the specification to the directory of fs holding their schemas.
+// The schemas of the latest version are at the root of fs, they are also used when no version is targeted.
+// 1.0.1 did not change the schemas of 1.0.0, both versions share the directory v1.0.
+var schemaDirs = map[string]string{
+	SpecVersion100: "/v1.0",
+	SpecVersion101: "/v1.0",
+	SpecVersion110: "",
+}
+
+// mediaTypeVersions maps the media types introduced after 1.0.0 to the version introducing them.
+var mediaTypeVersions = map[string]string{
+	v1.MediaTypeImageLayerZstd:                 SpecVersion110,
+	v1.MediaTypeImageLayerNonDistributableZstd: SpecVersion110,
+	v1.MediaTypeEmptyJSON:                      SpecVersion110,
+}
+
+// annotationVersions maps the pre-defined annotation keys introduced after 1.0.0 to the version introducing them.
+var annotationVersions = map[string]string{
+	v1.AnnotationTitle:           SpecVersion101,
+	v1.AnnotationDescription:     SpecVersion101,
+	v1.AnnotationBaseImageDigest: SpecVersion110,
+	v1.AnnotationBaseImageName:   SpecVersion110,
+}
+
+// fieldVersions maps the media types to their top-level properties introduced after 1.0.0
+// and the version introducing them.
+var fieldVersions = map[Validator]map[string]string{
+	ValidatorMediaTypeImageConfig: {
+		"variant":     SpecVersion110,
+		"os.version":  SpecVersion110,
+		"os.features": SpecVersion110,
+	},
+	ValidatorMediaTypeManifest: {
+		"artifactType": SpecVersion110,
+		"subject":      SpecVersion110,
+	},
+	ValidatorMediaTypeImageIndex: {
+		"artifactType": SpecVersion110,
+		"subject":      SpecVersion110,
+	},
+}
+
+// descriptorFieldVersions maps the properties of descriptors introduced after 1.0.0
+// to the version introducing them. They apply to every object having a "digest" property.
+var descriptorFieldVersions = map[string]string{
+	"data":         SpecVersion110,
+	"artifactType": SpecVersion110,
+}
+
+// A VersionError describes a property, media type or annotation which is not defined
+// by the version of the specification targeted by Options.SpecVersion.
+type VersionError struct {
+	// Field is the JSON Pointer of the offending value, "" if the validated media type itself is not defined.
+	Field string
+
+	// Feature is the property name, media type or annotation key requiring a newer version.
+	Feature string
+
+	// Version is the first version of the specification defining Feature.
+	Version string
+
+	// Target is the targeted version of the specification.
+	Target string
+}
+
+func (e *VersionError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s requires spec version %s, targeting %s", e.Feature, e.Version, e.Target)
+	}
+	return fmt.Sprintf("%s: %s requires spec version %s, targeting %s", e.Field, e.Feature, e.Version, e.Target)
+}
+
+// versionIndex returns the position of version in specVersions.
+func versionIndex(version string) (int, error) {
+	for i, v := range specVersions {
+		if v == version {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("unsupported spec version %q, expected one of %v", version, specVersions)
+}
+
+// checkMediaTypeVersion returns a *VersionError if mediaType is not defined by the target version
+// of the specification, if any.
+func checkMediaTypeVersion(mediaType, target string) error {
+	if target == "" {
+		return nil
+	}
+	t, err := versionIndex(target)
+	if err != nil {
+		return err
+	}
+	if version, ok := mediaTypeVersions[mediaType]; ok {
+		if i, _ := versionIndex(version); i > t {
+			return &VersionError{Feature: mediaType, Version: version, Target: target}
+		}
+	}
+	return nil
+}
+
+// checkVersion returns a *VersionError for every property, media type and annotation
+// of the document buf of mediaType which is not defined by the target version of the specification.
+func checkVersion(mediaType string, buf []byte, target string) ([]error, error) {
+	t, err := versionIndex(target)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	require := func(field, feature, version string) {
+		if i, _ := versionIndex(version); i > t {
+			errs = append(errs, &VersionError{Field: field, Feature: feature, Version: version, Target: target})
+		}
+	}
+
+	if obj, ok := doc.(map[string]interface{}); ok {
+		for _, key := range sortedKeys(obj) {
+			if version, ok := fieldVersions[Validator(mediaType)][key]; ok {
+				require("/"+escapePointer(key), key, version)
+			}
+		}
+	}
+
+	var walk func(ptr string, v interface{})
+	walk = func(ptr string, v interface{}) {
+		switch v := v.(type) {
+		case []interface{}:
+			for i, e := range v {
+				walk(ptr+"/"+strconv.Itoa(i), e)
+			}
+		case map[string]interface{}:
+			_, descriptor := v["digest"]
+			for _, key := range sortedKeys(v) {
+				member := ptr + "/" + escapePointer(key)
+				if version, ok := descriptorFieldVersions[key]; ok && descriptor {
+					require(member, key, version)
+				}
+				switch value := v[key].(type) {
+				case string:
+					if version, ok := mediaTypeVersions[value]; ok && key == "mediaType" {
+						require(member, value, version)
+					}
+				case map[string]interface{}:
+					if key == "annotations" {
+						for _, k := range sortedKeys(value) {
+							if version, ok := annotationVersions[k]; ok {
+								require(member+"/"+escapePointer(k), k, version)
+							}
+						}
+					}
+				}
+				walk(member, v[key])
+			}
+		}
+	}
+	walk("", doc)
+	return errs, nil
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,266 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+func TestSpecVersion(t *testing.T) {
+	const manifest = `{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.oci.image.config.v1+json",
+    "size": 1470,
+    "digest": "sha256:c86f7763873b6c0aae22d963bab59b4f5debbed6685761b5951584f6efb0633b"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.image.layer.v1.tar+zstd",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ],
+  "annotations": {
+    "org.opencontainers.image.title": "title",
+    "org.opencontainers.image.base.name": "docker.io/library/busybox:latest",
+    "org.opencontainers.image.authors": "authors"
+  }
+}`
+	const artifact = `{
+  "schemaVersion": 2,
+  "artifactType": "application/vnd.example.sbom.v1+json",
+  "config": {
+    "mediaType": "application/vnd.oci.empty.v1+json",
+    "size": 2,
+    "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+    "data": "e30="
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.example.sbom.v1+json",
+      "size": 148,
+      "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"
+    }
+  ],
+  "subject": {
+    "mediaType": "application/vnd.oci.image.manifest.v1+json",
+    "size": 7682,
+    "digest": "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270"
+  }
+}`
+	const config = `{
+  "architecture": "arm64",
+  "variant": "v8",
+  "os": "linux",
+  "rootfs": {"type": "layers", "diff_ids": []}
+}`
+
+	for i, tt := range []struct {
+		validator schema.Validator
+		doc       string
+		version   string
+		fields    []string // fields of the expected *schema.VersionError
+	}{
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest,
+			version:   schema.SpecVersion100,
+			fields: []string{
+				"/annotations/org.opencontainers.image.base.name",
+				"/annotations/org.opencontainers.image.title",
+				"/layers/0/mediaType",
+			},
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest,
+			version:   schema.SpecVersion101,
+			fields: []string{
+				"/annotations/org.opencontainers.image.base.name",
+				"/layers/0/mediaType",
+			},
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest,
+			version:   schema.SpecVersion110,
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       manifest,
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       artifact,
+			version:   schema.SpecVersion101,
+			fields: []string{
+				"/artifactType",
+				"/subject",
+				"/config/data",
+				"/config/mediaType",
+			},
+		},
+		{
+			validator: schema.ValidatorMediaTypeManifest,
+			doc:       artifact,
+			version:   schema.SpecVersion110,
+		},
+		{
+			validator: schema.ValidatorMediaTypeImageConfig,
+			doc:       config,
+			version:   schema.SpecVersion101,
+			fields:    []string{"/variant"},
+		},
+		{
+			validator: schema.ValidatorMediaTypeImageLayerZstd,
+			doc:       "",
+			version:   schema.SpecVersion100,
+			fields:    []string{""},
+		},
+	} {
+		_, err := tt.validator.ValidateWithOptions(strings.NewReader(tt.doc), schema.Options{SpecVersion: tt.version})
+		if len(tt.fields) == 0 {
+			if err != nil {
+				t.Errorf("test %d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+
+		errs := []error{errors.Cause(err)}
+		if verr, ok := errors.Cause(err).(schema.ValidationError); ok {
+			errs = verr.Errs
+		}
+		if len(errs) != len(tt.fields) {
+			t.Errorf("test %d: expected errors for %v, got %v", i, tt.fields, err)
+			continue
+		}
+		for j, e := range errs {
+			verr, ok := e.(*schema.VersionError)
+			if !ok || verr.Field != tt.fields[j] || verr.Target != tt.version {
+				t.Errorf("test %d: expected a version error for %q, got %v", i, tt.fields[j], e)
+			}
+		}
+	}
+
+	_, err := schema.ValidatorMediaTypeImageConfig.ValidateWithOptions(bytes.NewReader([]byte(config)), schema.Options{SpecVersion: "0.9.0"})
+	if err == nil {
+		t.Errorf("expected an unsupported version error")
+	}
+}
+
+func TestSpecVersionSchemas(t *testing.T) {
+	// variant is not defined by the 1.0.x schemas, so only its version is reported
+	const config = `{
+  "architecture": "arm64",
+  "variant": 8,
+  "os": "linux",
+  "rootfs": {"type": "layers", "diff_ids": []}
+}`
+
+	for _, tt := range []struct {
+		version string
+		err     interface{}
+	}{
+		{version: schema.SpecVersion100, err: &schema.VersionError{}},
+		{version: schema.SpecVersion101, err: &schema.VersionError{}},
+		{version: schema.SpecVersion110, err: &schema.FieldError{}},
+		{version: "", err: &schema.FieldError{}},
+	} {
+		_, err := schema.ValidatorMediaTypeImageConfig.ValidateWithOptions(strings.NewReader(config), schema.Options{SpecVersion: tt.version})
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok || len(verr.Errs) != 1 {
+			t.Errorf("%q: expected a single error, got %v", tt.version, err)
+			continue
+		}
+		if reflect.TypeOf(verr.Errs[0]) != reflect.TypeOf(tt.err) {
+			t.Errorf("%q: expected a %T, got %v", tt.version, tt.err, verr.Errs[0])
+		}
+	}
+}
+
+func TestDescriptorData(t *testing.T) {
+	for i, tt := range []struct {
+		doc     string
+		keyword string // of the expected *schema.FieldError, "" for none
+	}{
+		{
+			doc: `{"mediaType": "application/vnd.oci.empty.v1+json", "size": 2,
+  "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", "data": "e30="}`,
+		},
+		{
+			doc: `{"mediaType": "application/vnd.oci.image.config.v1+json", "size": 3,
+  "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", "data": "e30="}`,
+			keyword: schema.KeywordData,
+		},
+		{
+			doc: `{"mediaType": "application/vnd.oci.empty.v1+json", "size": 148,
+  "digest": "sha256:c57089565e894899735d458f0fd4bb17a0f1e0df8d72da392b85c9b35ee777cd"}`,
+			keyword: schema.KeywordEmptyDescriptor,
+		},
+		{
+			doc: `{"mediaType": "application/vnd.oci.image.config.v1+json", "size": 2,
+  "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", "data": "e30"}`,
+			keyword: "pattern",
+		},
+	} {
+		err := schema.ValidatorMediaTypeDescriptor.Validate(strings.NewReader(tt.doc))
+		if tt.keyword == "" {
+			if err != nil {
+				t.Errorf("test %d: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		verr, ok := errors.Cause(err).(schema.ValidationError)
+		if !ok || len(verr.Errs) != 1 {
+			t.Errorf("test %d: expected a single error, got %v", i, err)
+			continue
+		}
+		if fe, ok := verr.Errs[0].(*schema.FieldError); !ok || fe.Keyword != tt.keyword {
+			t.Errorf("test %d: expected a %q field error, got %v", i, tt.keyword, verr.Errs[0])
+		}
+	}
+
+	// an image manifest with an empty config describes an artifact, whose type is required
+	const manifest = `{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.oci.empty.v1+json",
+    "size": 2,
+    "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+  },
+  "layers": [
+    {
+      "mediaType": "application/vnd.oci.empty.v1+json",
+      "size": 2,
+      "digest": "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+    }
+  ]
+}`
+	err := schema.ValidatorMediaTypeManifest.Validate(strings.NewReader(manifest))
+	verr, ok := errors.Cause(err).(schema.ValidationError)
+	if !ok || len(verr.Errs) != 1 {
+		t.Fatalf("expected a single error, got %v", err)
+	}
+	if fe, ok := verr.Errs[0].(*schema.FieldError); !ok || fe.Keyword != schema.KeywordArtifactType {
+		t.Errorf("expected a %q field error, got %v", schema.KeywordArtifactType, verr.Errs[0])
+	}
+}
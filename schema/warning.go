@@ -0,0 +1,95 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"io"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// WarningCode identifies the kind of a Warning.
+type WarningCode string
+
+// Warning codes reported by the validators of this package.
+const (
+	// WarningUnknownMediaType is reported for a descriptor whose media type is not one expected at its position.
+	WarningUnknownMediaType WarningCode = "unknown-media-type"
+
+	// WarningUnsupportedDigest is reported for a digest using an algorithm which is not supported.
+	WarningUnsupportedDigest WarningCode = "unsupported-digest"
+
+	// WarningInvalidPlatform is reported for an invalid combination of os, architecture and variant.
+	WarningInvalidPlatform WarningCode = "invalid-platform"
+
+	// WarningUnsupportedPlatform is reported for an os or architecture which is not known.
+	WarningUnsupportedPlatform WarningCode = "unsupported-platform"
+
+	// WarningMissingBlob is reported for a blob referenced in an image layout but missing from it.
+	WarningMissingBlob WarningCode = "missing-blob"
+
+	// WarningSparseFile is reported for a sparse file in a layer, which layers SHOULD NOT use.
+	WarningSparseFile WarningCode = "sparse-file"
+
+	// WarningNonCanonical is reported for a JSON document which is not canonical JSON,
+	// which content-addressable documents SHOULD use, see Options.Canonical.
+	WarningNonCanonical WarningCode = "non-canonical"
+
+	// WarningInvalidAnnotation is reported for a pre-defined annotation whose value does not have the expected format.
+	// In strict mode, such values are reported as *FieldError instead.
+	WarningInvalidAnnotation WarningCode = "invalid-annotation"
+)
+
+// A Warning describes a non-fatal problem found during validation.
+type Warning struct {
+	// Code identifies the kind of problem.
+	Code WarningCode
+
+	// Message is a human readable description of the problem.
+	Message string
+
+	// Field is the JSON Pointer of the value the warning is about.
+	Field string
+
+	// Digest is the digest of the descriptor the warning is about, if any.
+	Digest digest.Digest
+}
+
+// Error implements error so that warnings can be reported as errors in a ValidationError.
+func (w Warning) Error() string {
+	return w.Message
+}
+
+// A WarningHandler receives warnings as they are found during validation.
+type WarningHandler interface {
+	Warn(w Warning)
+}
+
+// WarningHandlerFunc adapts an ordinary function to a WarningHandler.
+type WarningHandlerFunc func(w Warning)
+
+// Warn calls f(w).
+func (f WarningHandlerFunc) Warn(w Warning) {
+	f(w)
+}
+
+// PrintWarnings returns a WarningHandler writing each warning to w
+// as a "warning: " prefixed line.
+func PrintWarnings(w io.Writer) WarningHandler {
+	return WarningHandlerFunc(func(warning Warning) {
+		fmt.Fprintf(w, "warning: %s\n", warning.Message)
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/image-spec/platform"
+	"github.com/opencontainers/image-spec/schema"
+	"github.com/pkg/errors"
+)
+
+const warningIndex = `
+{
+  "schemaVersion": 2,
+  "manifests": [
+    {
+      "mediaType": "application/vnd.oci.image.manifest.v1+json",
+      "size": 7143,
+      "digest": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+      "platform": {
+        "architecture": "ppc64le",
+        "os": "linux"
+      }
+    },
+    {
+      "mediaType": "application/xml",
+      "size": 7682,
+      "digest": "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+      "platform": {
+        "architecture": "arm64",
+        "os": "linux",
+        "variant": "v5"
+      }
+    }
+  ]
+}
+`
+
+func TestWarnings(t *testing.T) {
+	var handled []schema.Warning
+	var printed bytes.Buffer
+	handler := schema.WarningHandlerFunc(func(w schema.Warning) {
+		handled = append(handled, w)
+		schema.PrintWarnings(&printed).Warn(w)
+	})
+
+	result, err := schema.ValidatorMediaTypeImageIndex.ValidateWithOptions(strings.NewReader(warningIndex), schema.Options{
+		WarningHandler: handler,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []schema.Warning{
+		{
+			Code:    schema.WarningUnknownMediaType,
+			Message: "manifest sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270 has an unknown media type: application/xml",
+			Field:   "/manifests/1/mediaType",
+			Digest:  "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		},
+		{
+			Code:    schema.WarningInvalidPlatform,
+			Message: `combination of architecture "arm64" and variant "v5" is not valid.`,
+			Field:   "/manifests/1/platform/variant",
+			Digest:  "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		},
+	}
+	if !reflect.DeepEqual(result.Warnings, expected) {
+		t.Errorf("expected warnings %#v, got %#v", expected, result.Warnings)
+	}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Errorf("expected handled warnings %#v, got %#v", expected, handled)
+	}
+	if !strings.HasPrefix(printed.String(), "warning: manifest sha256:5b0b") {
+		t.Errorf("unexpected printed warnings: %q", printed.String())
+	}
+
+	// the zero Options discard warnings
+	if err := schema.ValidatorMediaTypeImageIndex.Validate(strings.NewReader(warningIndex)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWarningsAsErrors(t *testing.T) {
+	result, err := schema.ValidatorMediaTypeImageIndex.ValidateWithOptions(strings.NewReader(warningIndex), schema.Options{
+		WarningsAsErrors: true,
+	})
+	verr, ok := errors.Cause(err).(schema.ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if len(verr.Errs) != 2 || len(result.Warnings) != 2 {
+		t.Fatalf("expected 2 errors and warnings, got %v and %v", verr.Errs, result.Warnings)
+	}
+	if w, ok := verr.Errs[0].(schema.Warning); !ok || w.Code != schema.WarningUnknownMediaType {
+		t.Errorf("unexpected error %#v", verr.Errs[0])
+	}
+}
+
+func TestPlatforms(t *testing.T) {
+	internal := platform.NewRegistry()
+	internal.AddOS("acmeos", "acme64")
+	internal.AddArchitecture("acme64", "", "gen2")
+
+	for i, tt := range []struct {
+		platform  string
+		platforms *platform.Registry
+		warning   schema.WarningCode
+	}{
+		{platform: `"os": "linux", "architecture": "riscv64"`},
+		{platform: `"os": "linux", "architecture": "loong64"`},
+		{platform: `"os": "wasip1", "architecture": "wasm"`},
+		{platform: `"os": "linux", "architecture": "arm64", "variant": "v8.2"`},
+		{platform: `"os": "linux", "architecture": "arm64", "variant": "v9"`},
+		{platform: `"os": "linux", "architecture": "amd64", "variant": "v3"`},
+		{platform: `"os": "linux", "architecture": "amd64", "variant": "v5"`, warning: schema.WarningInvalidPlatform},
+		{platform: `"os": "plan9", "architecture": "s390x"`, warning: schema.WarningInvalidPlatform},
+		{platform: `"os": "acmeos", "architecture": "acme64"`, warning: schema.WarningUnsupportedPlatform},
+		{platform: `"os": "acmeos", "architecture": "acme64", "variant": "gen2"`, platforms: internal},
+		{platform: `"os": "linux", "architecture": "acme64"`, platforms: internal, warning: schema.WarningInvalidPlatform},
+	} {
+		index := `{
+  "schemaVersion": 2,
+  "manifests": [
+    {
+      "mediaType": "application/vnd.oci.image.manifest.v1+json",
+      "size": 7143,
+      "digest": "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+      "platform": {` + tt.platform + `}
+    }
+  ]
+}`
+		result, err := schema.ValidatorMediaTypeImageIndex.ValidateWithOptions(strings.NewReader(index), schema.Options{
+			Platforms: tt.platforms,
+		})
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if tt.warning == "" {
+			if len(result.Warnings) != 0 {
+				t.Errorf("test %d: unexpected warnings %v", i, result.Warnings)
+			}
+			continue
+		}
+		if len(result.Warnings) == 0 || result.Warnings[0].Code != tt.warning {
+			t.Errorf("test %d: expected a %s warning, got %v", i, tt.warning, result.Warnings)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spdx parses SPDX license expressions, such as the value of the
+// org.opencontainers.image.licenses annotation, checks their identifiers
+// against the SPDX License List and evaluates them against a license policy.
+package spdx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// An Expression is a parsed SPDX license expression: a *License, an *And or an *Or.
+type Expression interface {
+	// String returns the expression in its normalized form.
+	String() string
+
+	expression()
+}
+
+// A License is a simple expression: a license identifier or reference,
+// optionally followed by "+" and a license exception.
+type License struct {
+	// ID is a license identifier of the SPDX License List, e.g. "MIT",
+	// or a license reference, e.g. "LicenseRef-custom".
+	ID string
+
+	// OrLater is set for license identifiers followed by "+", meaning this version or any later one.
+	OrLater bool
+
+	// DocumentRef is the document defining the license reference, e.g. "DocumentRef-licenses", if any.
+	DocumentRef string
+
+	// Exception is the license exception identifier following "WITH", if any.
+	Exception string
+}
+
+// And is the conjunction of two expressions: both licenses apply.
+type And struct {
+	Left, Right Expression
+}
+
+// Or is the disjunction of two expressions: either license may be chosen.
+type Or struct {
+	Left, Right Expression
+}
+
+func (*License) expression() {}
+func (*And) expression()     {}
+func (*Or) expression()      {}
+
+// IsRef reports whether l is a license reference rather than an identifier of the SPDX License List.
+func (l *License) IsRef() bool {
+	return strings.HasPrefix(l.ID, licenseRefPrefix)
+}
+
+func (l *License) String() string {
+	var b strings.Builder
+	if l.DocumentRef != "" {
+		b.WriteString(l.DocumentRef)
+		b.WriteByte(':')
+	}
+	b.WriteString(l.ID)
+	if l.OrLater {
+		b.WriteByte('+')
+	}
+	if l.Exception != "" {
+		b.WriteString(" WITH ")
+		b.WriteString(l.Exception)
+	}
+	return b.String()
+}
+
+func (e *And) String() string {
+	return parenthesizeOr(e.Left) + " AND " + parenthesizeOr(e.Right)
+}
+
+func (e *Or) String() string {
+	return e.Left.String() + " OR " + e.Right.String()
+}
+
+// parenthesizeOr returns the string of e, in parentheses if e is an *Or operand of an *And.
+func parenthesizeOr(e Expression) string {
+	if _, ok := e.(*Or); ok {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+// Licenses returns the simple expressions of e, from left to right.
+func Licenses(e Expression) []*License {
+	switch e := e.(type) {
+	case *License:
+		return []*License{e}
+	case *And:
+		return append(Licenses(e.Left), Licenses(e.Right)...)
+	case *Or:
+		return append(Licenses(e.Left), Licenses(e.Right)...)
+	}
+	return nil
+}
+
+const (
+	licenseRefPrefix  = "LicenseRef-"
+	documentRefPrefix = "DocumentRef-"
+)
+
+// idstringRegexp matches the idstring production of the SPDX expression grammar.
+var idstringRegexp = regexp.MustCompile(`^[A-Za-z0-9.-]+$`)
+
+// A SyntaxError describes an invalid SPDX license expression.
+type SyntaxError struct {
+	// Offset is the byte offset of the offending token in the expression.
+	Offset int
+
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Msg)
+}
+
+// Parse parses the SPDX license expression s.
+// WITH binds tighter than AND, which binds tighter than OR.
+// Operators must be upper case.
+// Parse only checks the syntax of s, see Validate for its identifiers.
+func Parse(s string) (Expression, error) {
+	p := &parser{tokens: tokenize(s), end: len(s)}
+	if len(p.tokens) == 0 {
+		return nil, &SyntaxError{Msg: "empty expression"}
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, &SyntaxError{Offset: tok.offset, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+	return e, nil
+}
+
+type token struct {
+	text   string
+	offset int
+}
+
+// tokenize splits s into parentheses and words separated by white space.
+func tokenize(s string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if start >= 0 {
+				tokens = append(tokens, token{s[start:i], start})
+				start = -1
+			}
+			if r == '(' || r == ')' {
+				tokens = append(tokens, token{string(r), i})
+			}
+		case start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{s[start:], start})
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	end    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{offset: p.end}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) accept(text string) bool {
+	if tok, ok := p.peek(); ok && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Expression, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Expression, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) operand() (Expression, error) {
+	if p.accept("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			tok, _ := p.peek()
+			return nil, &SyntaxError{Offset: tok.offset, Msg: "missing closing parenthesis"}
+		}
+		return e, nil
+	}
+
+	l, err := p.license()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("WITH") {
+		tok, err := p.word("license exception")
+		if err != nil {
+			return nil, err
+		}
+		if !idstringRegexp.MatchString(tok.text) {
+			return nil, &SyntaxError{Offset: tok.offset, Msg: fmt.Sprintf("invalid license exception %q", tok.text)}
+		}
+		l.Exception = tok.text
+	}
+	return l, nil
+}
+
+// word returns the next token, which must not be an operator or a parenthesis.
+func (p *parser) word(what string) (token, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return tok, &SyntaxError{Offset: tok.offset, Msg: fmt.Sprintf("missing %s", what)}
+	}
+	switch tok.text {
+	case "AND", "OR", "WITH", "(", ")":
+		return tok, &SyntaxError{Offset: tok.offset, Msg: fmt.Sprintf("unexpected %q, expected a %s", tok.text, what)}
+	}
+	p.pos++
+	return tok, nil
+}
+
+func (p *parser) license() (*License, error) {
+	tok, err := p.word("license")
+	if err != nil {
+		return nil, err
+	}
+	invalid := &SyntaxError{Offset: tok.offset, Msg: fmt.Sprintf("invalid license %q", tok.text)}
+
+	l := &License{ID: tok.text}
+	if strings.HasPrefix(l.ID, documentRefPrefix) {
+		i := strings.IndexByte(l.ID, ':')
+		if i < 0 || !idstringRegexp.MatchString(l.ID[len(documentRefPrefix):i]) {
+			return nil, invalid
+		}
+		l.DocumentRef, l.ID = l.ID[:i], l.ID[i+1:]
+		if !l.IsRef() {
+			return nil, invalid
+		}
+	}
+	if l.IsRef() {
+		if !idstringRegexp.MatchString(l.ID[len(licenseRefPrefix):]) {
+			return nil, invalid
+		}
+		return l, nil
+	}
+
+	if strings.HasSuffix(l.ID, "+") {
+		l.ID, l.OrLater = strings.TrimSuffix(l.ID, "+"), true
+	}
+	if !idstringRegexp.MatchString(l.ID) {
+		return nil, invalid
+	}
+	return l, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import "strings"
+
+// A Policy decides which licenses are acceptable.
+//
+// Entries are matched case-insensitively against the license identifier alone, e.g. "GPL-2.0",
+// which matches the license with or without "+" and exception, the identifier followed by "+",
+// or the complete simple expression, e.g. "GPL-2.0+ WITH Classpath-exception-2.0".
+type Policy struct {
+	// Allow lists the acceptable licenses. If empty, every license which is not denied is acceptable.
+	Allow []string
+
+	// Deny lists the licenses which are never acceptable, even if allowed.
+	Deny []string
+}
+
+// Evaluate reports whether the licenses of e satisfy p, given that both operands of an AND apply
+// and that either operand of an OR may be chosen.
+// If so, it returns the licenses of a satisfying choice, preferring the left operand of an OR.
+func (p *Policy) Evaluate(e Expression) (choice []*License, ok bool) {
+	switch e := e.(type) {
+	case *License:
+		if p.accepts(e) {
+			return []*License{e}, true
+		}
+	case *And:
+		left, ok := p.Evaluate(e.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := p.Evaluate(e.Right)
+		if !ok {
+			return nil, false
+		}
+		return append(left, right...), true
+	case *Or:
+		if choice, ok := p.Evaluate(e.Left); ok {
+			return choice, true
+		}
+		return p.Evaluate(e.Right)
+	}
+	return nil, false
+}
+
+// accepts reports whether l is acceptable.
+func (p *Policy) accepts(l *License) bool {
+	if matches(p.Deny, l) {
+		return false
+	}
+	return len(p.Allow) == 0 || matches(p.Allow, l)
+}
+
+// matches reports whether one of entries matches l.
+func matches(entries []string, l *License) bool {
+	id := &License{ID: l.ID, DocumentRef: l.DocumentRef}
+	orLater := &License{ID: l.ID, DocumentRef: l.DocumentRef, OrLater: l.OrLater}
+	for _, entry := range entries {
+		if strings.EqualFold(entry, id.String()) || strings.EqualFold(entry, orLater.String()) || strings.EqualFold(entry, l.String()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected string // normalized expression, "" if the input is invalid
+		offset   int    // offset of the *SyntaxError for invalid inputs
+	}{
+		{input: "MIT", expected: "MIT"},
+		{input: "  GPL-2.0+  ", expected: "GPL-2.0+"},
+		{input: "MIT OR Apache-2.0 AND BSD-3-Clause", expected: "MIT OR Apache-2.0 AND BSD-3-Clause"},
+		{input: "(MIT OR Apache-2.0) AND BSD-3-Clause", expected: "(MIT OR Apache-2.0) AND BSD-3-Clause"},
+		{input: "((MIT))", expected: "MIT"},
+		{input: "GPL-2.0-or-later WITH Classpath-exception-2.0 OR MIT", expected: "GPL-2.0-or-later WITH Classpath-exception-2.0 OR MIT"},
+		{input: "LicenseRef-custom AND DocumentRef-spdx-tool-1.2:LicenseRef-MIT-Style-2", expected: "LicenseRef-custom AND DocumentRef-spdx-tool-1.2:LicenseRef-MIT-Style-2"},
+		{input: "LicenseRef-custom WITH Classpath-exception-2.0", expected: "LicenseRef-custom WITH Classpath-exception-2.0"},
+		{input: "", offset: 0},
+		{input: "MIT OR", offset: 6},
+		{input: "MIT and Apache-2.0", offset: 4},
+		{input: "(MIT", offset: 4},
+		{input: "MIT)", offset: 3},
+		{input: "MIT WITH", offset: 8},
+		{input: "(MIT OR BSD-2-Clause) WITH Classpath-exception-2.0", offset: 22},
+		{input: "MIT, Apache-2.0", offset: 0},
+		{input: "LicenseRef-", offset: 0},
+		{input: "LicenseRef-custom+", offset: 0},
+		{input: "DocumentRef-doc:MIT", offset: 0},
+	} {
+		e, err := Parse(tc.input)
+		if tc.expected == "" {
+			serr, ok := err.(*SyntaxError)
+			if !ok || serr.Offset != tc.offset {
+				t.Errorf("%q: expected a syntax error at offset %d, got %v", tc.input, tc.offset, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.input, err)
+			continue
+		}
+		if e.String() != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.input, tc.expected, e.String())
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		input   string
+		unknown string
+	}{
+		{input: "MIT OR apache-2.0"},
+		{input: "GPL-2.0+ WITH Classpath-exception-2.0"},
+		{input: "LicenseRef-anything AND BSD-3-Clause"},
+		{input: "MIT AND Not-A-License", unknown: "Not-A-License"},
+		{input: "GPL-2.0-only WITH Not-An-Exception", unknown: "Not-An-Exception"},
+	} {
+		e, err := Parse(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = Validate(e)
+		if tc.unknown == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tc.input, err)
+			}
+			continue
+		}
+		uerr, ok := err.(*UnknownIdentifierError)
+		if !ok || uerr.ID != tc.unknown {
+			t.Errorf("%q: expected %q to be unknown, got %v", tc.input, tc.unknown, err)
+		}
+	}
+
+	if id, deprecated, ok := LookupLicense("gpl-2.0"); !ok || id != "GPL-2.0" || !deprecated {
+		t.Errorf("expected the deprecated GPL-2.0, got %q, %t, %t", id, deprecated, ok)
+	}
+	if id, deprecated, ok := LookupLicense("mit"); !ok || id != "MIT" || deprecated {
+		t.Errorf("expected MIT, got %q, %t, %t", id, deprecated, ok)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{
+		Allow: []string{"MIT", "Apache-2.0", "GPL-2.0 WITH Classpath-exception-2.0", "LicenseRef-internal"},
+		Deny:  []string{"apache-2.0+"},
+	}
+	for _, tc := range []struct {
+		input  string
+		choice string // licenses of the expected choice, "" if the expression is rejected
+	}{
+		{input: "MIT", choice: "MIT"},
+		{input: "GPL-3.0-only", choice: ""},
+		{input: "GPL-3.0-only OR MIT", choice: "MIT"},
+		{input: "GPL-3.0-only AND MIT", choice: ""},
+		{input: "(GPL-3.0-only OR MIT) AND Apache-2.0", choice: "MIT Apache-2.0"},
+		{input: "Apache-2.0+", choice: ""},
+		{input: "GPL-2.0", choice: ""},
+		{input: "GPL-2.0 WITH Classpath-exception-2.0", choice: "GPL-2.0 WITH Classpath-exception-2.0"},
+		{input: "LicenseRef-internal OR MIT", choice: "LicenseRef-internal"},
+	} {
+		e, err := Parse(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		choice, ok := policy.Evaluate(e)
+		if ok != (tc.choice != "") {
+			t.Errorf("%q: expected acceptance %t, got %t", tc.input, tc.choice != "", ok)
+			continue
+		}
+		var got string
+		for i, l := range choice {
+			if i > 0 {
+				got += " "
+			}
+			got += l.String()
+		}
+		if got != tc.choice {
+			t.Errorf("%q: expected choice %q, got %q", tc.input, tc.choice, got)
+		}
+	}
+
+	// an empty allow list accepts everything which is not denied
+	e, err := Parse("GPL-3.0-only AND Apache-2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (&Policy{}).Evaluate(e); !ok {
+		t.Errorf("expected the empty policy to accept %v", e)
+	}
+	if _, ok := (&Policy{Deny: []string{"GPL-3.0-only"}}).Evaluate(e); ok {
+		t.Errorf("expected the policy to reject %v", e)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// licenseIDs and exceptionIDs map the lower case identifiers of the SPDX License List to their canonical case.
+	licenseIDs   = lowerCaseIndex(licenses)
+	exceptionIDs = lowerCaseIndex(exceptions)
+)
+
+func lowerCaseIndex(ids map[string]bool) map[string]string {
+	index := make(map[string]string, len(ids))
+	for id := range ids {
+		index[strings.ToLower(id)] = id
+	}
+	return index
+}
+
+// LookupLicense returns the license identifier of the SPDX License List matching id,
+// which is case-insensitive, and whether that license is deprecated.
+// ok is false if id is not in the list.
+func LookupLicense(id string) (canonical string, deprecated, ok bool) {
+	canonical, ok = licenseIDs[strings.ToLower(id)]
+	return canonical, licenses[canonical], ok
+}
+
+// LookupException returns the license exception identifier of the SPDX License List matching id,
+// which is case-insensitive, and whether that exception is deprecated.
+// ok is false if id is not in the list.
+func LookupException(id string) (canonical string, deprecated, ok bool) {
+	canonical, ok = exceptionIDs[strings.ToLower(id)]
+	return canonical, exceptions[canonical], ok
+}
+
+// An UnknownIdentifierError is returned by Validate for an identifier which is not in the SPDX License List.
+type UnknownIdentifierError struct {
+	// ID is the unknown identifier.
+	ID string
+
+	// Exception is set if ID is a license exception identifier.
+	Exception bool
+}
+
+func (e *UnknownIdentifierError) Error() string {
+	if e.Exception {
+		return fmt.Sprintf("unknown license exception %q", e.ID)
+	}
+	return fmt.Sprintf("unknown license %q", e.ID)
+}
+
+// Validate checks that the license and exception identifiers of e are in the SPDX License List,
+// returning an *UnknownIdentifierError for the first one which is not.
+// License references are not checked.
+func Validate(e Expression) error {
+	for _, l := range Licenses(e) {
+		if !l.IsRef() {
+			if _, _, ok := LookupLicense(l.ID); !ok {
+				return &UnknownIdentifierError{ID: l.ID}
+			}
+		}
+		if l.Exception != "" {
+			if _, _, ok := LookupException(l.Exception); !ok {
+				return &UnknownIdentifierError{ID: l.Exception, Exception: true}
+			}
+		}
+	}
+	return nil
+}
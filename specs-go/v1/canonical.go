@@ -0,0 +1,248 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// integerRegexp matches the JSON numbers allowed in canonical JSON.
+var integerRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+
+// MarshalCanonical returns the canonical JSON encoding of v, such as a Manifest or an Index,
+// as recommended by considerations.md for content-addressable documents,
+// following the rules of OLPC canonical JSON (http://wiki.laptop.org/go/Canonical_JSON):
+//
+// Object members are sorted by the bytes of their keys, there is no insignificant whitespace,
+// and strings are written as their UTF-8 bytes, escaping only the quotation mark, the backslash
+// and the control characters, so that equal values always have the same encoding, and thus the same digest.
+// Numbers must be integers. The control characters, which the OLPC rules leave unescaped but JSON
+// does not allow in strings, are written as \b, \t, \n, \f or \r, or else as \u00XX in lower case.
+// Strings which are not valid UTF-8 are an error, rather than replaced as json.Marshal does.
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	if err := checkUTF8(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalizeJSON(buf)
+}
+
+// CanonicalizeJSON returns the canonical form of the JSON document buf, see MarshalCanonical.
+// A document is canonical if it is equal to its canonical form.
+// Documents which are not valid UTF-8, or whose strings escape unpaired surrogates, are an error.
+func CanonicalizeJSON(buf []byte) ([]byte, error) {
+	if !utf8.Valid(buf) {
+		return nil, fmt.Errorf("JSON document is not valid UTF-8")
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+	if err := checkSurrogates(buf); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := encodeCanonical(&out, doc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func encodeCanonical(out *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		if v {
+			out.WriteString("true")
+		} else {
+			out.WriteString("false")
+		}
+	case json.Number:
+		if !integerRegexp.MatchString(v.String()) {
+			return fmt.Errorf("canonical JSON does not allow the number %s", v)
+		}
+		if v == "-0" {
+			v = "0"
+		}
+		out.WriteString(v.String())
+	case string:
+		encodeCanonicalString(out, v)
+	case []interface{}:
+		out.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := encodeCanonical(out, e); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			encodeCanonicalString(out, k)
+			out.WriteByte(':')
+			if err := encodeCanonical(out, v[k]); err != nil {
+				return err
+			}
+		}
+		out.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected JSON value of type %T", v)
+	}
+	return nil
+}
+
+// controlEscapes maps the control characters which have a short escape sequence in JSON to its letter.
+var controlEscapes = map[byte]byte{'\b': 'b', '\t': 't', '\n': 'n', '\f': 'f', '\r': 'r'}
+
+func encodeCanonicalString(out *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c < 0x20:
+			out.WriteByte('\\')
+			if e, ok := controlEscapes[c]; ok {
+				out.WriteByte(e)
+			} else {
+				out.WriteString("u00")
+				out.WriteByte(hex[c>>4])
+				out.WriteByte(hex[c&0xf])
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+}
+
+// checkSurrogates fails if a string of the valid JSON document buf escapes an unpaired UTF-16 surrogate,
+// which the decoder would replace with U+FFFD.
+func checkSurrogates(buf []byte) error {
+	inString := false
+	for i := 0; i < len(buf); i++ {
+		switch {
+		case buf[i] == '"':
+			inString = !inString
+		case !inString || buf[i] != '\\':
+		case buf[i+1] != 'u':
+			i++
+		default:
+			r := escapedRune(buf, i)
+			switch {
+			case r >= 0xd800 && r < 0xdc00:
+				if next := escapedRune(buf, i+6); next < 0xdc00 || next >= 0xe000 {
+					return fmt.Errorf("unpaired surrogate \\u%04x in a JSON string", r)
+				}
+				i += 11
+			case r >= 0xdc00 && r < 0xe000:
+				return fmt.Errorf("unpaired surrogate \\u%04x in a JSON string", r)
+			default:
+				i += 5
+			}
+		}
+	}
+	return nil
+}
+
+// escapedRune returns the code unit of the \uXXXX escape at buf[i:], or -1 if there is none.
+func escapedRune(buf []byte, i int) rune {
+	if i+6 > len(buf) || buf[i] != '\\' || buf[i+1] != 'u' {
+		return -1
+	}
+	r, err := strconv.ParseUint(string(buf[i+2:i+6]), 16, 16)
+	if err != nil {
+		return -1
+	}
+	return rune(r)
+}
+
+// checkUTF8 fails if a string which json.Marshal encodes from v is not valid UTF-8.
+func checkUTF8(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		if !utf8.ValidString(v.String()) {
+			return fmt.Errorf("string %q is not valid UTF-8", v.String())
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return checkUTF8(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// encoded in base64
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := checkUTF8(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := checkUTF8(iter.Key()); err != nil {
+				return err
+			}
+			if err := checkUTF8(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).PkgPath != "" && !t.Field(i).Anonymous {
+				// unexported fields are not encoded
+				continue
+			}
+			if err := checkUTF8(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
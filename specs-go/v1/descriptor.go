@@ -32,6 +32,13 @@ type Descriptor struct {
 	// URLs specifies a list of URLs from which this object MAY be downloaded
 	URLs []string `json:"urls,omitempty"`
 
+	// Data is an embedding of the targeted content, encoded in base64 in JSON.
+	// If present, it MUST match the digest and size of the descriptor.
+	Data []byte `json:"data,omitempty"`
+
+	// ArtifactType is the media type of the artifact the descriptor refers to.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Annotations contains arbitrary metadata relating to the targeted content.
 	Annotations map[string]string `json:"annotations,omitempty"`
 
@@ -21,9 +21,18 @@ import "github.com/opencontainers/image-spec/specs-go"
 type Index struct {
 	specs.Versioned
 
+	// MediaType is reserved for compatibility. When used, it holds the media type of this image index.
+	MediaType string `json:"mediaType,omitempty"`
+
+	// ArtifactType is the media type of the artifact, when the image index describes one.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Manifests references platform specific manifests.
 	Manifests []Descriptor `json:"manifests"`
 
+	// Subject, if not nil, references the manifest the image index is associated with.
+	Subject *Descriptor `json:"subject,omitempty"`
+
 	// Annotations contains arbitrary metadata for the image index.
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
@@ -20,6 +20,12 @@ import "github.com/opencontainers/image-spec/specs-go"
 type Manifest struct {
 	specs.Versioned
 
+	// MediaType is reserved for compatibility. When used, it holds the media type of this image manifest.
+	MediaType string `json:"mediaType,omitempty"`
+
+	// ArtifactType is the media type of the artifact, when the image manifest describes one.
+	ArtifactType string `json:"artifactType,omitempty"`
+
 	// Config references a configuration object for a container, by digest.
 	// The referenced configuration object is a JSON blob that the runtime uses to set up the container.
 	Config Descriptor `json:"config"`
@@ -27,6 +33,18 @@ type Manifest struct {
 	// Layers is an indexed list of layers referenced by the manifest.
 	Layers []Descriptor `json:"layers"`
 
+	// Subject, if not nil, references the manifest the image manifest is associated with.
+	Subject *Descriptor `json:"subject,omitempty"`
+
 	// Annotations contains arbitrary metadata for the image manifest.
 	Annotations map[string]string `json:"annotations,omitempty"`
 }
+
+// DescriptorEmptyJSON is the descriptor of a blob holding the value "{}",
+// e.g. the config of an image manifest describing an artifact which needs none.
+var DescriptorEmptyJSON = Descriptor{
+	MediaType: MediaTypeEmptyJSON,
+	Digest:    "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+	Size:      2,
+	Data:      []byte("{}"),
+}
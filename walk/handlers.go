@@ -0,0 +1,84 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package walk
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/opencontainers/image-spec/content"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// Handlers returns a Handler calling hs in order and returning all their children.
+// It stops at the first error, including ErrSkip, so that a handler can skip the following ones.
+func Handlers(hs ...Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+		var children []v1.Descriptor
+		for _, h := range hs {
+			c, err := h.Handle(ctx, desc)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, c...)
+		}
+		return children, nil
+	})
+}
+
+// MediaTypes is a Handler dispatching the descriptors on their media type.
+// Descriptors of a media type without Handler have no children.
+type MediaTypes map[string]Handler
+
+// Handle implements Handler.
+func (m MediaTypes) Handle(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+	h, ok := m[desc.MediaType]
+	if !ok {
+		return nil, nil
+	}
+	return h.Handle(ctx, desc)
+}
+
+// Children returns a Handler reading image indexes and image manifests from p,
+// and returning the descriptors of their manifests, and of their config and layers.
+// Descriptors of other media types have no children.
+func Children(p content.Provider) Handler {
+	return MediaTypes{
+		v1.MediaTypeImageIndex: HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+			var index v1.Index
+			if err := readDocument(ctx, p, desc, &index); err != nil {
+				return nil, errors.Wrap(err, "read image index")
+			}
+			return index.Manifests, nil
+		}),
+		v1.MediaTypeImageManifest: HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+			var manifest v1.Manifest
+			if err := readDocument(ctx, p, desc, &manifest); err != nil {
+				return nil, errors.Wrap(err, "read image manifest")
+			}
+			return append([]v1.Descriptor{manifest.Config}, manifest.Layers...), nil
+		}),
+	}
+}
+
+// readDocument decodes the JSON document desc points to into v.
+func readDocument(ctx context.Context, p content.Provider, desc v1.Descriptor, v interface{}) error {
+	buf, err := content.ReadBlob(ctx, p, desc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
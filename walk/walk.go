@@ -0,0 +1,226 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package walk walks the graph of descriptors from image indexes
+// through image manifests to their configs and layers.
+package walk
+
+import (
+	"context"
+	_ "crypto/sha256" // side-effect to install impls, sha256
+	_ "crypto/sha512" // side-effect to install impls, sha384/sh512
+	"strings"
+	"sync"
+
+	digest "github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// DefaultConcurrency is the number of handlers a Walker runs at once by default.
+const DefaultConcurrency = 8
+
+var (
+	// ErrSkip is returned by a Handler to skip the children of a descriptor.
+	// It does not stop the walk.
+	ErrSkip = errors.New("skip descriptor")
+
+	// ErrCycle is returned for a graph where a descriptor references itself, directly or not.
+	ErrCycle = errors.New("descriptor cycle")
+)
+
+// A Handler handles a descriptor of the graph, and returns its children to walk.
+type Handler interface {
+	Handle(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error)
+}
+
+// HandlerFunc is a function serving as a Handler.
+type HandlerFunc func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error)
+
+// Handle implements Handler.
+func (f HandlerFunc) Handle(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+	return f(ctx, desc)
+}
+
+// A Walker walks the graph of descriptors reachable from roots, calling its Handler once per digest.
+type Walker struct {
+	// Handler handles every descriptor and returns its children, see Children.
+	Handler Handler
+
+	// Concurrency is the maximum number of handlers running at once, DefaultConcurrency if not positive.
+	Concurrency int
+}
+
+// Walk walks the graph of descriptors reachable from descs with h, see Walker.
+func Walk(ctx context.Context, h Handler, descs ...v1.Descriptor) error {
+	w := Walker{Handler: h}
+	return w.Walk(ctx, descs...)
+}
+
+// Walk calls w.Handler with descs and, concurrently, with the children it returns,
+// until the graph is exhausted.
+// Descriptors are handled once per digest, whatever their media type, and in no particular order
+// but for a descriptor being handled before its children.
+//
+// Walk stops at the first error of a handler other than ErrSkip, or when ctx is done,
+// cancelling the context of the running handlers, and returns that error.
+// It fails with ErrCycle if a descriptor is reachable from itself.
+func (w *Walker) Walk(ctx context.Context, descs ...v1.Descriptor) error {
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	walkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wk := &walk{
+		handler: w.Handler,
+		cancel:  cancel,
+		sem:     make(chan struct{}, concurrency),
+		visited: map[digest.Digest]bool{},
+		edges:   map[digest.Digest][]digest.Digest{},
+	}
+	wk.visit(walkCtx, "", descs)
+	wk.wg.Wait()
+
+	if wk.err != nil {
+		return wk.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wk.checkCycles()
+}
+
+// walk is the state of a Walker.Walk.
+type walk struct {
+	handler Handler
+	cancel  func()
+	sem     chan struct{}
+	wg      sync.WaitGroup
+
+	// mu guards the following fields.
+	mu      sync.Mutex
+	err     error
+	visited map[digest.Digest]bool
+	edges   map[digest.Digest][]digest.Digest
+}
+
+// visit handles the descriptors descs, children of parent, or roots if parent is empty.
+func (wk *walk) visit(ctx context.Context, parent digest.Digest, descs []v1.Descriptor) {
+	for _, desc := range descs {
+		if err := desc.Digest.Validate(); err != nil {
+			wk.fail(errors.Wrapf(err, "invalid digest %q", desc.Digest))
+			return
+		}
+
+		wk.mu.Lock()
+		if parent != "" {
+			wk.edges[parent] = append(wk.edges[parent], desc.Digest)
+		}
+		visited := wk.visited[desc.Digest]
+		wk.visited[desc.Digest] = true
+		wk.mu.Unlock()
+		if visited {
+			continue
+		}
+
+		wk.wg.Add(1)
+		go wk.handle(ctx, desc)
+	}
+}
+
+// handle calls the handler with desc, then visits its children.
+func (wk *walk) handle(ctx context.Context, desc v1.Descriptor) {
+	defer wk.wg.Done()
+
+	select {
+	case wk.sem <- struct{}{}:
+	case <-ctx.Done():
+		wk.fail(ctx.Err())
+		return
+	}
+	children, err := wk.handler.Handle(ctx, desc)
+	<-wk.sem
+
+	if errors.Cause(err) == ErrSkip {
+		return
+	}
+	if err != nil {
+		wk.fail(errors.Wrapf(err, "%s", desc.Digest))
+		return
+	}
+	if ctx.Err() == nil {
+		wk.visit(ctx, desc.Digest, children)
+	}
+}
+
+// fail stops the walk with err, unless it already failed.
+func (wk *walk) fail(err error) {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	if wk.err == nil {
+		wk.err = err
+		wk.cancel()
+	}
+}
+
+// checkCycles fails with ErrCycle if the edges walked hold a cycle.
+// Visiting every digest once ends the walk of a graph with cycles,
+// but hides them from the order of the visits, hence the check of the whole graph afterwards.
+func (wk *walk) checkCycles() error {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := map[digest.Digest]int{}
+
+	var path []digest.Digest
+	var dfs func(dgst digest.Digest) error
+	dfs = func(dgst digest.Digest) error {
+		state[dgst] = inProgress
+		path = append(path, dgst)
+		for _, child := range wk.edges[dgst] {
+			switch state[child] {
+			case inProgress:
+				cycle := []string{child.String()}
+				for i := len(path) - 1; i >= 0 && path[i] != child; i-- {
+					cycle = append(cycle, path[i].String())
+				}
+				cycle = append(cycle, child.String())
+				for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return errors.Wrapf(ErrCycle, "%s", strings.Join(cycle, " -> "))
+			case unvisited:
+				if err := dfs(child); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[dgst] = done
+		return nil
+	}
+
+	for dgst := range wk.edges {
+		if state[dgst] == unvisited {
+			if err := dfs(dgst); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
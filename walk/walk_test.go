@@ -0,0 +1,279 @@
+// Copyright 2016 The Linux Foundation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package walk
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/content"
+	"github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// graph is an image index of two image manifests sharing their config and a layer.
+type graph struct {
+	store     *content.MemoryStore
+	index     v1.Descriptor
+	manifests []v1.Descriptor
+	config    v1.Descriptor
+	layers    []v1.Descriptor
+}
+
+func newGraph(t *testing.T) *graph {
+	ctx := context.Background()
+	g := &graph{store: content.NewMemoryStore()}
+
+	write := func(mediaType string, v interface{}) v1.Descriptor {
+		buf, ok := v.([]byte)
+		if !ok {
+			var err error
+			if buf, err = json.Marshal(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		desc, err := content.WriteBlobBytes(ctx, g.store, mediaType, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+
+	g.config = write(v1.MediaTypeImageConfig, []byte("{}"))
+	for _, layer := range []string{"shared", "amd64", "arm64"} {
+		g.layers = append(g.layers, write(v1.MediaTypeImageLayer, []byte(layer)))
+	}
+	for _, layer := range g.layers[1:] {
+		g.manifests = append(g.manifests, write(v1.MediaTypeImageManifest, v1.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			Config:    g.config,
+			Layers:    []v1.Descriptor{g.layers[0], layer},
+		}))
+	}
+	g.index = write(v1.MediaTypeImageIndex, v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: g.manifests,
+	})
+	return g
+}
+
+// recorder records the descriptors it handles.
+type recorder struct {
+	mu      sync.Mutex
+	handled []digest.Digest
+	count   map[digest.Digest]int
+}
+
+func (r *recorder) Handle(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.count == nil {
+		r.count = map[digest.Digest]int{}
+	}
+	r.handled = append(r.handled, desc.Digest)
+	r.count[desc.Digest]++
+	return nil, nil
+}
+
+func (r *recorder) index(dgst digest.Digest) int {
+	for i, d := range r.handled {
+		if d == dgst {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestWalk(t *testing.T) {
+	g := newGraph(t)
+	r := &recorder{}
+	if err := Walk(context.Background(), Handlers(r, Children(g.store)), g.index); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.handled) != 7 {
+		t.Errorf("expected 7 descriptors, got %d", len(r.handled))
+	}
+	for dgst, n := range r.count {
+		if n != 1 {
+			t.Errorf("%s was handled %d times", dgst, n)
+		}
+	}
+	for i, m := range g.manifests {
+		if r.index(m.Digest) < r.index(g.index.Digest) {
+			t.Errorf("manifest %s was handled before its index", m.Digest)
+		}
+		if r.index(g.layers[i+1].Digest) < r.index(m.Digest) {
+			t.Errorf("the layer of manifest %s was handled before it", m.Digest)
+		}
+	}
+}
+
+func TestWalkSkip(t *testing.T) {
+	g := newGraph(t)
+	r := &recorder{}
+	skip := HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+		if desc.Digest == g.manifests[0].Digest {
+			return nil, ErrSkip
+		}
+		return nil, nil
+	})
+	if err := Walk(context.Background(), Handlers(r, skip, Children(g.store)), g.index); err != nil {
+		t.Fatal(err)
+	}
+	if r.count[g.manifests[0].Digest] != 1 {
+		t.Error("the skipped manifest was not handled")
+	}
+	if r.count[g.layers[1].Digest] != 0 {
+		t.Error("a child of the skipped manifest was handled")
+	}
+	if r.count[g.layers[0].Digest] != 1 || r.count[g.layers[2].Digest] != 1 {
+		t.Error("the children of the other manifest were not handled")
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	g := newGraph(t)
+	ctx := context.Background()
+
+	failure := errors.New("failure")
+	fail := HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+		if desc.MediaType == v1.MediaTypeImageLayer {
+			return nil, failure
+		}
+		return nil, nil
+	})
+	if err := Walk(ctx, Handlers(fail, Children(g.store)), g.index); errors.Cause(err) != failure {
+		t.Errorf("expected the error of the handler, got %v", err)
+	}
+
+	missing := v1.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: digest.FromString("missing"), Size: 7}
+	if err := Walk(ctx, Children(g.store), missing); errors.Cause(err) != content.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := Walk(ctx, Children(g.store), v1.Descriptor{Digest: "sha256:nope"}); err == nil {
+		t.Error("expected an invalid digest to fail")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := Walk(cancelled, Children(g.store), g.index); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWalkCycle(t *testing.T) {
+	a := v1.Descriptor{MediaType: v1.MediaTypeImageIndex, Digest: digest.FromString("a")}
+	b := v1.Descriptor{MediaType: v1.MediaTypeImageIndex, Digest: digest.FromString("b")}
+	c := v1.Descriptor{MediaType: v1.MediaTypeImageIndex, Digest: digest.FromString("c")}
+
+	for i, tt := range []struct {
+		roots []v1.Descriptor
+		edges map[digest.Digest][]v1.Descriptor
+		cycle bool
+	}{
+		{
+			roots: []v1.Descriptor{a},
+			edges: map[digest.Digest][]v1.Descriptor{a.Digest: {a}},
+			cycle: true,
+		},
+		{
+			roots: []v1.Descriptor{a},
+			edges: map[digest.Digest][]v1.Descriptor{a.Digest: {b}, b.Digest: {c}, c.Digest: {a}},
+			cycle: true,
+		},
+		{
+			// b and c are visited from a before they reach each other
+			roots: []v1.Descriptor{a},
+			edges: map[digest.Digest][]v1.Descriptor{a.Digest: {b, c}, b.Digest: {c}, c.Digest: {b}},
+			cycle: true,
+		},
+		{
+			roots: []v1.Descriptor{a, b},
+			edges: map[digest.Digest][]v1.Descriptor{a.Digest: {b, c}, b.Digest: {c}},
+		},
+	} {
+		h := HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+			return tt.edges[desc.Digest], nil
+		})
+		err := Walk(context.Background(), h, tt.roots...)
+		if tt.cycle && errors.Cause(err) != ErrCycle {
+			t.Errorf("test %d: expected ErrCycle, got %v", i, err)
+		}
+		if !tt.cycle && err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+	}
+}
+
+func TestWalkConcurrency(t *testing.T) {
+	var roots []v1.Descriptor
+	for _, s := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		roots = append(roots, v1.Descriptor{Digest: digest.FromString(s)})
+	}
+
+	for _, concurrency := range []int{1, 3} {
+		var mu sync.Mutex
+		var running, max int
+		h := HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+			mu.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil, nil
+		})
+		w := Walker{Handler: h, Concurrency: concurrency}
+		if err := w.Walk(context.Background(), roots...); err != nil {
+			t.Fatal(err)
+		}
+		if max > concurrency {
+			t.Errorf("expected at most %d handlers at once, got %d", concurrency, max)
+		}
+	}
+}
+
+func TestMediaTypes(t *testing.T) {
+	var handled []string
+	h := MediaTypes{
+		v1.MediaTypeImageLayer: HandlerFunc(func(ctx context.Context, desc v1.Descriptor) ([]v1.Descriptor, error) {
+			handled = append(handled, desc.MediaType)
+			return []v1.Descriptor{desc}, nil
+		}),
+	}
+	for _, mediaType := range []string{v1.MediaTypeImageLayer, v1.MediaTypeImageConfig} {
+		children, err := h.Handle(context.Background(), v1.Descriptor{MediaType: mediaType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (mediaType == v1.MediaTypeImageLayer) != (len(children) == 1) {
+			t.Errorf("%s: unexpected children %v", mediaType, children)
+		}
+	}
+	if len(handled) != 1 {
+		t.Errorf("expected 1 handled descriptor, got %v", handled)
+	}
+}